@@ -27,6 +27,7 @@ func main() {
 	var pprof string
 	userName := user.Name()
 
+	flag.BoolVar(&args.Compress, "compress", false, "Compress the data sent by the servers (zstd)")
 	flag.BoolVar(&args.NoColor, "noColor", false, "Disable ANSII terminal colors")
 	flag.BoolVar(&args.Quiet, "quiet", false, "Quiet output mode")
 	flag.BoolVar(&args.RegexInvert, "invert", false, "Invert regex")
@@ -39,6 +40,7 @@ func main() {
 	flag.IntVar(&args.LContext.BeforeContext, "before", 0, "Print lines of leading context before matching lines")
 	flag.IntVar(&args.LContext.MaxCount, "max", 0, "Stop reading file after NUM matching lines")
 	flag.IntVar(&args.SSHPort, "port", config.DefaultSSHPort, "SSH server port")
+	flag.IntVar(&args.Timeout, "timeout", 0, "Max time dtail server will collect data until disconnection")
 	flag.StringVar(&args.ConfigFile, "cfg", "", "Config file path")
 	flag.StringVar(&args.Discovery, "discovery", "", "Server discovery method")
 	flag.StringVar(&args.LogDir, "logDir", "~/log", "Log dir")
@@ -47,6 +49,10 @@ func main() {
 	flag.StringVar(&args.SSHPrivateKeyFilePath, "key", "", "Path to private key")
 	flag.StringVar(&args.RegexStr, "regex", ".", "Regular expression")
 	flag.StringVar(&args.ServersStr, "servers", "", "Remote servers to connect")
+	flag.StringVar(&args.SinceStr, "since", "",
+		"Only read log lines since this time, e.g. 15m (ago), 10:00 or 2023-01-30T10:00")
+	flag.StringVar(&args.UntilStr, "until", "",
+		"Only read log lines until this time, e.g. 5m (ago), 10:15 or 2023-01-30T10:15")
 	flag.StringVar(&args.UserName, "user", userName, "Your system user name")
 	flag.StringVar(&args.What, "files", "", "File(s) to read")
 	flag.StringVar(&grep, "grep", "", "Alias for -regex")
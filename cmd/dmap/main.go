@@ -30,6 +30,7 @@ func main() {
 	}
 	userName := user.Name()
 
+	flag.BoolVar(&args.Compress, "compress", false, "Compress the data sent by the servers (zstd)")
 	flag.BoolVar(&args.NoColor, "noColor", false, "Disable ANSII terminal colors")
 	flag.BoolVar(&args.Quiet, "quiet", false, "Quiet output mode")
 	flag.BoolVar(&args.Plain, "plain", false, "Plain output mode")
@@ -45,8 +46,14 @@ func main() {
 	flag.StringVar(&args.Logger, "logger", config.DefaultClientLogger, "Logger name")
 	flag.StringVar(&args.LogLevel, "logLevel", config.DefaultLogLevel, "Log level")
 	flag.StringVar(&args.SSHPrivateKeyFilePath, "key", "", "Path to private key")
+	flag.StringVar(&args.Output, "output", "",
+		"Map reduce result output format: table, json, ndjson, csv, tsv or markdown")
 	flag.StringVar(&args.QueryStr, "query", "", "Map reduce query")
 	flag.StringVar(&args.ServersStr, "servers", "", "Remote servers to connect")
+	flag.StringVar(&args.SinceStr, "since", "",
+		"Only read log lines since this time, e.g. 15m (ago), 10:00 or 2023-01-30T10:00")
+	flag.StringVar(&args.UntilStr, "until", "",
+		"Only read log lines until this time, e.g. 5m (ago), 10:15 or 2023-01-30T10:15")
 	flag.StringVar(&args.UserName, "user", userName, "Your system user name")
 	flag.StringVar(&args.What, "files", "", "File(s) to read")
 	flag.StringVar(&pprof, "pprof", "", "Start PProf server this address")
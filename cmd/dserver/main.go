@@ -39,6 +39,8 @@ func main() {
 	flag.StringVar(&args.LogLevel, "logLevel", config.DefaultLogLevel, "Log level")
 	flag.StringVar(&args.Logger, "logger", config.DefaultServerLogger, "Logger name")
 	flag.StringVar(&args.SSHBindAddress, "bindAddress", "", "The SSH bind address")
+	flag.StringVar(&args.MetricsBindAddress, "metricsBindAddress", "",
+		"Serve Prometheus metrics at this address")
 	flag.StringVar(&pprof, "pprof", "", "Start PProf server this address")
 
 	flag.Parse()
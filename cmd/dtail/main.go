@@ -8,6 +8,7 @@ import (
 	_ "net/http"
 	_ "net/http/pprof"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -31,15 +32,18 @@ func main() {
 	var displayVersion bool
 	var grep string
 	var pprof string
+	var regexFile string
 	var shutdownAfter int
 
 	userName := user.Name()
 
+	flag.BoolVar(&args.Compress, "compress", false, "Compress the data sent by the servers (zstd)")
 	flag.BoolVar(&args.NoColor, "noColor", false, "Disable ANSII terminal colors")
 	flag.BoolVar(&args.Quiet, "quiet", false, "Quiet output mode")
 	flag.BoolVar(&args.RegexInvert, "invert", false, "Invert regex")
 	flag.BoolVar(&args.Plain, "plain", false, "Plain output mode")
 	flag.BoolVar(&args.TrustAllHosts, "trustAllHosts", false, "Trust all unknown host keys")
+	flag.BoolVar(&args.TUI, "tui", false, "Interactive full-screen terminal UI")
 	flag.BoolVar(&checkHealth, "checkHealth", false, "Deprecated, flag will be removed soon")
 	flag.BoolVar(&displayColorTable, "colorTable", false, "Show color table")
 	flag.BoolVar(&displayWideColorTable, "wideColorTable", false, "Show a large color table")
@@ -58,8 +62,13 @@ func main() {
 	flag.StringVar(&args.Logger, "logger", config.DefaultClientLogger, "Logger name")
 	flag.StringVar(&args.LogLevel, "logLevel", config.DefaultLogLevel, "Log level")
 	flag.StringVar(&args.SSHPrivateKeyFilePath, "key", "", "Path to private key")
+	flag.StringVar(&args.Output, "output", "",
+		"Map reduce result output format: table, json, ndjson, csv, tsv or markdown")
 	flag.StringVar(&args.QueryStr, "query", "", "Map reduce query")
 	flag.StringVar(&args.RegexStr, "regex", ".", "Regular expression")
+	flag.StringVar(&regexFile, "regexFile", "",
+		"Change the regex of the running tails to the one in this file on SIGUSR1 "+
+			"(not with -query or -tui)")
 	flag.StringVar(&args.ServersStr, "servers", "", "Remote servers to connect")
 	flag.StringVar(&args.UserName, "user", userName, "Your system user name")
 	flag.StringVar(&args.What, "files", "", "File(s) to read")
@@ -108,15 +117,26 @@ func main() {
 		}()
 	}
 
+	if regexFile != "" && (args.QueryStr != "" || args.TUI) {
+		dlog.Client.FatalPanic("The -regexFile flag can't be used with -query or -tui")
+	}
+
 	var client clients.Client
 	var err error
 	args.Mode = omode.TailClient
 
 	switch args.QueryStr {
 	case "":
-		if client, err = clients.NewTailClient(args); err != nil {
+		tailClient, err := clients.NewTailClient(args)
+		if err != nil {
 			panic(err)
 		}
+		if regexFile != "" {
+			// Listen on the signal before the default action could kill dtail.
+			userCh := signal.UserCh(ctx)
+			go changeRegexOnSignal(ctx, tailClient, regexFile, userCh)
+		}
+		client = tailClient
 	default:
 		if client, err = clients.NewMaprClient(args, clients.DefaultMode); err != nil {
 			panic(err)
@@ -129,3 +149,28 @@ func main() {
 	wg.Wait()
 	os.Exit(status)
 }
+
+// Changes the regex of the running tails to the one in the regex file whenever
+// SIGUSR1 is received, e.g. 'echo ERROR > regex.txt; pkill -USR1 dtail'.
+func changeRegexOnSignal(ctx context.Context, client *clients.TailClient, regexFile string,
+	userCh <-chan struct{}) {
+
+	for {
+		select {
+		case <-userCh:
+			data, err := os.ReadFile(regexFile)
+			if err != nil {
+				dlog.Client.Error("Unable to read regex file", regexFile, err)
+				continue
+			}
+			regexStr := strings.TrimSpace(string(data))
+			if err := client.ChangeRegex(regexStr); err != nil {
+				dlog.Client.Error("Unable to change regex", regexStr, err)
+				continue
+			}
+			dlog.Client.Info("Changed regex", regexStr)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
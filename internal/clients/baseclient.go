@@ -2,10 +2,12 @@ package clients
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/mimecast/dtail/internal/clients/connectors"
+	"github.com/mimecast/dtail/internal/clients/handlers"
 	"github.com/mimecast/dtail/internal/config"
 	"github.com/mimecast/dtail/internal/discovery"
 	"github.com/mimecast/dtail/internal/io/dlog"
@@ -22,6 +24,9 @@ type baseClient struct {
 	stats *stats
 	// We have one connection per remote server.
 	connections []connectors.Connector
+	// Connections are replaced when reconnecting. It's a pointer as the
+	// clients are copied by value when passed as a maker.
+	connectionsMutex *sync.Mutex
 	// SSH auth methods to use to connect to the remote servers.
 	sshAuthMethods []gossh.AuthMethod
 	// To deal with SSH host keys
@@ -38,6 +43,7 @@ type baseClient struct {
 
 func (c *baseClient) init() {
 	dlog.Client.Debug("Initiating base client", c.Args.String())
+	c.connectionsMutex = &sync.Mutex{}
 
 	flag := regex.Default
 	if c.Args.RegexInvert {
@@ -72,7 +78,12 @@ func (c *baseClient) makeConnections(maker maker) {
 func (c *baseClient) Start(ctx context.Context, statsCh <-chan string) (status int) {
 	dlog.Client.Trace("Starting base client")
 	// Can be nil when serverless.
-	if c.hostKeyCallback != nil {
+	switch {
+	case c.hostKeyCallback == nil:
+	case c.Args.TUI:
+		// The user can't be prompted while the terminal is used by the TUI.
+		go c.hostKeyCallback.RejectUnknownHosts(ctx)
+	default:
 		// Periodically check for unknown hosts, and ask the user whether to trust them or not.
 		go c.hostKeyCallback.PromptAddHosts(ctx)
 	}
@@ -126,7 +137,9 @@ func (c *baseClient) startConnection(ctx context.Context, i int,
 		time.Sleep(time.Second * 2)
 		dlog.Client.Debug(conn.Server(), "Reconnecting")
 		conn = c.makeConnection(conn.Server(), c.sshAuthMethods, c.hostKeyCallback)
+		c.connectionsMutex.Lock()
 		c.connections[i] = conn
+		c.connectionsMutex.Unlock()
 	}
 }
 
@@ -139,3 +152,46 @@ func (c *baseClient) makeConnection(server string, sshAuthMethods []gossh.AuthMe
 	return connectors.NewServerConnection(server, c.UserName, sshAuthMethods,
 		hostKeyCallback, c.maker.makeHandler(server), c.maker.makeCommands())
 }
+
+// Send a command to all remote servers concurrently.
+func (c *baseClient) sendCommand(command string) error {
+	return c.forEachHandler(func(handler handlers.Handler) error {
+		return handler.SendMessage(command)
+	})
+}
+
+// Run send with the handlers of all remote servers concurrently.
+func (c *baseClient) forEachHandler(send func(handler handlers.Handler) error) error {
+	c.connectionsMutex.Lock()
+	connections := make([]connectors.Connector, len(c.connections))
+	copy(connections, c.connections)
+	c.connectionsMutex.Unlock()
+
+	var wg sync.WaitGroup
+	wg.Add(len(connections))
+	errs := make(chan error, len(connections))
+
+	for _, conn := range connections {
+		go func(conn connectors.Connector) {
+			defer wg.Done()
+			if err := send(conn.Handler()); err != nil {
+				errs <- fmt.Errorf("%s: %w", conn.Server(), err)
+			}
+		}(conn)
+	}
+
+	wg.Wait()
+	close(errs)
+	// Only report the first error, as all servers usually fail the same way.
+	return <-errs
+}
+
+// Returns the command to read the file, with a server side time budget if a
+// timeout is set.
+func (c *baseClient) makeReadCommand(modeStr, file, regex string) string {
+	if c.Timeout > 0 {
+		return fmt.Sprintf("timeout:%s %d %s %s %s", c.Args.SerializeOptions(),
+			c.Timeout, modeStr, file, regex)
+	}
+	return fmt.Sprintf("%s:%s %s %s", modeStr, c.Args.SerializeOptions(), file, regex)
+}
@@ -1,20 +1,25 @@
 package clients
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"os"
 	"runtime"
 	"strings"
 
 	"github.com/mimecast/dtail/internal/clients/handlers"
 	"github.com/mimecast/dtail/internal/config"
 	"github.com/mimecast/dtail/internal/io/dlog"
+	"github.com/mimecast/dtail/internal/mapr/logformat"
 	"github.com/mimecast/dtail/internal/omode"
 )
 
 // CatClient is a client for returning a whole file from the beginning to the end.
 type CatClient struct {
 	baseClient
+	// Writes the parsed log lines of all servers, only for the Parquet output.
+	parquetRows *handlers.ParquetRows
 }
 
 // NewCatClient returns a new cat client.
@@ -32,12 +37,55 @@ func NewCatClient(args config.Args) (*CatClient, error) {
 		},
 	}
 
+	switch args.Output {
+	case "":
+	case "parquet":
+		if args.Plain {
+			return nil, errors.New("Can't use plain mode with the Parquet output")
+		}
+		// The lines are parsed on the client, which doesn't know the log formats
+		// configured on the servers.
+		if !logformat.IsBuiltin(args.LogFormat) {
+			return nil, fmt.Errorf("Log format '%s' isn't built-in, log formats "+
+				"configured on the servers aren't supported with the Parquet output",
+				args.LogFormat)
+		}
+		if _, err := logformat.NewParser(args.LogFormat, nil); err != nil {
+			return nil, err
+		}
+		c.parquetRows = handlers.NewParquetRows(os.Stdout)
+	default:
+		return nil, fmt.Errorf("Unknown output format '%s', only 'parquet' is supported",
+			args.Output)
+	}
+
 	c.init()
 	c.makeConnections(c)
 	return &c, nil
 }
 
+// Start starts the cat client. With the Parquet output, the lines are written
+// to stdout in row groups and the file is completed after all files were read.
+func (c *CatClient) Start(ctx context.Context, statsCh <-chan string) (status int) {
+	status = c.baseClient.Start(ctx, statsCh)
+	if c.parquetRows == nil {
+		return
+	}
+	if err := c.parquetRows.Close(); err != nil {
+		dlog.Client.Error("Unable to write Parquet output", err)
+		return 1
+	}
+	return
+}
+
 func (c CatClient) makeHandler(server string) handlers.Handler {
+	if c.parquetRows != nil {
+		handler, err := handlers.NewParquetHandler(server, c.LogFormat, c.parquetRows)
+		if err != nil {
+			dlog.Client.FatalPanic(err)
+		}
+		return handler
+	}
 	return handlers.NewClientHandler(server)
 }
 
@@ -47,8 +95,7 @@ func (c CatClient) makeCommands() (commands []string) {
 		dlog.Client.FatalPanic(err)
 	}
 	for _, file := range strings.Split(c.What, ",") {
-		commands = append(commands, fmt.Sprintf("%s:%s %s %s",
-			c.Mode.String(), c.Args.SerializeOptions(), file, regex))
+		commands = append(commands, c.makeReadCommand(c.Mode.String(), file, regex))
 	}
 	return
 }
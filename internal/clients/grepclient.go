@@ -2,7 +2,6 @@ package clients
 
 import (
 	"errors"
-	"fmt"
 	"runtime"
 	"strings"
 
@@ -48,8 +47,7 @@ func (c GrepClient) makeCommands() (commands []string) {
 		dlog.Client.FatalPanic(err)
 	}
 	for _, file := range strings.Split(c.What, ",") {
-		commands = append(commands, fmt.Sprintf("%s:%s %s %s",
-			c.Mode.String(), c.Args.SerializeOptions(), file, regex))
+		commands = append(commands, c.makeReadCommand(c.Mode.String(), file, regex))
 	}
 	return
 }
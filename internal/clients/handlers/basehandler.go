@@ -6,11 +6,29 @@ import (
 	"fmt"
 	"io"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/mimecast/dtail/internal"
 	"github.com/mimecast/dtail/internal/io/dlog"
 	"github.com/mimecast/dtail/internal/protocol"
+
+	"github.com/DataDog/zstd"
+)
+
+// The negotiation of the protocol version with the server.
+type negotiation int
+
+const (
+	// No command sent yet.
+	notNegotiated negotiation = iota
+	// The first command was sent with the current protocol version, the other
+	// commands are held back until the server replied.
+	negotiating negotiation = iota
+	// The server replied with framed messages (current protocol version).
+	framed negotiation = iota
+	// The server replied with delimited messages (older protocol version).
+	delimited negotiation = iota
 )
 
 type baseHandler struct {
@@ -20,6 +38,21 @@ type baseHandler struct {
 	commands     chan string
 	receiveBuf   bytes.Buffer
 	status       int
+
+	// To negotiate the protocol version with the server.
+	mutex        sync.Mutex
+	negotiation  negotiation
+	firstCommand string
+	pending      []string
+	// Skip the protocol mismatch error of an older server.
+	discarding bool
+	decoder    protocol.FrameDecoder
+	// The compressed messages (if the server compresses) are written to it.
+	decompressor *io.PipeWriter
+	// Closed once the decompressor stopped.
+	decompressed chan struct{}
+	// The handlers of the messages of the commands sent with an ID.
+	routes map[string]func(message string)
 }
 
 func (h *baseHandler) String() string {
@@ -42,11 +75,31 @@ func (h *baseHandler) Status() int {
 
 // SendMessage to the server.
 func (h *baseHandler) SendMessage(command string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	switch h.negotiation {
+	case notNegotiated:
+		h.negotiation = negotiating
+		h.firstCommand = command
+	case negotiating:
+		dlog.Client.Debug("Holding back command until protocol is negotiated", h.server, command)
+		h.pending = append(h.pending, command)
+		return nil
+	}
+	return h.sendMessage(command)
+}
+
+func (h *baseHandler) sendMessage(command string) error {
+	version := protocol.ProtocolCompat
+	if h.negotiation == delimited {
+		version = protocol.ProtocolCompatDelimited
+	}
 	encoded := base64.StdEncoding.EncodeToString([]byte(command))
-	dlog.Client.Debug("Sending command", h.server, command, encoded)
+	dlog.Client.Debug("Sending command", h.server, version, command, encoded)
 
 	select {
-	case h.commands <- fmt.Sprintf("protocol %s base64 %v;", protocol.ProtocolCompat, encoded):
+	case h.commands <- fmt.Sprintf("protocol %s base64 %v;", version, encoded):
 	case <-time.After(time.Second * 5):
 		return fmt.Errorf("Timed out sending command '%s' (base64: '%s')", command, encoded)
 	case <-h.Done():
@@ -56,9 +109,231 @@ func (h *baseHandler) SendMessage(command string) error {
 	return nil
 }
 
+// The server replied to the first command: Either with framed messages, or
+// older servers with delimited messages (starting with a protocol mismatch
+// error). Then send the held back commands with the negotiated version.
+func (h *baseHandler) negotiate(framedReply bool) {
+	commands := h.pending
+	h.pending = nil
+
+	switch {
+	case framedReply:
+		h.negotiation = framed
+	default:
+		dlog.Client.Debug(h.server, "Server doesn't support protocol",
+			protocol.ProtocolCompat, "falling back to", protocol.ProtocolCompatDelimited)
+		h.negotiation = delimited
+		h.discarding = true
+		commands = append([]string{h.firstCommand}, commands...)
+	}
+
+	for _, command := range commands {
+		if id := commandID(command); id != "" && h.negotiation == delimited {
+			dlog.Client.Error(h.server, "Server doesn't support command IDs", command)
+			delete(h.routes, id)
+			continue
+		}
+		if err := h.sendMessage(command); err != nil {
+			dlog.Client.Error(h.server, err)
+		}
+	}
+}
+
+// Splits the data received from the server into messages. Framed messages are
+// passed to handle, delimited messages (of older servers) are split byte by
+// byte by handleDelimited.
+func (h *baseHandler) receive(p []byte, handle func(message string),
+	handleDelimited func(b byte)) error {
+
+	h.mutex.Lock()
+	if h.negotiation == negotiating && len(p) > 0 {
+		h.negotiate(p[0] == protocol.FrameMagic)
+	}
+	negotiation := h.negotiation
+	h.mutex.Unlock()
+
+	if negotiation == framed {
+		// Only framed messages can be tagged with the ID of a command.
+		handleTagged := func(message string) {
+			if untagged, id := untag(message); id != "" {
+				h.route(id, untagged)
+				return
+			}
+			handle(message)
+		}
+		return h.decoder.Decode(p, func(messageType protocol.MessageType, message []byte) {
+			if messageType == protocol.CompressedMessage {
+				h.decompress(message, handleTagged)
+				return
+			}
+			handleTagged(string(message))
+		})
+	}
+	for _, b := range p {
+		if h.discarding {
+			h.discarding = b != protocol.MessageDelimiter
+			continue
+		}
+		handleDelimited(b)
+	}
+	return nil
+}
+
+// Passes the compressed data to the decompressor, which handles the framed
+// messages decompressed in order. The decompressor is started with the first
+// compressed data received.
+func (h *baseHandler) decompress(compressed []byte, handle func(message string)) {
+	if h.decompressor == nil {
+		dlog.Client.Debug(h.server, "Receiving compressed messages")
+		reader, writer := io.Pipe()
+		h.decompressor = writer
+		h.mutex.Lock()
+		h.decompressed = make(chan struct{})
+		h.mutex.Unlock()
+		go func() {
+			<-h.Done()
+			writer.Close()
+		}()
+		go h.decompressMessages(reader, handle)
+	}
+	// Blocks until the decompressor read the data.
+	if _, err := h.decompressor.Write(compressed); err != nil {
+		dlog.Client.Error(h.server, "Unable to decompress messages", err)
+	}
+}
+
+func (h *baseHandler) decompressMessages(reader *io.PipeReader, handle func(message string)) {
+	defer close(h.decompressed)
+	zr := zstd.NewReader(reader)
+	defer zr.Close()
+
+	var decoder protocol.FrameDecoder
+	handleFrame := func(_ protocol.MessageType, message []byte) {
+		handle(string(message))
+	}
+	buf := make([]byte, 64*1024)
+
+	for {
+		n, err := zr.Read(buf)
+		if n > 0 {
+			if err := decoder.Decode(buf[:n], handleFrame); err != nil {
+				dlog.Client.Error(h.server, err)
+				reader.CloseWithError(err)
+				return
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				dlog.Client.Error(h.server, "Unable to decompress messages", err)
+				reader.CloseWithError(err)
+			}
+			return
+		}
+	}
+}
+
+// Splits the ID of the command off the type of a tagged message, e.g.
+// REMOTE:ID|hostname|... into REMOTE|hostname|... and ID. The ID is empty if
+// the message isn't tagged.
+func untag(message string) (string, string) {
+	i := strings.Index(message, protocol.FieldDelimiter)
+	if i < 0 {
+		return message, ""
+	}
+	name, id, found := strings.Cut(message[:i], protocol.CommandIDDelimiter)
+	if !found {
+		return message, ""
+	}
+	switch name {
+	case "REMOTE", "SERVER", "AGGREGATE":
+		return name + message[i:], id
+	default:
+		return message, ""
+	}
+}
+
+// Passes the (untagged) message to the handler of the command with the ID.
+func (h *baseHandler) route(id, message string) {
+	h.mutex.Lock()
+	handle, ok := h.routes[id]
+	h.mutex.Unlock()
+
+	if !ok {
+		dlog.Client.Debug(h.server, "Dropping message of unknown command", id, message)
+		return
+	}
+	handle(message)
+}
+
+// Route passes all messages of the commands with the ID to handle, instead of
+// handling them like the messages of the commands without an ID. The route is
+// removed once the server finished the commands. A nil handle removes the
+// route.
+func (h *baseHandler) Route(id string, handle func(message string)) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if handle == nil {
+		delete(h.routes, id)
+		return
+	}
+	if h.routes == nil {
+		h.routes = make(map[string]func(message string))
+	}
+	h.routes[id] = handle
+}
+
+// TagCommand returns the command with the ID added to its options.
+func TagCommand(id, command string) string {
+	name, args, _ := strings.Cut(command, " ")
+	switch {
+	case strings.HasSuffix(name, ":"):
+		name += "id=" + id
+	default:
+		name += ":id=" + id
+	}
+	if args == "" {
+		return name
+	}
+	return name + " " + args
+}
+
+// Returns the ID the command was sent with, or an empty string.
+func commandID(command string) string {
+	name, _, _ := strings.Cut(command, " ")
+	for _, option := range strings.Split(name, ":")[1:] {
+		if id, ok := strings.CutPrefix(option, "id="); ok {
+			return id
+		}
+	}
+	return ""
+}
+
+// SendCommand sends a command with an ID to the server. All messages of the
+// command are tagged with the ID (e.g. REMOTE:ID|...) and passed to the route
+// of the ID (messages of IDs without a route are dropped). The session stays
+// open once the command finished, so that further commands can be sent.
+// Commands sent with the same ID belong together, e.g. a mapreduce query and
+// the commands reading its files.
+func (h *baseHandler) SendCommand(id, command string) error {
+	h.mutex.Lock()
+	negotiation := h.negotiation
+	h.mutex.Unlock()
+
+	if negotiation == delimited {
+		return fmt.Errorf("Server %s doesn't support command IDs", h.server)
+	}
+	return h.SendMessage(TagCommand(id, command))
+}
+
+// CancelCommand cancels all commands with the ID.
+func (h *baseHandler) CancelCommand(id string) error {
+	return h.SendMessage("cancel " + id)
+}
+
 // Read data from the dtail server via Writer interface.
 func (h *baseHandler) Write(p []byte) (n int, err error) {
-	for _, b := range p {
+	err = h.receive(p, h.handleFramedMessage, func(b byte) {
 		switch b {
 		case '\n':
 			// Backwards compatible with DTail 3 (e.g. get error message from server
@@ -72,6 +347,10 @@ func (h *baseHandler) Write(p []byte) (n int, err error) {
 		default:
 			h.receiveBuf.WriteByte(b)
 		}
+	})
+	if err != nil {
+		dlog.Client.Error(h.server, err)
+		return 0, err
 	}
 	return len(p), nil
 }
@@ -87,6 +366,20 @@ func (h *baseHandler) Read(p []byte) (n int, err error) {
 	return
 }
 
+// Handles a framed message the same way as a delimited one, where every newline
+// ends a message too, so that the output is the same with both protocols.
+func (h *baseHandler) handleFramedMessage(message string) {
+	for {
+		i := strings.IndexByte(message, '\n')
+		if i < 0 {
+			break
+		}
+		h.handleMessage(message[:i+1])
+		message = message[i+1:]
+	}
+	h.handleMessage(message)
+}
+
 func (h *baseHandler) handleMessage(message string) {
 	if len(message) > 0 && message[0] == '.' {
 		h.handleHiddenMessage(message)
@@ -102,7 +395,14 @@ func (h *baseHandler) handleHiddenMessage(message string) {
 	switch {
 	case strings.HasPrefix(message, ".syn close connection"):
 		go h.SendMessage(".ack close connection")
-		h.Shutdown()
+		// Not waiting for the decompressor, this may run in it.
+		h.done.Shutdown()
+	case strings.HasPrefix(message, ".protocol "):
+		dlog.Client.Debug(h.server, "Negotiated protocol", strings.TrimPrefix(message, ".protocol "))
+	case strings.HasPrefix(message, ".done "):
+		id := strings.TrimSpace(strings.TrimPrefix(message, ".done "))
+		dlog.Client.Debug(h.server, "Command finished", id)
+		h.Route(id, nil)
 	}
 }
 
@@ -110,6 +410,15 @@ func (h *baseHandler) Done() <-chan struct{} {
 	return h.done.Done()
 }
 
+// Shutdown the handler. Returns once the decompressor (if any) handled all
+// messages received, so that none of them get lost when the client exits.
 func (h *baseHandler) Shutdown() {
 	h.done.Shutdown()
+
+	h.mutex.Lock()
+	decompressed := h.decompressed
+	h.mutex.Unlock()
+	if decompressed != nil {
+		<-decompressed
+	}
 }
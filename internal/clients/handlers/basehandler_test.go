@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/mimecast/dtail/internal"
+	"github.com/mimecast/dtail/internal/config"
+	"github.com/mimecast/dtail/internal/io/dlog"
+	"github.com/mimecast/dtail/internal/protocol"
+	"github.com/mimecast/dtail/internal/source"
+
+	"github.com/DataDog/zstd"
+)
+
+func TestMain(m *testing.M) {
+	config.Setup(source.Client, &config.Args{ConfigFile: "none", Logger: "none",
+		What: "test"}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	dlog.Start(ctx, &wg, source.Client)
+
+	code := m.Run()
+	cancel()
+	wg.Wait()
+	os.Exit(code)
+}
+
+// Returns a handler which negotiated the current (framed) protocol already.
+func newTestHandler(t *testing.T) *baseHandler {
+	h := &baseHandler{
+		done:        internal.NewDone(),
+		server:      "server",
+		commands:    make(chan string, 10),
+		negotiation: framed,
+	}
+	t.Cleanup(h.Shutdown)
+	return h
+}
+
+func TestSendCommand(t *testing.T) {
+	h := newTestHandler(t)
+	if err := h.SendCommand("1", "cat: /var/log/foo.log ."); err != nil {
+		t.Errorf("Unable to send command: %v", err)
+	}
+	if err := h.SendCommand("job-2", "map:quiet=true from STATS select count($line)"); err != nil {
+		t.Errorf("Unable to send command: %v", err)
+	}
+	if err := h.SendCommand("3", "ack"); err != nil {
+		t.Errorf("Unable to send command: %v", err)
+	}
+	if err := h.CancelCommand("1"); err != nil {
+		t.Errorf("Unable to cancel command: %v", err)
+	}
+
+	expected := []string{
+		"cat:id=1 /var/log/foo.log .",
+		"map:quiet=true:id=job-2 from STATS select count($line)",
+		"ack:id=3",
+		"cancel 1",
+	}
+	for _, command := range expected {
+		sent := <-h.commands
+		prefix := "protocol " + protocol.ProtocolCompat + " base64 "
+		if !strings.HasPrefix(sent, prefix) || !strings.HasSuffix(sent, ";") {
+			t.Errorf("Expected command with protocol version but got %q", sent)
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(sent[len(prefix) : len(sent)-1])
+		if err != nil {
+			t.Errorf("Unable to decode command %q: %v", sent, err)
+			continue
+		}
+		if string(decoded) != command {
+			t.Errorf("Expected command %q but got %q", command, decoded)
+		}
+	}
+}
+
+func TestRoute(t *testing.T) {
+	h := newTestHandler(t)
+	var untagged, routed []string
+	handle := func(message string) {
+		untagged = append(untagged, message)
+		if strings.HasPrefix(message, ".") {
+			h.handleHiddenMessage(message)
+		}
+	}
+	h.Route("job-1", func(message string) { routed = append(routed, message) })
+
+	var data bytes.Buffer
+	for _, message := range []string{
+		"REMOTE|host|100|1|a.log|Line 1\n",
+		"REMOTE:job-1|host|100|1|b.log|Line 2\n",
+		"AGGREGATE:job-1|host|count≔1",
+		"SERVER:job-2|host|Unknown command\n",
+		"foo:bar|Plain line\n",
+		".done job-1",
+		"REMOTE:job-1|host|100|2|b.log|Line 3\n",
+	} {
+		protocol.WriteFrame(&data, protocol.RemoteMessage, []byte(message))
+	}
+	if err := h.receive(data.Bytes(), handle, nil); err != nil {
+		t.Fatalf("Unable to receive messages: %v", err)
+	}
+
+	// The messages of job-2 (without route) and of job-1 after it finished are
+	// dropped.
+	expectedUntagged := []string{"REMOTE|host|100|1|a.log|Line 1\n",
+		"foo:bar|Plain line\n", ".done job-1"}
+	expectedRouted := []string{"REMOTE|host|100|1|b.log|Line 2\n",
+		"AGGREGATE|host|count≔1"}
+	if strings.Join(untagged, "¬") != strings.Join(expectedUntagged, "¬") {
+		t.Errorf("Expected untagged messages %q but got %q", expectedUntagged, untagged)
+	}
+	if strings.Join(routed, "¬") != strings.Join(expectedRouted, "¬") {
+		t.Errorf("Expected routed messages %q but got %q", expectedRouted, routed)
+	}
+}
+
+func TestCommandIDNotSupported(t *testing.T) {
+	h := newTestHandler(t)
+	h.negotiation = notNegotiated
+	h.Route("1", func(string) {})
+
+	// Commands with an ID aren't sent to older servers.
+	h.SendMessage("tail: /var/log/foo.log .")
+	h.SendCommand("1", "tail: /var/log/bar.log .")
+	<-h.commands
+	if err := h.receive([]byte("Protocol mismatch¬"), nil, func(byte) {}); err != nil {
+		t.Fatalf("Unable to receive messages: %v", err)
+	}
+	if len(h.commands) != 1 {
+		t.Errorf("Expected only the command without ID to be resent but got %d",
+			len(h.commands))
+	}
+	if _, ok := h.routes["1"]; ok {
+		t.Errorf("Expected the route of the dropped command to be removed")
+	}
+	if err := h.SendCommand("2", "tail: /var/log/bar.log ."); err == nil {
+		t.Errorf("Expected an error sending a command with ID to an older server")
+	}
+}
+
+func TestDecompression(t *testing.T) {
+	h := newTestHandler(t)
+	h.negotiation = negotiating
+
+	// Compressed like the server does: One stream, flushed into a frame at a
+	// time.
+	var data, compressed bytes.Buffer
+	zw := zstd.NewWriter(&compressed)
+	var expected []string
+	compressFrame := func(from, to int) {
+		var batch bytes.Buffer
+		for i := from; i < to; i++ {
+			message := fmt.Sprintf("REMOTE|host|100|%d|a.log|Line %d\n", i, i)
+			protocol.WriteFrame(&batch, protocol.RemoteMessage, []byte(message))
+			expected = append(expected, message)
+		}
+		compressed.Reset()
+		if _, err := zw.Write(batch.Bytes()); err != nil {
+			t.Fatalf("Unable to compress messages: %v", err)
+		}
+		if err := zw.Flush(); err != nil {
+			t.Fatalf("Unable to compress messages: %v", err)
+		}
+		protocol.WriteFrame(&data, protocol.CompressedMessage, compressed.Bytes())
+	}
+
+	// The server switches to compressed frames after the first messages.
+	protocol.WriteFrame(&data, protocol.HiddenMessage, []byte(".protocol 5.0"))
+	protocol.WriteFrame(&data, protocol.ServerMessage, []byte("SERVER|host|Plain\n"))
+	expected = append(expected, ".protocol 5.0", "SERVER|host|Plain\n")
+	compressFrame(0, 1000)
+	compressFrame(1000, 1001)
+	// The last frame ends the stream.
+	compressed.Reset()
+	if err := zw.Close(); err != nil {
+		t.Fatalf("Unable to end compressed stream: %v", err)
+	}
+	protocol.WriteFrame(&data, protocol.CompressedMessage, compressed.Bytes())
+
+	received := make(chan string, len(expected))
+	handle := func(message string) { received <- message }
+	// Received in small chunks, as the SSH channel may split the frames.
+	for p := data.Bytes(); len(p) > 0; {
+		n := 1000
+		if n > len(p) {
+			n = len(p)
+		}
+		if err := h.receive(p[:n], handle, nil); err != nil {
+			t.Fatalf("Unable to receive messages: %v", err)
+		}
+		p = p[n:]
+	}
+	if h.negotiation != framed {
+		t.Errorf("Expected framed messages to be negotiated")
+	}
+
+	// Shutdown returns once the decompressor handled all messages received.
+	h.Shutdown()
+	if len(received) != len(expected) {
+		t.Fatalf("Expected %d messages after shutdown but got %d", len(expected),
+			len(received))
+	}
+	for i, message := range expected {
+		if m := <-received; m != message {
+			t.Fatalf("Expected message %d %q but got %q", i, message, m)
+		}
+	}
+	select {
+	case <-h.decompressed:
+	default:
+		t.Errorf("Expected the decompressor to stop after shutdown")
+	}
+}
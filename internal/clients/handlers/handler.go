@@ -8,6 +8,9 @@ import (
 type Handler interface {
 	io.ReadWriter
 	SendMessage(command string) error
+	SendCommand(id, command string) error
+	CancelCommand(id string) error
+	Route(id string, handle func(message string))
 	Server() string
 	Status() int
 	Shutdown()
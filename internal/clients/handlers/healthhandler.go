@@ -30,7 +30,13 @@ func NewHealthHandler(server string) *HealthHandler {
 
 // Read data from the dtail server via Writer interface.
 func (h *HealthHandler) Write(p []byte) (n int, err error) {
-	for _, b := range p {
+	handle := func(message string) {
+		// Like delimited messages, split at every newline.
+		for _, part := range strings.Split(message, "\n") {
+			h.handleMessage(part)
+		}
+	}
+	err = h.baseHandler.receive(p, handle, func(b byte) {
 		switch b {
 		case '\n', protocol.MessageDelimiter:
 			message := h.baseHandler.receiveBuf.String()
@@ -39,6 +45,9 @@ func (h *HealthHandler) Write(p []byte) (n int, err error) {
 		default:
 			h.baseHandler.receiveBuf.WriteByte(b)
 		}
+	})
+	if err != nil {
+		return 0, err
 	}
 	return len(p), nil
 }
@@ -38,32 +38,48 @@ func NewMaprHandler(server string, query *mapr.Query,
 
 // Read data from the dtail server via Writer interface.
 func (h *MaprHandler) Write(p []byte) (n int, err error) {
-	for _, b := range p {
+	handle := func(message string) {
+		// Like delimited messages, replace all newlines by a trailing one.
+		if strings.Contains(message, "\n") {
+			message = strings.ReplaceAll(message, "\n", "")
+			if len(message) == 0 || message[0] != 'A' {
+				message += "\n"
+			}
+		}
+		h.handleMaprMessage(message)
+	}
+	err = h.baseHandler.receive(p, handle, func(b byte) {
 		switch b {
 		case '\n':
 			h.removedNl = true
 		case protocol.MessageDelimiter:
 			message := h.baseHandler.receiveBuf.String()
-			dlog.Client.Debug(message)
-			if message[0] == 'A' {
-				h.handleAggregateMessage(message)
-			} else {
-				if h.removedNl {
-					h.baseHandler.handleMessage(message + "\n")
-				} else {
-					h.baseHandler.handleMessage(message)
-				}
+			if h.removedNl && (len(message) == 0 || message[0] != 'A') {
+				message += "\n"
 			}
+			h.handleMaprMessage(message)
 			h.baseHandler.receiveBuf.Reset()
 			h.removedNl = false
 		default:
 			h.baseHandler.receiveBuf.WriteByte(b)
 		}
+	})
+	if err != nil {
+		dlog.Client.Error(h.server, err)
+		return 0, err
 	}
-
 	return len(p), nil
 }
 
+func (h *MaprHandler) handleMaprMessage(message string) {
+	dlog.Client.Debug(message)
+	if len(message) > 0 && message[0] == 'A' {
+		h.handleAggregateMessage(message)
+		return
+	}
+	h.baseHandler.handleMessage(message)
+}
+
 // Handle a message received from server including mapr aggregation related data.
 func (h *MaprHandler) handleAggregateMessage(message string) {
 	parts := strings.SplitN(message, protocol.FieldDelimiter, 3)
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/mimecast/dtail/internal"
+	"github.com/mimecast/dtail/internal/io/dlog"
+	"github.com/mimecast/dtail/internal/io/parquet"
+	"github.com/mimecast/dtail/internal/mapr/logformat"
+	"github.com/mimecast/dtail/internal/protocol"
+)
+
+// ParquetRows writes the parsed log lines of all servers into one Parquet
+// file. The lines are written in row groups while they are received, the file
+// is complete once closed after all lines were received.
+type ParquetRows struct {
+	mutex  sync.Mutex
+	writer *parquet.Writer
+}
+
+// NewParquetRows returns a new Parquet row collection writing to w.
+func NewParquetRows(w io.Writer) *ParquetRows {
+	return &ParquetRows{writer: parquet.NewWriter(w,
+		parquet.Column{Name: "$server", Type: parquet.String},
+		parquet.Column{Name: "$line", Type: parquet.String},
+	)}
+}
+
+func (r *ParquetRows) add(fields map[string]string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.writer.AddRow(fields)
+}
+
+// Close writes the remaining rows and completes the Parquet file.
+func (r *ParquetRows) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.writer.Close()
+}
+
+// ParquetHandler is the client handler parsing all received log lines into
+// fields (according to a mapr log format) for the Parquet output.
+type ParquetHandler struct {
+	baseHandler
+	parser logformat.Parser
+	rows   *ParquetRows
+}
+
+// NewParquetHandler returns a new Parquet client handler.
+func NewParquetHandler(server, logFormatName string, rows *ParquetRows) (*ParquetHandler, error) {
+	dlog.Client.Debug(server, "Creating new Parquet handler")
+
+	parser, err := logformat.NewParser(logFormatName, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &ParquetHandler{
+		baseHandler: baseHandler{
+			server:       server,
+			shellStarted: false,
+			commands:     make(chan string),
+			status:       -1,
+			done:         internal.NewDone(),
+		},
+		parser: parser,
+		rows:   rows,
+	}, nil
+}
+
+// Read data from the dtail server via Writer interface.
+func (h *ParquetHandler) Write(p []byte) (n int, err error) {
+	handle := func(message string) {
+		// Like delimited messages, drop all newlines.
+		h.handleParquetMessage(strings.ReplaceAll(message, "\n", ""))
+	}
+	err = h.baseHandler.receive(p, handle, func(b byte) {
+		switch b {
+		case '\n':
+		case protocol.MessageDelimiter:
+			h.handleParquetMessage(h.baseHandler.receiveBuf.String())
+			h.baseHandler.receiveBuf.Reset()
+		default:
+			h.baseHandler.receiveBuf.WriteByte(b)
+		}
+	})
+	if err != nil {
+		dlog.Client.Error(h.server, err)
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (h *ParquetHandler) handleParquetMessage(message string) {
+	switch {
+	case strings.HasPrefix(message, "."):
+		h.baseHandler.handleHiddenMessage(message)
+		return
+	case !strings.HasPrefix(message, "REMOTE"):
+		// Don't mix up other messages with the Parquet file written to stdout.
+		dlog.Client.Debug(h.server, message)
+		return
+	}
+
+	// REMOTE|hostname|transmitted percentage|count|source ID|line
+	parts := strings.SplitN(message, protocol.FieldDelimiter, 6)
+	if len(parts) != 6 {
+		dlog.Client.Error("Unable to parse remote line", h.server, message)
+		return
+	}
+	hostname, line := parts[1], strings.TrimRight(parts[5], "\r\n")
+
+	fields, err := h.parser.MakeFields(line)
+	switch {
+	case errors.Is(err, logformat.ErrIgnoreFields):
+		return
+	case err != nil:
+		dlog.Client.Debug(h.server, "Unable to parse all fields", line, err)
+	}
+	if fields == nil {
+		fields = make(map[string]string, 3)
+	}
+
+	// These are helpers for mapr queries or the values of the client.
+	for _, name := range []string{"*", "$empty", "$timezone", "$timeoffset"} {
+		delete(fields, name)
+	}
+	fields["$server"] = hostname
+	fields["$hostname"] = hostname
+	fields["$line"] = line
+	if err := h.rows.add(fields); err != nil {
+		// The Parquet file can't be completed anymore.
+		dlog.Client.Error(h.server, "Unable to write Parquet output", err)
+		// Not waiting for the decompressor, this may run in it.
+		h.done.Shutdown()
+	}
+}
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"strings"
+
+	"github.com/mimecast/dtail/internal"
+	"github.com/mimecast/dtail/internal/clients/tui"
+	"github.com/mimecast/dtail/internal/io/dlog"
+	"github.com/mimecast/dtail/internal/protocol"
+)
+
+// TUIHandler is the client handler passing all received messages to the
+// interactive terminal UI instead of printing them.
+type TUIHandler struct {
+	baseHandler
+	ui *tui.TUI
+}
+
+// NewTUIHandler returns a new TUI client handler.
+func NewTUIHandler(server string, ui *tui.TUI) *TUIHandler {
+	dlog.Client.Debug(server, "Creating new TUI handler")
+
+	return &TUIHandler{
+		baseHandler: baseHandler{
+			server:       server,
+			shellStarted: false,
+			commands:     make(chan string),
+			status:       -1,
+			done:         internal.NewDone(),
+		},
+		ui: ui,
+	}
+}
+
+// Read data from the dtail server via Writer interface.
+func (h *TUIHandler) Write(p []byte) (n int, err error) {
+	handle := func(message string) {
+		// Like delimited messages, drop all newlines.
+		h.handleTUIMessage(strings.ReplaceAll(message, "\n", ""))
+	}
+	err = h.baseHandler.receive(p, handle, func(b byte) {
+		switch b {
+		case '\n':
+		case protocol.MessageDelimiter:
+			h.handleTUIMessage(h.baseHandler.receiveBuf.String())
+			h.baseHandler.receiveBuf.Reset()
+		default:
+			h.baseHandler.receiveBuf.WriteByte(b)
+		}
+	})
+	if err != nil {
+		dlog.Client.Error(h.server, err)
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (h *TUIHandler) handleTUIMessage(message string) {
+	if len(message) > 0 && message[0] == '.' {
+		h.baseHandler.handleHiddenMessage(message)
+		return
+	}
+	h.ui.Add(h.server, message)
+}
@@ -13,6 +13,7 @@ import (
 	"github.com/mimecast/dtail/internal/config"
 	"github.com/mimecast/dtail/internal/io/dlog"
 	"github.com/mimecast/dtail/internal/mapr"
+	"github.com/mimecast/dtail/internal/metrics"
 	"github.com/mimecast/dtail/internal/omode"
 )
 
@@ -39,6 +40,10 @@ type MaprClient struct {
 	cumulative bool
 	// The last result string received
 	lastResult string
+	// The format of the results printed to stdout
+	output mapr.OutputFormat
+	// The name under which the results are published as metrics (if set)
+	metricsName string
 }
 
 // NewMaprClient returns a new mapreduce client.
@@ -51,9 +56,17 @@ func NewMaprClient(args config.Args, maprClientMode MaprClientMode) (*MaprClient
 	if err != nil {
 		dlog.Client.FatalPanic(args.QueryStr, "Can't parse mapr query", err)
 	}
+	output, err := mapr.ParseOutputFormat(args.Output)
+	if err != nil {
+		return nil, err
+	}
+	if args.TUI {
+		return nil, errors.New("The TUI isn't supported for mapreduce queries")
+	}
 
-	// Don't retry connection if in tail mode and no outfile specified.
-	retry := args.Mode == omode.TailClient && !query.HasOutfile()
+	// Don't retry connection if in tail mode and no outfile specified, or once
+	// the server stopped due to the timeout.
+	retry := args.Mode == omode.TailClient && !query.HasOutfile() && args.Timeout == 0
 
 	var cumulative bool
 	switch maprClientMode {
@@ -76,6 +89,7 @@ func NewMaprClient(args config.Args, maprClientMode MaprClientMode) (*MaprClient
 		},
 		query:      query,
 		cumulative: cumulative,
+		output:     output,
 	}
 
 	switch c.query.Table {
@@ -99,7 +113,8 @@ func (c *MaprClient) Start(ctx context.Context, statsCh <-chan string) (status i
 	go c.periodicReportResults(ctx)
 
 	status = c.baseClient.Start(ctx, statsCh)
-	if c.cumulative {
+	// With a timeout, the servers send their final results before disconnecting.
+	if c.cumulative || c.Timeout > 0 {
 		dlog.Client.Debug("Received final mapreduce result")
 		c.reportResults(true)
 	}
@@ -107,6 +122,18 @@ func (c *MaprClient) Start(ctx context.Context, statsCh <-chan string) (status i
 	return
 }
 
+// PublishMetrics publishes the results of every interval as gauges (instead of
+// printing them), e.g. to serve them on the metrics endpoint of the server. An
+// outfile is still written if the query has one. Fails if the results can't
+// be published as metrics, e.g. if two fields have the same metric name.
+func (c *MaprClient) PublishMetrics(name string) error {
+	if err := c.query.ValidateMetrics(name); err != nil {
+		return err
+	}
+	c.metricsName = name
+	return nil
+}
+
 // NEXT: Make this a callback function rather trying to use polymorphism to call
 // this. This applies to all clients. It will make the code easier to read.
 func (c MaprClient) makeHandler(server string) handlers.Handler {
@@ -114,7 +141,12 @@ func (c MaprClient) makeHandler(server string) handlers.Handler {
 }
 
 func (c MaprClient) makeCommands() (commands []string) {
-	commands = append(commands, fmt.Sprintf("map %s", c.query.RawQuery))
+	if c.Timeout > 0 {
+		commands = append(commands, fmt.Sprintf("timeout %d map %s", c.Timeout,
+			c.query.RawQuery))
+	} else {
+		commands = append(commands, fmt.Sprintf("map %s", c.query.RawQuery))
+	}
 	modeStr := "cat"
 	if c.Mode == omode.TailClient {
 		modeStr = "tail"
@@ -125,13 +157,7 @@ func (c MaprClient) makeCommands() (commands []string) {
 		if err != nil {
 			dlog.Client.FatalPanic(err)
 		}
-		if c.Timeout > 0 {
-			commands = append(commands, fmt.Sprintf("timeout %d %s %s %s", c.Timeout,
-				modeStr, file, regex))
-			continue
-		}
-		commands = append(commands, fmt.Sprintf("%s:%s %s %s",
-			modeStr, c.Args.SerializeOptions(), file, regex))
+		commands = append(commands, c.makeReadCommand(modeStr, file, regex))
 	}
 	return
 }
@@ -153,10 +179,23 @@ func (c *MaprClient) periodicReportResults(ctx context.Context) {
 }
 
 func (c *MaprClient) reportResults(finalResult bool) {
+	if c.metricsName != "" {
+		c.publishResults(finalResult)
+		return
+	}
 	if c.query.HasOutfile() {
 		c.writeResultsToOutfile(finalResult)
 		return
 	}
+	if c.output != mapr.TableOutput {
+		// Machine readable results are meant to be piped into other tools, so
+		// print cumulative results only once and not every interval.
+		if c.cumulative && !finalResult {
+			return
+		}
+		c.printResultsUnformatted()
+		return
+	}
 	c.printResults()
 }
 
@@ -173,9 +212,9 @@ func (c *MaprClient) printResults() {
 	}
 
 	if c.cumulative {
-		result, numRows, err = c.globalGroup.Result(c.query, rowsLimit)
+		result, numRows, err = c.globalGroup.Result(c.query, rowsLimit, c.output)
 	} else {
-		result, numRows, err = c.globalGroup.SwapOut().Result(c.query, rowsLimit)
+		result, numRows, err = c.globalGroup.SwapOut().Result(c.query, rowsLimit, c.output)
 	}
 	if err != nil {
 		dlog.Client.FatalPanic(err)
@@ -208,6 +247,28 @@ func (c *MaprClient) printResults() {
 	dlog.Client.Raw(fmt.Sprintf("%s\n", result))
 }
 
+// Print the result without the query and any warnings, so that it can be
+// processed by other tools, e.g. 'dmap -output json ... | jq'.
+func (c *MaprClient) printResultsUnformatted() {
+	var result string
+	var err error
+	var numRows int
+
+	if c.cumulative {
+		result, numRows, err = c.globalGroup.Result(c.query, -1, c.output)
+	} else {
+		result, numRows, err = c.globalGroup.SwapOut().Result(c.query, -1, c.output)
+	}
+	if err != nil {
+		dlog.Client.FatalPanic(err)
+	}
+	if numRows == 0 && c.output != mapr.JSONOutput {
+		dlog.Client.Debug("Empty result set this time...")
+		return
+	}
+	dlog.Client.Raw(result)
+}
+
 func (c *MaprClient) writeResultsToOutfile(finalResult bool) {
 	if c.cumulative {
 		if err := c.globalGroup.WriteResult(c.query, finalResult); err != nil {
@@ -219,3 +280,28 @@ func (c *MaprClient) writeResultsToOutfile(finalResult bool) {
 		dlog.Client.FatalPanic(err)
 	}
 }
+
+func (c *MaprClient) publishResults(finalResult bool) {
+	var families []metrics.Family
+	var err error
+
+	if c.cumulative {
+		families, err = c.globalGroup.Metrics(c.query, c.metricsName)
+		if err == nil && c.query.HasOutfile() {
+			err = c.globalGroup.WriteResult(c.query, finalResult)
+		}
+	} else {
+		// Swap out only once, so that the metrics and the outfile have the
+		// same result.
+		group := c.globalGroup.SwapOut()
+		families, err = group.Metrics(c.query, c.metricsName)
+		if err == nil && c.query.HasOutfile() {
+			err = group.WriteResult(c.query, true)
+		}
+	}
+	if err != nil {
+		dlog.Client.Error(c.metricsName, "Unable to publish mapreduce result", err)
+		return
+	}
+	metrics.JobResults.Set(c.metricsName, families)
+}
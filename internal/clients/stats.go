@@ -78,6 +78,11 @@ func (s *stats) Start(ctx context.Context, throttleCh <-chan struct{},
 	}
 }
 
+// Returns the amount of connected servers and the amount of all servers.
+func (s *stats) connectionStats() (int, int) {
+	return len(s.connectionsEstCh), s.servers
+}
+
 func (s *stats) printStatsDueInterrupt(messages []string) {
 	dlog.Client.Pause()
 	for i, message := range messages {
@@ -1,19 +1,31 @@
 package clients
 
 import (
+	"context"
 	"fmt"
 	"runtime"
 	"strings"
+	"sync"
 
 	"github.com/mimecast/dtail/internal/clients/handlers"
+	"github.com/mimecast/dtail/internal/clients/tui"
 	"github.com/mimecast/dtail/internal/config"
 	"github.com/mimecast/dtail/internal/io/dlog"
 	"github.com/mimecast/dtail/internal/omode"
+	"github.com/mimecast/dtail/internal/regex"
 )
 
 // TailClient is used for tailing remote log files (opening, seeking to the end and returning only new incoming lines).
 type TailClient struct {
 	baseClient
+	// The interactive terminal UI (nil if not enabled).
+	ui *tui.TUI
+	// Protects the regex, which can be changed while tailing, and the files
+	// opened while tailing.
+	mutex sync.Mutex
+	// The IDs of the commands tailing the files opened while tailing.
+	opened map[string]string
+	lastID int
 }
 
 // NewTailClient returns a new TailClient.
@@ -23,27 +35,171 @@ func NewTailClient(args config.Args) (*TailClient, error) {
 		baseClient: baseClient{
 			Args:       args,
 			throttleCh: make(chan struct{}, args.ConnectionsPerCPU*runtime.NumCPU()),
-			retry:      true,
+			// Don't reconnect once the server stopped tailing due to the timeout.
+			retry: args.Timeout == 0,
 		},
+		opened: make(map[string]string),
+	}
+
+	if args.TUI {
+		ui, err := tui.New(config.Client.TermColorsEnable)
+		if err != nil {
+			return nil, err
+		}
+		c.ui = ui
 	}
 
 	c.init()
-	c.makeConnections(c)
+	c.makeConnections(&c)
+	if c.ui != nil {
+		c.ui.OnGrep(c.Args.RegexStr, c.ChangeRegex)
+		c.ui.OnFiles(c.OpenFiles, c.CloseFiles)
+	}
 	return &c, nil
 }
 
-func (c TailClient) makeHandler(server string) handlers.Handler {
-	return handlers.NewClientHandler(server)
+// Start the tail client. With the TUI enabled, the client stops once the user
+// quits the TUI.
+func (c *TailClient) Start(ctx context.Context, statsCh <-chan string) (status int) {
+	if c.ui == nil {
+		return c.baseClient.Start(ctx, statsCh)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	uiDone := make(chan struct{})
+	go func() {
+		defer close(uiDone)
+		if err := c.ui.Start(ctx, c.stats.connectionStats); err != nil {
+			dlog.Client.Error(err)
+		}
+		cancel()
+	}()
+
+	status = c.baseClient.Start(ctx, statsCh)
+	cancel()
+	// Restore the terminal before exiting.
+	<-uiDone
+	return
 }
 
-func (c TailClient) makeCommands() (commands []string) {
+// ChangeRegex changes the regex of the running tails without reconnecting.
+// Reconnecting servers use the new regex too.
+func (c *TailClient) ChangeRegex(regexStr string) error {
+	flag := regex.Default
+	if c.Args.RegexInvert {
+		flag = regex.Invert
+	}
+	re, err := regex.New(regexStr, flag)
+	if err != nil {
+		return err
+	}
+	serialized, err := re.Serialize()
+	if err != nil {
+		return err
+	}
+
+	c.mutex.Lock()
+	c.Regex = re
+	c.mutex.Unlock()
+
+	dlog.Client.Debug("Changing regex", serialized)
+	return c.sendCommand(fmt.Sprintf("filter %s", serialized))
+}
+
+// OpenFiles starts tailing the files (comma separated) on all servers, in
+// addition to the files tailed already. The files are tailed with a command ID
+// over the existing connections, so that they can be stopped with CloseFiles.
+func (c *TailClient) OpenFiles(files string) error {
+	c.mutex.Lock()
+	if _, ok := c.opened[files]; ok {
+		c.mutex.Unlock()
+		return fmt.Errorf("Already tailing '%s'", files)
+	}
+	c.lastID++
+	id := fmt.Sprintf("files-%d", c.lastID)
+	c.opened[files] = id
+	regex, err := c.Regex.Serialize()
+	c.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+
+	dlog.Client.Debug("Opening files", id, files)
+	return c.forEachHandler(func(handler handlers.Handler) error {
+		handler.Route(id, c.route(handler.Server()))
+		for _, file := range strings.Split(files, ",") {
+			command := c.makeReadCommand(c.Mode.String(), file, regex)
+			if err := handler.SendCommand(id, command); err != nil {
+				handler.Route(id, nil)
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CloseFiles stops tailing the files opened with OpenFiles on all servers.
+func (c *TailClient) CloseFiles(files string) error {
+	c.mutex.Lock()
+	id, ok := c.opened[files]
+	delete(c.opened, files)
+	c.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("Not tailing '%s' (only opened files can be stopped)", files)
+	}
+
+	dlog.Client.Debug("Closing files", id, files)
+	return c.forEachHandler(func(handler handlers.Handler) error {
+		return handler.CancelCommand(id)
+	})
+}
+
+// Returns the route of the messages of the opened files, which are handled
+// like all other messages.
+func (c *TailClient) route(server string) func(message string) {
+	if c.ui != nil {
+		return func(message string) {
+			c.ui.Add(server, strings.ReplaceAll(message, "\n", ""))
+		}
+	}
+	return func(message string) {
+		dlog.Client.Raw(message)
+	}
+}
+
+func (c *TailClient) makeHandler(server string) handlers.Handler {
+	var handler handlers.Handler
+	if c.ui != nil {
+		handler = handlers.NewTUIHandler(server, c.ui)
+	} else {
+		handler = handlers.NewClientHandler(server)
+	}
+
+	// Reconnecting servers tail the opened files too.
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	for _, id := range c.opened {
+		handler.Route(id, c.route(server))
+	}
+	return handler
+}
+
+func (c *TailClient) makeCommands() (commands []string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	regex, err := c.Regex.Serialize()
 	if err != nil {
 		dlog.Client.FatalPanic(err)
 	}
 	for _, file := range strings.Split(c.What, ",") {
-		commands = append(commands, fmt.Sprintf("%s:%s %s %s",
-			c.Mode.String(), c.Args.SerializeOptions(), file, regex))
+		commands = append(commands, c.makeReadCommand(c.Mode.String(), file, regex))
+	}
+	for files, id := range c.opened {
+		for _, file := range strings.Split(files, ",") {
+			commands = append(commands, handlers.TagCommand(id,
+				c.makeReadCommand(c.Mode.String(), file, regex)))
+		}
 	}
 	dlog.Client.Debug(commands)
 	return
@@ -0,0 +1,93 @@
+package tui
+
+// A key pressed by the user.
+type key struct {
+	// The special key, or keyRune for ordinary characters.
+	special specialKey
+	r       rune
+}
+
+type specialKey int
+
+const (
+	keyRune      specialKey = iota
+	keyUp        specialKey = iota
+	keyDown      specialKey = iota
+	keyPageUp    specialKey = iota
+	keyPageDown  specialKey = iota
+	keyHome      specialKey = iota
+	keyEnd       specialKey = iota
+	keyEnter     specialKey = iota
+	keyEscape    specialKey = iota
+	keyBackspace specialKey = iota
+	keyCtrlC     specialKey = iota
+	keyUnknown   specialKey = iota
+)
+
+// The escape sequences of the special keys (as sent by common terminals).
+var escapeSequences = map[string]specialKey{
+	"[A":  keyUp,
+	"OA":  keyUp,
+	"[B":  keyDown,
+	"OB":  keyDown,
+	"[5~": keyPageUp,
+	"[6~": keyPageDown,
+	"[H":  keyHome,
+	"OH":  keyHome,
+	"[1~": keyHome,
+	"[F":  keyEnd,
+	"OF":  keyEnd,
+	"[4~": keyEnd,
+}
+
+// Decode the keys of the bytes read from the terminal in raw mode.
+func decodeKeys(input []byte) []key {
+	var keys []key
+	str := string(input)
+	for i := 0; i < len(str); {
+		switch b := str[i]; b {
+		case 0x1b:
+			special, n := decodeEscapeSequence(str[i+1:])
+			keys = append(keys, key{special: special})
+			i += 1 + n
+			continue
+		case '\r', '\n':
+			keys = append(keys, key{special: keyEnter})
+		case 0x7f, 0x08:
+			keys = append(keys, key{special: keyBackspace})
+		case 0x03:
+			keys = append(keys, key{special: keyCtrlC})
+		default:
+			if b < ' ' {
+				keys = append(keys, key{special: keyUnknown})
+				break
+			}
+			for _, r := range str[i:] {
+				keys = append(keys, key{r: r})
+				i += len(string(r))
+				break
+			}
+			continue
+		}
+		i++
+	}
+	return keys
+}
+
+// Returns the special key of the escape sequence and its length (without the
+// escape byte). A lone escape byte is the escape key.
+func decodeEscapeSequence(str string) (specialKey, int) {
+	if len(str) == 0 || (str[0] != '[' && str[0] != 'O') {
+		return keyEscape, 0
+	}
+	// The sequence ends with the first letter or '~' after the introducer.
+	for i := 1; i < len(str); i++ {
+		if c := str[i]; c == '~' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') {
+			if special, ok := escapeSequences[str[:i+1]]; ok {
+				return special, i + 1
+			}
+			return keyUnknown, i + 1
+		}
+	}
+	return keyUnknown, len(str)
+}
@@ -0,0 +1,74 @@
+package tui
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/mimecast/dtail/internal/protocol"
+)
+
+// A message received from a server.
+type entry struct {
+	// The hostname the message is about.
+	hostname string
+	// The percentage of matching lines transmitted by the server, or -1 if
+	// the message isn't a remote log line.
+	transmittedPerc int
+	// The text displayed.
+	text string
+}
+
+func newEntry(server, message string) entry {
+	message = strings.TrimRight(message, "\r\n")
+	e := entry{hostname: server, transmittedPerc: -1, text: message}
+
+	parts := strings.SplitN(message, protocol.FieldDelimiter, 6)
+	if len(parts) >= 2 {
+		e.hostname = parts[1]
+	}
+	if parts[0] != "REMOTE" || len(parts) != 6 {
+		return e
+	}
+
+	// REMOTE|hostname|transmitted percentage|count|source ID|line
+	if perc, err := strconv.Atoi(parts[2]); err == nil {
+		e.transmittedPerc = perc
+	}
+	e.text = parts[1] + protocol.FieldDelimiter + parts[5]
+	return e
+}
+
+// The scrollback buffer is a ring buffer of the last received messages. Each
+// message has a sequence number, which stays the same while the messages
+// before it are dropped from the buffer.
+type scrollback struct {
+	entries []entry
+	// The sequence number of the next message.
+	next int
+}
+
+func newScrollback(size int) *scrollback {
+	return &scrollback{entries: make([]entry, size)}
+}
+
+func (s *scrollback) add(e entry) {
+	s.entries[s.next%len(s.entries)] = e
+	s.next++
+}
+
+// The sequence number of the first message still in the buffer.
+func (s *scrollback) first() int {
+	if s.next < len(s.entries) {
+		return 0
+	}
+	return s.next - len(s.entries)
+}
+
+// The sequence number of the last message, or -1 if empty.
+func (s *scrollback) last() int {
+	return s.next - 1
+}
+
+func (s *scrollback) at(seq int) entry {
+	return s.entries[seq%len(s.entries)]
+}
@@ -0,0 +1,390 @@
+// Package tui implements the interactive full-screen terminal UI of dtail. It
+// displays the messages received by the client handlers in a scrollback
+// buffer, which can be paused, filtered by regex and by host and searched.
+package tui
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// The amount of messages kept in the scrollback buffer.
+const scrollbackSize int = 10000
+
+// How often the screen is redrawn (if anything changed).
+const redrawInterval time.Duration = time.Millisecond * 100
+
+const helpLine string = " q:quit space:pause ↑↓/PgUp/PgDn:scroll End:follow " +
+	"f:filter h:hosts /:search g:grep o:open x:close c:clear"
+
+// The input prompted from the user.
+type inputMode int
+
+const (
+	noInput     inputMode = iota
+	filterInput inputMode = iota
+	hostsInput  inputMode = iota
+	searchInput inputMode = iota
+	grepInput   inputMode = iota
+	openInput   inputMode = iota
+	closeInput  inputMode = iota
+)
+
+func (m inputMode) String() string {
+	switch m {
+	case filterInput:
+		return "Filter regex"
+	case hostsInput:
+		return "Hosts regex"
+	case searchInput:
+		return "Search regex"
+	case grepInput:
+		return "Server side grep regex"
+	case openInput:
+		return "Tail files"
+	case closeInput:
+		return "Stop tailing files"
+	default:
+		return ""
+	}
+}
+
+// StatsFunc returns the amount of connected and of all servers.
+type StatsFunc func() (connected, servers int)
+
+// GrepFunc changes the regex the servers grep for.
+type GrepFunc func(regexStr string) error
+
+// FilesFunc starts or stops tailing the files (comma separated) on all servers.
+type FilesFunc func(files string) error
+
+// TUI is the interactive full-screen terminal UI.
+type TUI struct {
+	mutex sync.Mutex
+	view  *view
+	// Anything changed since the last redraw?
+	dirty bool
+	// The user input currently prompted.
+	mode  inputMode
+	input []rune
+	// A message displayed instead of the help line, e.g. an invalid regex.
+	message string
+	// Changes the server side grep regex (nil if not supported).
+	grep    GrepFunc
+	grepStr string
+	// Start and stop tailing further files (nil if not supported).
+	openFiles  FilesFunc
+	closeFiles FilesFunc
+	stdin      *os.File
+	stdout     io.Writer
+}
+
+// New returns a new TUI. The TUI requires stdin and stdout to be a terminal.
+func New(colors bool) (*TUI, error) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stdout.Fd())) {
+		return nil, errors.New("The TUI requires stdin and stdout to be a terminal")
+	}
+	return &TUI{
+		view:   newView(scrollbackSize, colors),
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+	}, nil
+}
+
+// Add a message received from a server.
+func (t *TUI) Add(server, message string) {
+	e := newEntry(server, message)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.view.add(e)
+	t.dirty = true
+}
+
+// OnGrep enables changing the server side grep regex, which is currently
+// regexStr, by calling grep.
+func (t *TUI) OnGrep(regexStr string, grep GrepFunc) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.grepStr = regexStr
+	t.grep = grep
+}
+
+// OnFiles enables starting and stopping to tail further files while the TUI
+// is running, by calling open and stop.
+func (t *TUI) OnFiles(open, stop FilesFunc) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.openFiles = open
+	t.closeFiles = stop
+}
+
+// Start the TUI. It blocks until the user quits or the context is done, and
+// restores the terminal afterwards.
+func (t *TUI) Start(ctx context.Context, stats StatsFunc) error {
+	fd := int(t.stdin.Fd())
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("Unable to set terminal into raw mode: %w", err)
+	}
+	defer term.Restore(fd, oldState)
+
+	// Use the alternate screen and hide the cursor.
+	io.WriteString(t.stdout, "\x1b[?1049h\x1b[?25l")
+	defer io.WriteString(t.stdout, "\x1b[?25h\x1b[?1049l")
+
+	keysCh := make(chan []key)
+	go t.readKeys(ctx, keysCh)
+
+	var lastWidth, lastHeight int
+	ticker := time.NewTicker(redrawInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case keys := <-keysCh:
+			for _, k := range keys {
+				if quit := t.handleKey(k); quit {
+					return nil
+				}
+			}
+			t.draw(stats)
+		case <-ticker.C:
+			width, height, _ := term.GetSize(int(os.Stdout.Fd()))
+			t.mutex.Lock()
+			dirty := t.dirty || width != lastWidth || height != lastHeight
+			t.mutex.Unlock()
+			if dirty {
+				lastWidth, lastHeight = width, height
+				t.draw(stats)
+			}
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (t *TUI) readKeys(ctx context.Context, keysCh chan<- []key) {
+	buf := make([]byte, 64)
+	for {
+		n, err := t.stdin.Read(buf)
+		if err != nil {
+			return
+		}
+		select {
+		case keysCh <- decodeKeys(buf[:n]):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Handle a key pressed, returns true if the user wants to quit.
+func (t *TUI) handleKey(k key) bool {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.dirty = true
+
+	if k.special == keyCtrlC {
+		return true
+	}
+	if t.mode != noInput {
+		t.handleInputKey(k)
+		return false
+	}
+	t.message = ""
+
+	switch k.special {
+	case keyUp:
+		t.view.scroll(-1)
+	case keyDown:
+		t.view.scroll(1)
+	case keyPageUp:
+		t.view.scroll(-t.pageSize())
+	case keyPageDown:
+		t.view.scroll(t.pageSize())
+	case keyHome:
+		t.view.scroll(-t.view.scrollback.next)
+	case keyEnd:
+		t.view.paused = false
+	case keyRune:
+		switch k.r {
+		case 'q':
+			return true
+		case ' ', 'p':
+			t.view.togglePause()
+		case 'k':
+			t.view.scroll(-1)
+		case 'j':
+			t.view.scroll(1)
+		case 'G':
+			t.view.paused = false
+		case 'f':
+			t.prompt(filterInput, t.view.filter)
+		case 'h':
+			t.prompt(hostsInput, t.view.hosts)
+		case '/':
+			t.prompt(searchInput, t.view.search)
+		case 'g':
+			if t.grep == nil {
+				t.message = " Changing the grep regex isn't supported"
+				break
+			}
+			t.mode = grepInput
+			t.input = []rune(t.grepStr)
+		case 'o', 'x':
+			if t.openFiles == nil {
+				t.message = " Tailing further files isn't supported"
+				break
+			}
+			t.mode = openInput
+			if k.r == 'x' {
+				t.mode = closeInput
+			}
+			t.input = nil
+		case 'c':
+			t.view.filter, t.view.hosts, t.view.search = nil, nil, nil
+		}
+	}
+	return false
+}
+
+func (t *TUI) prompt(mode inputMode, current *regexp.Regexp) {
+	t.mode = mode
+	t.input = nil
+	if current != nil {
+		t.input = []rune(current.String())
+	}
+}
+
+func (t *TUI) handleInputKey(k key) {
+	switch k.special {
+	case keyRune:
+		t.input = append(t.input, k.r)
+	case keyBackspace:
+		if len(t.input) > 0 {
+			t.input = t.input[:len(t.input)-1]
+		}
+	case keyEscape:
+		t.mode = noInput
+	case keyEnter:
+		if t.mode == openInput || t.mode == closeInput {
+			if len(t.input) > 0 {
+				t.changeFiles(t.mode, string(t.input))
+			}
+			t.mode = noInput
+			t.message = ""
+			return
+		}
+		var re *regexp.Regexp
+		if len(t.input) > 0 {
+			var err error
+			if re, err = regexp.Compile(string(t.input)); err != nil {
+				t.message = fmt.Sprintf(" Invalid regex: %v", err)
+				return
+			}
+		}
+		switch t.mode {
+		case grepInput:
+			t.changeGrep(string(t.input))
+		case filterInput:
+			t.view.filter = re
+		case hostsInput:
+			t.view.hosts = re
+		case searchInput:
+			t.view.search = re
+		}
+		t.mode = noInput
+		t.message = ""
+	}
+}
+
+// Send the new grep regex to the servers in the background, as that may take
+// a while with many servers.
+func (t *TUI) changeGrep(regexStr string) {
+	if regexStr == "" {
+		regexStr = "."
+	}
+	t.grepStr = regexStr
+	grep := t.grep
+	go func() {
+		err := grep(regexStr)
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		t.dirty = true
+		if err != nil {
+			t.message = fmt.Sprintf(" Unable to change grep regex: %v", err)
+		}
+	}()
+}
+
+// Start or stop tailing the files in the background, like changing the grep
+// regex.
+func (t *TUI) changeFiles(mode inputMode, files string) {
+	change, action := t.openFiles, "tail"
+	if mode == closeInput {
+		change, action = t.closeFiles, "stop tailing"
+	}
+	go func() {
+		err := change(files)
+		t.mutex.Lock()
+		defer t.mutex.Unlock()
+		t.dirty = true
+		if err != nil {
+			t.message = fmt.Sprintf(" Unable to %s files: %v", action, err)
+		}
+	}()
+}
+
+// The amount of lines to scroll with page up and page down.
+func (t *TUI) pageSize() int {
+	_, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || height <= 3 {
+		return 1
+	}
+	return height - 3
+}
+
+// Redraw the whole screen: The messages, the status bar and the prompt (or
+// help) line at the bottom.
+func (t *TUI) draw(stats StatsFunc) {
+	width, height, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil || width <= 0 || height <= 2 {
+		return
+	}
+	connected, servers := stats()
+
+	t.mutex.Lock()
+	t.dirty = false
+	lines := t.view.render(width, height-2)
+	lines = append(lines, t.view.status(width, connected, servers))
+	switch {
+	case t.mode != noInput:
+		lines = append(lines, truncate(fmt.Sprintf(" %s: %s▏", t.mode,
+			printable(string(t.input))), width))
+	case t.message != "":
+		lines = append(lines, truncate(t.message, width))
+	default:
+		lines = append(lines, truncate(helpLine, width))
+	}
+	t.mutex.Unlock()
+
+	var sb strings.Builder
+	sb.WriteString("\x1b[H")
+	for i, line := range lines {
+		if i > 0 {
+			sb.WriteString("\r\n")
+		}
+		sb.WriteString(line)
+		sb.WriteString(clearLine)
+	}
+	io.WriteString(t.stdout, sb.String())
+}
@@ -0,0 +1,212 @@
+package tui
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ANSI escape sequences used for rendering.
+const (
+	reverse    string = "\x1b[7m"
+	reverseOff string = "\x1b[27m"
+	bold       string = "\x1b[1m"
+	reset      string = "\x1b[0m"
+	clearLine  string = "\x1b[K"
+)
+
+// The state of what is displayed, independent of the terminal.
+type view struct {
+	scrollback *scrollback
+	// Don't follow new messages while paused.
+	paused bool
+	// The sequence number of the bottom message while paused.
+	bottom int
+	// Only display messages matching the filter (if set).
+	filter *regexp.Regexp
+	// Only display messages of hosts matching (if set).
+	hosts *regexp.Regexp
+	// Highlight the matches of the search (if set).
+	search *regexp.Regexp
+	// The last transmitted percentage per host.
+	transmitted map[string]int
+	// Display the hostnames in bold.
+	colors bool
+}
+
+func newView(scrollbackSize int, colors bool) *view {
+	return &view{
+		scrollback:  newScrollback(scrollbackSize),
+		transmitted: make(map[string]int),
+		colors:      colors,
+	}
+}
+
+func (v *view) add(e entry) {
+	v.scrollback.add(e)
+	if e.transmittedPerc >= 0 {
+		v.transmitted[e.hostname] = e.transmittedPerc
+	}
+}
+
+func (v *view) visible(e entry) bool {
+	if v.hosts != nil && !v.hosts.MatchString(e.hostname) {
+		return false
+	}
+	return v.filter == nil || v.filter.MatchString(e.text)
+}
+
+// The sequence number of the bottom message displayed.
+func (v *view) bottomSeq() int {
+	if !v.paused {
+		return v.scrollback.last()
+	}
+	if v.bottom < v.scrollback.first() {
+		// The message got dropped from the scrollback buffer meanwhile.
+		v.bottom = v.scrollback.first()
+	}
+	return v.bottom
+}
+
+func (v *view) togglePause() {
+	if v.paused {
+		v.paused = false
+		return
+	}
+	v.pause()
+}
+
+func (v *view) pause() {
+	if !v.paused {
+		v.bottom = v.scrollback.last()
+		v.paused = true
+	}
+}
+
+// Scroll by the amount of visible messages, up if negative and down otherwise.
+// Scrolling pauses following new messages.
+func (v *view) scroll(lines int) {
+	v.pause()
+	seq := v.bottomSeq()
+	step := 1
+	if lines < 0 {
+		step = -1
+		lines = -lines
+	}
+	for next := seq + step; lines > 0; next += step {
+		if next < v.scrollback.first() || next > v.scrollback.last() {
+			break
+		}
+		if v.visible(v.scrollback.at(next)) {
+			seq = next
+			lines--
+		}
+	}
+	v.bottom = seq
+}
+
+// Returns the lowest transmitted percentage of all hosts.
+func (v *view) minTransmittedPerc() int {
+	perc := 100
+	for _, p := range v.transmitted {
+		if p < perc {
+			perc = p
+		}
+	}
+	return perc
+}
+
+// Render the messages to fill the given amount of lines of the given width.
+func (v *view) render(width, height int) []string {
+	lines := make([]string, height)
+	i := height - 1
+	for seq := v.bottomSeq(); seq >= v.scrollback.first() && i >= 0; seq-- {
+		e := v.scrollback.at(seq)
+		if !v.visible(e) {
+			continue
+		}
+		lines[i] = v.renderEntry(e, width)
+		i--
+	}
+	return lines
+}
+
+func (v *view) renderEntry(e entry, width int) string {
+	text := truncate(printable(e.text), width)
+
+	var matches [][]int
+	if v.search != nil {
+		matches = v.search.FindAllStringIndex(text, -1)
+	}
+	hostnameEnd := 0
+	if v.colors && strings.HasPrefix(text, e.hostname) {
+		hostnameEnd = len(e.hostname)
+	}
+	if len(matches) == 0 && hostnameEnd == 0 {
+		return text
+	}
+
+	var sb strings.Builder
+	pos := 0
+	if hostnameEnd > 0 && (len(matches) == 0 || matches[0][0] >= hostnameEnd) {
+		sb.WriteString(bold + text[:hostnameEnd] + reset)
+		pos = hostnameEnd
+	}
+	for _, match := range matches {
+		if match[0] < pos || match[0] == match[1] {
+			continue
+		}
+		sb.WriteString(text[pos:match[0]])
+		sb.WriteString(reverse + text[match[0]:match[1]] + reverseOff)
+		pos = match[1]
+	}
+	sb.WriteString(text[pos:])
+	return sb.String()
+}
+
+// The status bar shows the state of the view and the connection stats.
+func (v *view) status(width, connected, servers int) string {
+	state := "FOLLOW"
+	if v.paused {
+		state = "PAUSED"
+	}
+	status := fmt.Sprintf(" %s | servers: %d/%d | transmitted: %d%% | lines: %d",
+		state, connected, servers, v.minTransmittedPerc(), v.scrollback.next)
+	for _, re := range []struct {
+		name string
+		re   *regexp.Regexp
+	}{{"filter", v.filter}, {"hosts", v.hosts}, {"search", v.search}} {
+		if re.re != nil {
+			status += fmt.Sprintf(" | %s: %s", re.name, re.re.String())
+		}
+	}
+	status = truncate(status, width)
+	return reverse + status + strings.Repeat(" ", width-len([]rune(status))) + reset
+}
+
+// Replace tabs and control characters, so that log lines can't mess up the
+// terminal (e.g. with escape sequences).
+func printable(str string) string {
+	str = strings.ReplaceAll(str, "\t", "    ")
+	return strings.Map(func(r rune) rune {
+		if r < ' ' || r == 0x7f {
+			return '?'
+		}
+		return r
+	}, str)
+}
+
+// Truncate a string to the given amount of runes.
+func truncate(str string, width int) string {
+	if width <= 0 {
+		return ""
+	}
+	runes := 0
+	for i := range str {
+		if runes == width {
+			return str[:i]
+		}
+		runes++
+	}
+	return str
+}
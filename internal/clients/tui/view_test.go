@@ -0,0 +1,100 @@
+package tui
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+)
+
+func TestViewRender(t *testing.T) {
+	v := newView(4, false)
+	for i := 1; i <= 5; i++ {
+		v.add(newEntry("server", fmt.Sprintf("REMOTE|web%d|%d|%d|foo|line %d\n", i%2, 100-i, i, i)))
+	}
+	v.add(newEntry("server", "SERVER|web1|WARN|Some warning"))
+
+	// The first two lines got dropped from the scrollback buffer.
+	expected := []string{"", "web1|line 3", "web0|line 4", "web1|line 5",
+		"SERVER|web1|WARN|Some warning"}
+	assertLines(t, expected, v.render(40, 5))
+	// Long lines are truncated.
+	assertLines(t, []string{"web1|li", "SERVER|"}, v.render(7, 2))
+
+	if perc := v.minTransmittedPerc(); perc != 95 {
+		t.Errorf("Expected min transmitted percentage 95 but got %d", perc)
+	}
+
+	v.hosts = regexp.MustCompile("web1")
+	v.filter = regexp.MustCompile("line")
+	assertLines(t, []string{"web1|line 3", "web1|line 5"}, v.render(20, 2))
+}
+
+func TestViewPauseAndScroll(t *testing.T) {
+	v := newView(100, false)
+	add := func(from, to int) {
+		for i := from; i <= to; i++ {
+			v.add(newEntry("server", fmt.Sprintf("REMOTE|web|100|%d|foo|line %d", i, i)))
+		}
+	}
+	add(1, 5)
+
+	v.togglePause()
+	add(6, 7)
+	assertLines(t, []string{"web|line 4", "web|line 5"}, v.render(20, 2))
+
+	v.scroll(-2)
+	assertLines(t, []string{"web|line 2", "web|line 3"}, v.render(20, 2))
+	v.scroll(-10)
+	assertLines(t, []string{"", "web|line 1"}, v.render(20, 2))
+	v.scroll(1)
+	assertLines(t, []string{"web|line 1", "web|line 2"}, v.render(20, 2))
+
+	// Scrolling skips lines hidden by the filter.
+	v.filter = regexp.MustCompile("[246]$")
+	v.scroll(2)
+	assertLines(t, []string{"web|line 4", "web|line 6"}, v.render(20, 2))
+
+	v.togglePause()
+	v.filter = nil
+	assertLines(t, []string{"web|line 6", "web|line 7"}, v.render(20, 2))
+}
+
+func TestViewHighlight(t *testing.T) {
+	v := newView(10, true)
+	v.add(newEntry("server", "REMOTE|web|100|1|foo|an error and\tanother error\x1b[2J"))
+	v.search = regexp.MustCompile("error")
+
+	expected := bold + "web" + reset + "|an " + reverse + "error" + reverseOff +
+		" and    another " + reverse + "error" + reverseOff + "?[2J"
+	assertLines(t, []string{expected}, v.render(80, 1))
+}
+
+func TestDecodeKeys(t *testing.T) {
+	keys := decodeKeys([]byte("a\x1b[A\x1b[6~\x1b\r\x7fö\x03"))
+	expected := []key{{r: 'a'}, {special: keyUp}, {special: keyPageDown},
+		{special: keyEscape}, {special: keyEnter}, {special: keyBackspace},
+		{r: 'ö'}, {special: keyCtrlC}}
+
+	if len(keys) != len(expected) {
+		t.Errorf("Expected keys %v but got %v", expected, keys)
+		return
+	}
+	for i := range expected {
+		if keys[i] != expected[i] {
+			t.Errorf("Expected key %v at %d but got %v", expected[i], i, keys[i])
+		}
+	}
+}
+
+func assertLines(t *testing.T, expected, lines []string) {
+	t.Helper()
+	if len(expected) != len(lines) {
+		t.Errorf("Expected lines %q but got %q", expected, lines)
+		return
+	}
+	for i := range expected {
+		if expected[i] != lines[i] {
+			t.Errorf("Expected line %q at %d but got %q", expected[i], i, lines[i])
+		}
+	}
+}
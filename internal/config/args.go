@@ -5,9 +5,11 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mimecast/dtail/internal/lcontext"
 	"github.com/mimecast/dtail/internal/omode"
+	"github.com/mimecast/dtail/internal/protocol"
 
 	gossh "golang.org/x/crypto/ssh"
 )
@@ -16,14 +18,18 @@ import (
 type Args struct {
 	lcontext.LContext
 	Arguments             []string
+	Compress              bool
 	ConfigFile            string
 	ConnectionsPerCPU     int
 	Discovery             string
 	LogDir                string
+	LogFormat             string
 	Logger                string
 	LogLevel              string
+	MetricsBindAddress    string
 	Mode                  omode.Mode
 	NoColor               bool
+	Output                string
 	QueryStr              string
 	Quiet                 bool
 	RegexInvert           bool
@@ -36,8 +42,13 @@ type Args struct {
 	Serverless            bool
 	ServersStr            string
 	Plain                 bool
+	Since                 time.Time
+	SinceStr              string
 	Timeout               int
 	TrustAllHosts         bool
+	TUI                   bool
+	Until                 time.Time
+	UntilStr              string
 	UserName              string
 	What                  string
 }
@@ -48,14 +59,18 @@ func (a *Args) String() string {
 	sb.WriteString("Args(")
 
 	sb.WriteString(fmt.Sprintf("%s:%v,", "Arguments", a.Arguments))
+	sb.WriteString(fmt.Sprintf("%s:%v,", "Compress", a.Compress))
 	sb.WriteString(fmt.Sprintf("%s:%v,", "ConfigFile", a.ConfigFile))
 	sb.WriteString(fmt.Sprintf("%s:%v,", "ConnectionsPerCPU", a.ConnectionsPerCPU))
 	sb.WriteString(fmt.Sprintf("%s:%v,", "Discovery", a.Discovery))
 	sb.WriteString(fmt.Sprintf("%s:%v,", "LogDir", a.LogDir))
+	sb.WriteString(fmt.Sprintf("%s:%v,", "LogFormat", a.LogFormat))
 	sb.WriteString(fmt.Sprintf("%s:%v,", "LogLevel", a.LogLevel))
 	sb.WriteString(fmt.Sprintf("%s:%v,", "Logger", a.Logger))
+	sb.WriteString(fmt.Sprintf("%s:%v,", "MetricsBindAddress", a.MetricsBindAddress))
 	sb.WriteString(fmt.Sprintf("%s:%v,", "Mode", a.Mode))
 	sb.WriteString(fmt.Sprintf("%s:%v,", "NoColor", a.NoColor))
+	sb.WriteString(fmt.Sprintf("%s:%v,", "Output", a.Output))
 	sb.WriteString(fmt.Sprintf("%s:%v,", "QueryStr", a.QueryStr))
 	sb.WriteString(fmt.Sprintf("%s:%v,", "Quiet", a.Quiet))
 	sb.WriteString(fmt.Sprintf("%s:%v,", "RegexInvert", a.RegexInvert))
@@ -68,8 +83,11 @@ func (a *Args) String() string {
 	sb.WriteString(fmt.Sprintf("%s:%v,", "Serverless", a.Serverless))
 	sb.WriteString(fmt.Sprintf("%s:%v,", "ServersStr", a.ServersStr))
 	sb.WriteString(fmt.Sprintf("%s:%v,", "Plain", a.Plain))
+	sb.WriteString(fmt.Sprintf("%s:%v,", "TUI", a.TUI))
+	sb.WriteString(fmt.Sprintf("%s:%v,", "Since", a.Since))
 	sb.WriteString(fmt.Sprintf("%s:%v,", "Timeout", a.Timeout))
 	sb.WriteString(fmt.Sprintf("%s:%v,", "TrustAllHosts", a.TrustAllHosts))
+	sb.WriteString(fmt.Sprintf("%s:%v,", "Until", a.Until))
 	sb.WriteString(fmt.Sprintf("%s:%v,", "UserName", a.UserName))
 	sb.WriteString(fmt.Sprintf("%s:%v", "What", a.What))
 	sb.WriteString(")")
@@ -90,6 +108,9 @@ func (a *Args) SerializeOptions() string {
 	if a.Serverless {
 		options["serverless"] = fmt.Sprintf("%v", a.Serverless)
 	}
+	if a.Compress {
+		options["compress"] = protocol.CompressionZstd
+	}
 	if a.LContext.MaxCount != 0 {
 		options["max"] = fmt.Sprintf("%d", a.LContext.MaxCount)
 	}
@@ -99,6 +120,13 @@ func (a *Args) SerializeOptions() string {
 	if a.LContext.AfterContext != 0 {
 		options["after"] = fmt.Sprintf("%d", a.LContext.AfterContext)
 	}
+	// Unix epoch seconds, the server may run in another time zone.
+	if !a.Since.IsZero() {
+		options["since"] = fmt.Sprintf("%d", a.Since.Unix())
+	}
+	if !a.Until.IsZero() {
+		options["until"] = fmt.Sprintf("%d", a.Until.Unix())
+	}
 
 	var sb strings.Builder
 	var i int
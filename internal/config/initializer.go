@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/mimecast/dtail/internal/source"
 )
@@ -122,9 +123,14 @@ func (in *initializer) setupConfig(sourceCb transformCb, args *Args,
 	if err := sourceCb(in, args, additionalArgs); err != nil {
 		return err
 	}
-	if args.Plain {
+	// Machine readable mapreduce output must not be mixed up with colors and
+	// other client messages either.
+	if args.Plain || (args.Output != "" && !strings.EqualFold(args.Output, "table")) {
 		setupPlainMode(in, args)
 	}
+	if args.TUI {
+		setupTUIMode(in)
+	}
 	if args.What == "" {
 		setupAdditionalArgs(in, args)
 	}
@@ -154,6 +160,14 @@ func setupPlainMode(in *initializer, args *Args) {
 	}
 }
 
+// Log messages would mess up the full-screen TUI, so log to the file only.
+func setupTUIMode(in *initializer) {
+	switch strings.ToLower(in.Common.Logger) {
+	case "stdout", "fout":
+		in.Common.Logger = "file"
+	}
+}
+
 func setupAdditionalArgs(in *initializer, args *Args) {
 	// Interpret additional args as file list or as query.
 	if args.What == "" {
@@ -179,13 +193,16 @@ func transformClient(in *initializer, args *Args, additionalArgs []string) error
 			in.Common.LogLevel = "warn"
 		}
 	}
-	return nil
+	return setupTimeRange(args, time.Now())
 }
 
 func transformServer(in *initializer, args *Args, additionalArgs []string) error {
 	if args.SSHBindAddress != "" {
 		in.Server.SSHBindAddress = args.SSHBindAddress
 	}
+	if args.MetricsBindAddress != "" {
+		in.Server.MetricsBindAddress = args.MetricsBindAddress
+	}
 	return nil
 }
 
@@ -13,6 +13,30 @@ type Permissions struct {
 	Users map[string][]string
 }
 
+// RateLimit limits how fast a user may read log files. It's shared by all
+// files the user reads concurrently, also over multiple sessions. Zero means
+// unlimited.
+type RateLimit struct {
+	// The max amount of lines read per second.
+	LinesPerSecond int `json:",omitempty"`
+	// The max amount of bytes read per second.
+	BytesPerSecond int `json:",omitempty"`
+	// The max busy time reading and filtering the lines, in percent of the
+	// elapsed time. It's the wall-clock time including waiting for the disk
+	// (but not for the client), summed up over all files read concurrently.
+	// E.g. reading two files at full speed is busy 200% of the time.
+	BusyPercent int `json:",omitempty"`
+}
+
+// RateLimits map. Like the permissions, each SSH user may have its own rate
+// limit, otherwise the default applies.
+type RateLimits struct {
+	// The default user rate limit.
+	Default RateLimit
+	// The per user special rate limits.
+	Users map[string]RateLimit `json:",omitempty"`
+}
+
 // JobCommons summarises common job fields
 type jobCommons struct {
 	Name      string
@@ -35,12 +59,38 @@ type Scheduled struct {
 type Continuous struct {
 	jobCommons
 	RestartOnDayChange bool `json:",omitempty"`
+	// Publish the result of every interval as gauges on the metrics endpoint
+	// of the server (see MetricsBindAddress). The outfile is optional then.
+	Metrics bool `json:",omitempty"`
+}
+
+// LogFormat allows to configure a mapreduce log format without recompiling
+// DTail. It can be referenced by name in a query, e.g. 'logformat NAME'.
+type LogFormat struct {
+	// The name of the log format.
+	Name string
+	// The delimiter of the fields of a log line, splits at whitespaces if empty.
+	FieldDelimiter string `json:",omitempty"`
+	// The separator of key and value of a field, e.g. "=" for "key=value".
+	KVSeparator string `json:",omitempty"`
+	// The names of the positional fields of a log line, "" or "-" skips a field.
+	Fields []string `json:",omitempty"`
+	// Optional regex, all named capture groups become fields. This is used
+	// instead of FieldDelimiter, KVSeparator and Fields.
+	Regex string `json:",omitempty"`
+	// Optional Go time layout of the timestamp field, e.g. "2006-01-02T15:04:05Z07:00".
+	TimeLayout string `json:",omitempty"`
+	// The name of the timestamp field, "time" if empty.
+	TimeField string `json:",omitempty"`
 }
 
 // ServerConfig represents the server configuration.
 type ServerConfig struct {
 	// The SSH server bind port.
 	SSHBindAddress string
+	// The address of the HTTP listener serving the server metrics in the
+	// Prometheus text format, e.g. "localhost:9100". Disabled if empty.
+	MetricsBindAddress string `json:",omitempty"`
 	// The max amount of concurrent user connection allowed to connect to the server.
 	MaxConnections int
 	// The max amount of concurrent cats per server.
@@ -51,8 +101,12 @@ type ServerConfig struct {
 	MaxLineLength int
 	// The user permissions.
 	Permissions Permissions `json:",omitempty"`
+	// The user rate limits.
+	RateLimits RateLimits `json:",omitempty"`
 	// The mapr log format
 	MapreduceLogFormat string `json:",omitempty"`
+	// Additional mapr log formats.
+	LogFormats []LogFormat `json:",omitempty"`
 	// The default path of the server host key
 	HostKeyFile string
 	// The host key size in bits
@@ -99,3 +153,11 @@ func ServerUserPermissions(userName string) (permissions []string, err error) {
 	}
 	return
 }
+
+// ServerUserRateLimit retrieves the rate limit of a given user.
+func ServerUserRateLimit(userName string) RateLimit {
+	if limit, ok := Server.RateLimits.Users[userName]; ok {
+		return limit
+	}
+	return Server.RateLimits.Default
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// The absolute time layouts accepted by -since and -until.
+var timeRangeLayouts = [...]string{
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"20060102-150405", // DTail default log format
+}
+
+// The layouts accepted by -since and -until for a time of the current day.
+var timeRangeClockLayouts = [...]string{"15:04:05", "15:04"}
+
+func setupTimeRange(args *Args, now time.Time) error {
+	var err error
+	if args.SinceStr != "" {
+		if args.Since, err = parseTimeRangeArg(args.SinceStr, now); err != nil {
+			return fmt.Errorf("Invalid -since argument: %w", err)
+		}
+	}
+	if args.UntilStr != "" {
+		if args.Until, err = parseTimeRangeArg(args.UntilStr, now); err != nil {
+			return fmt.Errorf("Invalid -until argument: %w", err)
+		}
+	}
+	if !args.Since.IsZero() && !args.Until.IsZero() && args.Until.Before(args.Since) {
+		return fmt.Errorf("The -until time %v is before the -since time %v",
+			args.Until, args.Since)
+	}
+	return nil
+}
+
+// Parse a -since or -until argument. It's either a duration relative to now
+// (e.g. "15m" for 15 minutes ago), a time of the current day (e.g. "10:00"),
+// an absolute time (e.g. "2023-01-30 10:00") or Unix epoch seconds.
+func parseTimeRangeArg(str string, now time.Time) (time.Time, error) {
+	if duration, err := time.ParseDuration(str); err == nil {
+		if duration < 0 {
+			duration = -duration
+		}
+		return now.Add(-duration), nil
+	}
+	if epoch, err := strconv.ParseInt(str, 10, 64); err == nil {
+		return time.Unix(epoch, 0), nil
+	}
+
+	for _, layout := range timeRangeClockLayouts {
+		t, err := time.ParseInLocation(layout, str, now.Location())
+		if err != nil {
+			continue
+		}
+		return time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(),
+			t.Second(), 0, now.Location()), nil
+	}
+	for _, layout := range timeRangeLayouts {
+		if t, err := time.ParseInLocation(layout, str, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("Unable to parse time '%s'", str)
+}
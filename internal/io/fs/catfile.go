@@ -1,12 +1,16 @@
 package fs
 
+import "github.com/mimecast/dtail/internal/ratelimit"
+
 // CatFile is for reading a whole file.
 type CatFile struct {
 	readFile
 }
 
 // NewCatFile returns a new file catter.
-func NewCatFile(filePath string, globID string, serverMessages chan<- string) CatFile {
+func NewCatFile(filePath string, globID string, serverMessages chan<- string,
+	timeRange TimeRange, limiter *ratelimit.Limiter) CatFile {
+
 	return CatFile{
 		readFile: readFile{
 			filePath:       filePath,
@@ -15,6 +19,8 @@ func NewCatFile(filePath string, globID string, serverMessages chan<- string) Ca
 			retry:          false,
 			canSkipLines:   false,
 			seekEOF:        false,
+			timeRange:      timeRange,
+			limiter:        limiter,
 		},
 	}
 }
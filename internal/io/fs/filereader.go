@@ -12,7 +12,7 @@ import (
 // a file.
 type FileReader interface {
 	Start(ctx context.Context, ltx lcontext.LContext, lines chan<- *line.Line,
-		re regex.Regex) error
+		re *regex.Updatable) error
 	FilePath() string
 	Retry() bool
 }
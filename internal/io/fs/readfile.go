@@ -18,6 +18,8 @@ import (
 	"github.com/mimecast/dtail/internal/io/line"
 	"github.com/mimecast/dtail/internal/io/pool"
 	"github.com/mimecast/dtail/internal/lcontext"
+	"github.com/mimecast/dtail/internal/metrics"
+	"github.com/mimecast/dtail/internal/ratelimit"
 	"github.com/mimecast/dtail/internal/regex"
 
 	"github.com/DataDog/zstd"
@@ -49,17 +51,27 @@ type readFile struct {
 	seekEOF bool
 	// Warned already about a long line.
 	warnedAboutLongLine bool
+	// Only read the log lines within this time range.
+	timeRange TimeRange
+	// Throttles reading to the rate limit of the user, nil if unlimited.
+	limiter *ratelimit.Limiter
+	// Since when reading is busy (for the rate limit).
+	busySince time.Time
+	// Warned already about throttling.
+	warnedAboutThrottling bool
 }
 
 // String returns the string representation of the readFile
 func (f readFile) String() string {
 	return fmt.Sprintf(
-		"readFile(filePath:%s,globID:%s,retry:%v,canSkipLines:%v,seekEOF:%v)",
+		"readFile(filePath:%s,globID:%s,retry:%v,canSkipLines:%v,seekEOF:%v,timeRange:%v,limiter:%v)",
 		f.filePath,
 		f.globID,
 		f.retry,
 		f.canSkipLines,
-		f.seekEOF)
+		f.seekEOF,
+		f.timeRange,
+		f.limiter)
 }
 
 // FilePath returns the full file path.
@@ -74,7 +86,7 @@ func (f readFile) Retry() bool {
 
 // Start tailing a log file.
 func (f readFile) Start(ctx context.Context, ltx lcontext.LContext,
-	lines chan<- *line.Line, re regex.Regex) error {
+	lines chan<- *line.Line, re *regex.Updatable) error {
 
 	reader, fd, err := f.makeReader()
 	if fd != nil {
@@ -91,9 +103,14 @@ func (f readFile) Start(ctx context.Context, ltx lcontext.LContext,
 	var filterWg sync.WaitGroup
 	filterWg.Add(1)
 
+	var filterLines <-chan *bytes.Buffer = rawLines
+	if !f.timeRange.IsZero() {
+		filterLines = f.filterTimeRange(readCtx, rawLines)
+	}
+
 	go f.periodicTruncateCheck(ctx, truncate)
 	go func() {
-		f.filter(ctx, ltx, rawLines, lines, re)
+		f.filter(ctx, ltx, filterLines, lines, re)
 		filterWg.Done()
 		// If the filter stopped, make the reader stop too, no need to read
 		// more data if there is nothing more the filter wants to filter for!
@@ -125,6 +142,10 @@ func (f *readFile) makeFileReader() (reader *bufio.Reader, fd *os.File, err erro
 		if _, err = fd.Seek(0, io.SeekEnd); err != nil {
 			return
 		}
+	} else if !f.timeRange.IsZero() && !f.timeRange.Since.IsZero() && !f.isCompressed() {
+		if err = f.seekSince(fd); err != nil {
+			return
+		}
 	}
 
 	reader, err = f.makeCompressedFileReader(fd)
@@ -149,6 +170,15 @@ func (f *readFile) periodicTruncateCheck(ctx context.Context, truncate chan stru
 	}
 }
 
+func (f *readFile) isCompressed() bool {
+	for _, suffix := range []string{".gz", ".gzip", ".zst"} {
+		if strings.HasSuffix(f.FilePath(), suffix) {
+			return true
+		}
+	}
+	return false
+}
+
 func (f *readFile) makeCompressedFileReader(fd *os.File) (reader *bufio.Reader, err error) {
 	switch {
 	case strings.HasSuffix(f.FilePath(), ".gz"):
@@ -175,6 +205,7 @@ func (f *readFile) read(ctx context.Context, fd *os.File, reader *bufio.Reader,
 
 	var offset uint64
 	message := pool.BytesBuffer.Get().(*bytes.Buffer)
+	f.resetBusy()
 
 	for {
 		b, err := reader.ReadByte()
@@ -184,6 +215,7 @@ func (f *readFile) read(ctx context.Context, fd *os.File, reader *bufio.Reader,
 				return err
 			}
 			time.Sleep(time.Millisecond * 100)
+			f.resetBusy()
 			continue
 		}
 
@@ -200,7 +232,7 @@ func (f *readFile) read(ctx context.Context, fd *os.File, reader *bufio.Reader,
 
 // Filter log lines matching a given regular expression.
 func (f *readFile) filter(ctx context.Context, ltx lcontext.LContext,
-	rawLines <-chan *bytes.Buffer, lines chan<- *line.Line, re regex.Regex) {
+	rawLines <-chan *bytes.Buffer, lines chan<- *line.Line, re *regex.Updatable) {
 
 	// Do we have any kind of local context settings? If so then run the more complex
 	// filterWithLContext method.
@@ -216,18 +248,21 @@ func (f *readFile) filter(ctx context.Context, ltx lcontext.LContext,
 }
 
 func (f *readFile) transmittable(rawLine *bytes.Buffer, length, capacity int,
-	re regex.Regex) (*line.Line, bool) {
+	re *regex.Updatable) (*line.Line, bool) {
 
 	newLine := line.Null()
-	if !re.Match(rawLine.Bytes()) {
+	if !f.match(rawLine, re) {
+		metrics.LinesNotMatched.Inc()
 		f.updateLineNotMatched()
 		f.updateLineNotTransmitted()
 		return newLine, false
 	}
+	metrics.LinesMatched.Inc()
 	f.updateLineMatched()
 
 	// Can we actually send more messages, channel capacity reached?
 	if f.canSkipLines && length >= capacity {
+		metrics.LinesDropped.Inc()
 		f.updateLineNotTransmitted()
 		return newLine, false
 	}
@@ -289,6 +324,7 @@ func (f *readFile) handleReadError(ctx context.Context, err error, fd *os.File,
 	if !f.seekEOF {
 		dlog.Common.Info(f.FilePath(), "End of file reached")
 		if len(message.Bytes()) > 0 {
+			countRead(message)
 			select {
 			case rawLines <- message:
 			case <-ctx.Done():
@@ -306,10 +342,15 @@ func (f *readFile) handleReadByte(ctx context.Context, b byte,
 
 	switch b {
 	case '\n':
+		countRead(message)
+		if !f.throttle(ctx, message) {
+			return abortReading, message
+		}
 		select {
 		case rawLines <- message:
 			message = pool.BytesBuffer.Get().(*bytes.Buffer)
 			f.warnedAboutLongLine = false
+			f.resetBusy()
 		case <-ctx.Done():
 			return abortReading, message
 		}
@@ -320,10 +361,15 @@ func (f *readFile) handleReadByte(ctx context.Context, b byte,
 					"Long log line, splitting into multiple lines") + "\n"
 				f.warnedAboutLongLine = true
 			}
+			countRead(message)
 			message.WriteByte('\n')
+			if !f.throttle(ctx, message) {
+				return abortReading, message
+			}
 			select {
 			case rawLines <- message:
 				message = pool.BytesBuffer.Get().(*bytes.Buffer)
+				f.resetBusy()
 			case <-ctx.Done():
 				return abortReading, message
 			}
@@ -332,3 +378,49 @@ func (f *readFile) handleReadByte(ctx context.Context, b byte,
 
 	return nothing, message
 }
+
+// Match the line against the regex. The time it takes counts towards the busy
+// time of the rate limit of the user.
+func (f *readFile) match(rawLine *bytes.Buffer, re *regex.Updatable) bool {
+	if f.limiter == nil {
+		return re.Match(rawLine.Bytes())
+	}
+	start := time.Now()
+	matched := re.Match(rawLine.Bytes())
+	f.limiter.Busy(time.Since(start))
+	return matched
+}
+
+// Throttle reading the line to the rate limit of the user. The client is told
+// the first time. Returns false if reading was cancelled meanwhile.
+func (f *readFile) throttle(ctx context.Context, message *bytes.Buffer) bool {
+	if f.limiter == nil {
+		return true
+	}
+	f.limiter.Busy(time.Since(f.busySince))
+
+	waited, err := f.limiter.Wait(ctx, message.Len())
+	if waited > 0 && !f.warnedAboutThrottling {
+		f.warnedAboutThrottling = true
+		select {
+		case f.serverMessages <- dlog.Common.Warn(f.filePath,
+			"Reading throttled by the rate limit of the user", f.limiter) + "\n":
+		case <-ctx.Done():
+		}
+	}
+	return err == nil
+}
+
+// Start measuring the busy time for the rate limit again, e.g. after waiting
+// for the client to take the line or for the file to grow.
+func (f *readFile) resetBusy() {
+	if f.limiter != nil {
+		f.busySince = time.Now()
+	}
+}
+
+// Update the server metrics with a line read from the fd.
+func countRead(message *bytes.Buffer) {
+	metrics.LinesRead.Inc()
+	metrics.BytesRead.Add(uint64(message.Len()))
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/mimecast/dtail/internal/io/line"
 	"github.com/mimecast/dtail/internal/io/pool"
 	"github.com/mimecast/dtail/internal/lcontext"
+	"github.com/mimecast/dtail/internal/metrics"
 	"github.com/mimecast/dtail/internal/regex"
 )
 
@@ -29,7 +30,7 @@ type ltxState struct {
 
 // We don't have any local grep context, which makes life much simpler and more efficient.
 func (f *readFile) filterWithoutLContext(ctx context.Context, rawLines <-chan *bytes.Buffer,
-	lines chan<- *line.Line, re regex.Regex) {
+	lines chan<- *line.Line, re *regex.Updatable) {
 
 	for rawLine := range rawLines {
 		f.updatePosition()
@@ -46,7 +47,7 @@ func (f *readFile) filterWithoutLContext(ctx context.Context, rawLines <-chan *b
 
 // Filter log lines matching a given regular expression, however with local grep context.
 func (f *readFile) filterWithLContext(ctx context.Context, ltx lcontext.LContext,
-	rawLines <-chan *bytes.Buffer, lines chan<- *line.Line, re regex.Regex) {
+	rawLines <-chan *bytes.Buffer, lines chan<- *line.Line, re *regex.Updatable) {
 
 	var ls ltxState
 
@@ -71,7 +72,7 @@ func (f *readFile) filterWithLContext(ctx context.Context, ltx lcontext.LContext
 	// No go through all raw lines read to determine with they satisfy the local
 	// context or not. "Matching" lines will be sent to the lines channel.
 	for rawLine := range rawLines {
-		status := f.filterLineWithLContext(ctx, &ltx, &ls, rawLines, lines, &re, rawLine)
+		status := f.filterLineWithLContext(ctx, &ltx, &ls, rawLines, lines, re, rawLine)
 		switch status {
 		case abortReading:
 			return
@@ -82,12 +83,13 @@ func (f *readFile) filterWithLContext(ctx context.Context, ltx lcontext.LContext
 
 // Filter log lines matching a given regular expression, however with local grep context.
 func (f *readFile) filterLineWithLContext(ctx context.Context, ltx *lcontext.LContext,
-	ls *ltxState, rawLines <-chan *bytes.Buffer, lines chan<- *line.Line, re *regex.Regex,
+	ls *ltxState, rawLines <-chan *bytes.Buffer, lines chan<- *line.Line, re *regex.Updatable,
 	rawLine *bytes.Buffer) readStatus {
 
 	f.updatePosition()
 
-	if !re.Match(rawLine.Bytes()) {
+	if !f.match(rawLine, re) {
+		metrics.LinesNotMatched.Inc()
 		f.updateLineNotMatched()
 		status := f.lContextNotMatched(ctx, ls, lines, rawLine)
 		switch status {
@@ -97,6 +99,7 @@ func (f *readFile) filterLineWithLContext(ctx context.Context, ltx *lcontext.LCo
 		}
 	}
 
+	metrics.LinesMatched.Inc()
 	f.updateLineMatched()
 
 	// If we have an "after" context to worry about...
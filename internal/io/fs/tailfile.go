@@ -1,12 +1,16 @@
 package fs
 
+import "github.com/mimecast/dtail/internal/ratelimit"
+
 // TailFile is to tail and filter a log file.
 type TailFile struct {
 	readFile
 }
 
 // NewTailFile returns a new file tailer.
-func NewTailFile(filePath string, globID string, serverMessages chan<- string) TailFile {
+func NewTailFile(filePath string, globID string, serverMessages chan<- string,
+	timeRange TimeRange, limiter *ratelimit.Limiter) TailFile {
+
 	return TailFile{
 		readFile: readFile{
 			filePath:       filePath,
@@ -15,6 +19,8 @@ func NewTailFile(filePath string, globID string, serverMessages chan<- string) T
 			retry:          true,
 			canSkipLines:   true,
 			seekEOF:        true,
+			timeRange:      timeRange,
+			limiter:        limiter,
 		},
 	}
 }
@@ -0,0 +1,157 @@
+package fs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mimecast/dtail/internal/io/pool"
+)
+
+// Below this distance the binary search stops and the remaining bytes are
+// read sequentially.
+const seekSinceMinDistance int64 = 64 * 1024
+
+// TimeRange limits reading a file to the log lines within a time range.
+type TimeRange struct {
+	// Since is the (inclusive) start of the time range, may be zero.
+	Since time.Time
+	// Until is the (inclusive) end of the time range, may be zero.
+	Until time.Time
+	// Timestamp extracts the time of a log line, false if the line has none.
+	Timestamp func(line string) (time.Time, bool)
+}
+
+// String returns the string representation of the time range.
+func (tr TimeRange) String() string {
+	return fmt.Sprintf("TimeRange(Since:%v,Until:%v)", tr.Since, tr.Until)
+}
+
+// IsZero returns true if the time range doesn't limit anything.
+func (tr TimeRange) IsZero() bool {
+	return tr.Timestamp == nil || (tr.Since.IsZero() && tr.Until.IsZero())
+}
+
+func (tr TimeRange) before(t time.Time) bool {
+	return !tr.Since.IsZero() && t.Before(tr.Since)
+}
+
+func (tr TimeRange) after(t time.Time) bool {
+	return !tr.Until.IsZero() && t.After(tr.Until)
+}
+
+func (tr TimeRange) timestamp(rawLine []byte) (time.Time, bool) {
+	return tr.Timestamp(strings.TrimRight(string(rawLine), "\r\n"))
+}
+
+// Drop all lines outside of the time range. Lines without a timestamp (e.g.
+// stack traces) belong to the last line with a timestamp. Log files are
+// expected to be in chronological order, so when not tailing, reading stops
+// at the first line after the end of the time range.
+func (f *readFile) filterTimeRange(ctx context.Context,
+	rawLines <-chan *bytes.Buffer) <-chan *bytes.Buffer {
+
+	inRangeLines := make(chan *bytes.Buffer, cap(rawLines))
+
+	go func() {
+		defer close(inRangeLines)
+		var inRange bool
+
+		for rawLine := range rawLines {
+			if t, ok := f.timeRange.timestamp(rawLine.Bytes()); ok {
+				if f.timeRange.after(t) && !f.seekEOF {
+					pool.RecycleBytesBuffer(rawLine)
+					return
+				}
+				inRange = !f.timeRange.before(t) && !f.timeRange.after(t)
+			}
+			if !inRange {
+				pool.RecycleBytesBuffer(rawLine)
+				continue
+			}
+			select {
+			case inRangeLines <- rawLine:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return inRangeLines
+}
+
+// Binary search the offset of the log lines at the start of the time range,
+// so that huge files don't have to be read from the beginning. This relies on
+// the file being in chronological order. Lines before the time range are still
+// dropped by the filter if that's not the case.
+func (f *readFile) seekSince(fd *os.File) error {
+	info, err := fd.Stat()
+	if err != nil {
+		return err
+	}
+
+	var low int64
+	high := info.Size()
+	for high-low > seekSinceMinDistance {
+		middle := low + (high-low)/2
+		t, ok, err := f.firstTimestamp(fd, middle)
+		if err != nil {
+			return err
+		}
+		if ok && t.Before(f.timeRange.Since) {
+			low = middle
+			continue
+		}
+		high = middle
+	}
+
+	offset, err := lineStart(fd, low)
+	if err != nil {
+		return err
+	}
+	_, err = fd.Seek(offset, io.SeekStart)
+	return err
+}
+
+// Returns the first timestamp of the lines starting at or after offset.
+func (f *readFile) firstTimestamp(fd *os.File, offset int64) (time.Time, bool, error) {
+	start, err := lineStart(fd, offset)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	reader := bufio.NewReader(io.NewSectionReader(fd, start, seekSinceMinDistance))
+
+	for {
+		rawLine, err := reader.ReadBytes('\n')
+		if err == nil || (err == io.EOF && len(rawLine) > 0) {
+			if t, ok := f.timeRange.timestamp(rawLine); ok {
+				return t, true, nil
+			}
+		}
+		if err == io.EOF {
+			return time.Time{}, false, nil
+		}
+		if err != nil {
+			return time.Time{}, false, err
+		}
+	}
+}
+
+// Returns the offset of the first line starting at or after offset.
+func lineStart(fd *os.File, offset int64) (int64, error) {
+	if offset == 0 {
+		return 0, nil
+	}
+	// The previous byte tells whether offset is already at a line start.
+	reader := bufio.NewReader(io.NewSectionReader(fd, offset-1, 1<<62))
+	skipped, err := reader.ReadBytes('\n')
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	return offset - 1 + int64(len(skipped)), nil
+}
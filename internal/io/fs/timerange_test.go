@@ -0,0 +1,97 @@
+package fs
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const timeRangeTestLayout string = "2006-01-02 15:04:05"
+
+func timeRangeTestTimestamp(line string) (time.Time, bool) {
+	if len(line) < len(timeRangeTestLayout) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(timeRangeTestLayout, line[0:len(timeRangeTestLayout)])
+	return t, err == nil
+}
+
+func TestSeekSince(t *testing.T) {
+	start := time.Date(2023, 1, 30, 0, 0, 0, 0, time.UTC)
+	since := start.Add(10 * time.Hour)
+
+	var buf bytes.Buffer
+	var expectedOffset int
+	for i := 0; i < 24*3600; i++ {
+		lineTime := start.Add(time.Duration(i) * time.Second)
+		if lineTime.Equal(since) {
+			expectedOffset = buf.Len()
+		}
+		fmt.Fprintf(&buf, "%s INFO Log line %d\n", lineTime.Format(timeRangeTestLayout), i)
+		if i%100 == 0 {
+			// A line without any timestamp, e.g. a stack trace.
+			buf.WriteString("\tat com.example.Foo(Foo.java:42)\n")
+		}
+	}
+
+	filePath := filepath.Join(t.TempDir(), "timerange.log")
+	if err := os.WriteFile(filePath, buf.Bytes(), 0600); err != nil {
+		t.Fatalf("Unable to write test file: %s", err.Error())
+	}
+	fd, err := os.Open(filePath)
+	if err != nil {
+		t.Fatalf("Unable to open test file: %s", err.Error())
+	}
+	defer fd.Close()
+
+	f := readFile{timeRange: TimeRange{Since: since, Timestamp: timeRangeTestTimestamp}}
+	if err := f.seekSince(fd); err != nil {
+		t.Errorf("Unable to seek since %v: %s", since, err.Error())
+	}
+	offset, _ := fd.Seek(0, io.SeekCurrent)
+	if offset > int64(expectedOffset) || offset < int64(expectedOffset)-2*seekSinceMinDistance {
+		t.Errorf("Expected offset shortly before %d but got %d", expectedOffset, offset)
+	}
+	if offset > 0 && buf.Bytes()[offset-1] != '\n' {
+		t.Errorf("Expected offset %d to be at the start of a line", offset)
+	}
+}
+
+func TestFilterTimeRange(t *testing.T) {
+	start := time.Date(2023, 1, 30, 10, 0, 0, 0, time.UTC)
+	f := readFile{timeRange: TimeRange{
+		Since:     start.Add(time.Minute),
+		Until:     start.Add(2 * time.Minute),
+		Timestamp: timeRangeTestTimestamp,
+	}}
+
+	rawLines := make(chan *bytes.Buffer, 20)
+	go func() {
+		defer close(rawLines)
+		for i := 0; i < 10; i++ {
+			lineTime := start.Add(time.Duration(i) * 30 * time.Second)
+			rawLines <- bytes.NewBufferString(lineTime.Format(timeRangeTestLayout) + "\n")
+			rawLines <- bytes.NewBufferString("\tcontinued\n")
+		}
+	}()
+
+	var got []string
+	for rawLine := range f.filterTimeRange(context.Background(), rawLines) {
+		got = append(got, strings.TrimSpace(rawLine.String()))
+	}
+
+	expected := []string{
+		"2023-01-30 10:01:00", "continued",
+		"2023-01-30 10:01:30", "continued",
+		"2023-01-30 10:02:00", "continued",
+	}
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected lines %v but got %v", expected, got)
+	}
+}
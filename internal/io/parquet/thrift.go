@@ -0,0 +1,91 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// The Thrift compact protocol types used by the Parquet metadata.
+const (
+	compactI32    byte = 5
+	compactI64    byte = 6
+	compactBinary byte = 8
+	compactList   byte = 9
+	compactStruct byte = 12
+)
+
+// A minimal Thrift compact protocol encoder, it only supports what's required
+// to write the Parquet page headers and the file metadata.
+type compactWriter struct {
+	bytes.Buffer
+	lastFieldID  int16
+	lastFieldIDs []int16
+}
+
+func (w *compactWriter) varint(v uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(buf[:], v)
+	w.Write(buf[:n])
+}
+
+func (w *compactWriter) zigzag(v int64) {
+	w.varint(uint64((v << 1) ^ (v >> 63)))
+}
+
+func (w *compactWriter) fieldHeader(id int16, fieldType byte) {
+	if delta := id - w.lastFieldID; delta > 0 && delta <= 15 {
+		w.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		w.WriteByte(fieldType)
+		w.zigzag(int64(id))
+	}
+	w.lastFieldID = id
+}
+
+func (w *compactWriter) structBegin() {
+	w.lastFieldIDs = append(w.lastFieldIDs, w.lastFieldID)
+	w.lastFieldID = 0
+}
+
+func (w *compactWriter) structEnd() {
+	w.WriteByte(0)
+	w.lastFieldID = w.lastFieldIDs[len(w.lastFieldIDs)-1]
+	w.lastFieldIDs = w.lastFieldIDs[:len(w.lastFieldIDs)-1]
+}
+
+func (w *compactWriter) i32(id int16, v int32) {
+	w.fieldHeader(id, compactI32)
+	w.zigzag(int64(v))
+}
+
+func (w *compactWriter) i64(id int16, v int64) {
+	w.fieldHeader(id, compactI64)
+	w.zigzag(v)
+}
+
+func (w *compactWriter) binary(id int16, v string) {
+	w.fieldHeader(id, compactBinary)
+	w.binaryElement(v)
+}
+
+func (w *compactWriter) binaryElement(v string) {
+	w.varint(uint64(len(v)))
+	w.WriteString(v)
+}
+
+func (w *compactWriter) structField(id int16) {
+	w.fieldHeader(id, compactStruct)
+	w.structBegin()
+}
+
+// The list elements are written without field headers, e.g. with zigzag (for
+// i32 elements) or with structBegin and structEnd (for struct elements).
+func (w *compactWriter) listField(id int16, elementType byte, size int) {
+	w.fieldHeader(id, compactList)
+	if size < 15 {
+		w.WriteByte(byte(size)<<4 | elementType)
+		return
+	}
+	w.WriteByte(0xf0 | elementType)
+	w.varint(uint64(size))
+}
@@ -0,0 +1,420 @@
+// Package parquet writes Apache Parquet files, so that the results of DTail
+// can be loaded into data tooling without losing the column types. Only what
+// DTail requires is implemented: optional (nullable) double and string columns,
+// one uncompressed page per column chunk and the PLAIN encoding.
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/mimecast/dtail/internal/version"
+)
+
+const magic string = "PAR1"
+
+// The rows are written as a row group once their values reach this size, so
+// that not all rows have to be kept in memory.
+const rowGroupSize int = 64 * 1024 * 1024
+
+var errClosed = errors.New("Parquet file is closed already")
+
+// Type is the type of a column.
+type Type int
+
+// The supported column types.
+const (
+	// String columns are UTF-8 encoded byte arrays.
+	String Type = iota
+	// Double columns are float64 values.
+	Double Type = iota
+)
+
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "string"
+	case Double:
+		return "double"
+	default:
+		return "unknown"
+	}
+}
+
+// The Parquet format enums used by the writer.
+const (
+	physicalTypeDouble    int32 = 5
+	physicalTypeByteArray int32 = 6
+	repetitionOptional    int32 = 1
+	convertedTypeUTF8     int32 = 0
+	encodingPlain         int32 = 0
+	encodingRLE           int32 = 3
+	codecUncompressed     int32 = 0
+	pageTypeData          int32 = 0
+)
+
+// Column of a Parquet file.
+type Column struct {
+	Name string
+	Type Type
+}
+
+// The values of a column in the current row group.
+type columnData struct {
+	Column
+	doubles []float64
+	strings []string
+	defined []bool
+	// The row groups written before the column was added.
+	firstRowGroup int
+	// The written chunks of the column, starting with firstRowGroup.
+	chunks []columnChunk
+}
+
+// Writer writes rows as a Parquet file. The rows are buffered and written as a
+// row group once they reach rowGroupSize, the file is complete once closed.
+type Writer struct {
+	out     countingWriter
+	columns []*columnData
+	index   map[string]int
+	// The number of rows of each written row group.
+	rowGroups []int
+	// The number of rows and the size of the values of the current row group.
+	numRows      int
+	size         int
+	rowGroupSize int
+	// Once writing failed or the file was closed, no rows can be added anymore.
+	err error
+}
+
+// NewWriter returns a new Parquet writer with the given columns, writing the
+// file to out. Further (string) columns are added for unknown fields of the
+// rows.
+func NewWriter(out io.Writer, columns ...Column) *Writer {
+	w := Writer{
+		out:          countingWriter{writer: out},
+		index:        make(map[string]int),
+		rowGroupSize: rowGroupSize,
+	}
+	for _, column := range columns {
+		w.addColumn(column)
+	}
+	return &w
+}
+
+func (w *Writer) addColumn(column Column) *columnData {
+	c := columnData{Column: column, firstRowGroup: len(w.rowGroups)}
+	// The new column is null in all previous rows of the current row group.
+	for i := 0; i < w.numRows; i++ {
+		c.append("", false)
+	}
+	w.index[column.Name] = len(w.columns)
+	w.columns = append(w.columns, &c)
+	return &c
+}
+
+// Appends a value and returns its size.
+func (c *columnData) append(value string, defined bool) int {
+	size := 0
+	switch c.Type {
+	case Double:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			defined = false
+		}
+		c.doubles = append(c.doubles, f)
+		size = 8
+	default:
+		c.strings = append(c.strings, value)
+		size = len(value)
+	}
+	c.defined = append(c.defined, defined)
+	return size
+}
+
+// Drops the values of the written row group, so that they can be freed.
+func (c *columnData) reset() {
+	c.doubles, c.strings, c.defined = nil, nil, nil
+}
+
+// Columns returns all columns of the writer.
+func (w *Writer) Columns() []Column {
+	columns := make([]Column, len(w.columns))
+	for i, c := range w.columns {
+		columns[i] = c.Column
+	}
+	return columns
+}
+
+// NumRows returns the number of rows added so far.
+func (w *Writer) NumRows() int {
+	numRows := w.numRows
+	for _, n := range w.rowGroups {
+		numRows += n
+	}
+	return numRows
+}
+
+// AddRow adds a row. Missing fields are null, and so are the fields of double
+// columns which aren't a number. Unknown fields are added as string columns.
+// It returns an error if writing a row group failed.
+func (w *Writer) AddRow(fields map[string]string) error {
+	if w.err != nil {
+		return w.err
+	}
+	var unknown []string
+	for name := range fields {
+		if _, ok := w.index[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	// Sort, so that the column order doesn't depend on the map order.
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		w.addColumn(Column{Name: name, Type: String})
+	}
+
+	for _, c := range w.columns {
+		value, ok := fields[c.Name]
+		w.size += c.append(value, ok)
+	}
+	w.numRows++
+
+	if w.size >= w.rowGroupSize {
+		w.err = w.writeRowGroup()
+	}
+	return w.err
+}
+
+// Close writes the remaining rows and the file metadata. It doesn't close the
+// underlying writer.
+func (w *Writer) Close() error {
+	if w.err != nil {
+		return w.err
+	}
+	if w.err = w.writeRowGroup(); w.err != nil {
+		return w.err
+	}
+	if w.err = w.writeNullChunks(); w.err != nil {
+		return w.err
+	}
+
+	metadata := w.fileMetadata()
+	if _, w.err = w.out.Write(metadata); w.err != nil {
+		return w.err
+	}
+	if w.err = binary.Write(&w.out, binary.LittleEndian, uint32(len(metadata))); w.err != nil {
+		return w.err
+	}
+	if _, w.err = io.WriteString(&w.out, magic); w.err != nil {
+		return w.err
+	}
+	w.err = errClosed
+	return nil
+}
+
+// Writes the magic bytes at the beginning of the file.
+func (w *Writer) writeMagic() error {
+	if w.out.n > 0 {
+		return nil
+	}
+	_, err := io.WriteString(&w.out, magic)
+	return err
+}
+
+// Writes the buffered rows as a row group, if any.
+func (w *Writer) writeRowGroup() error {
+	if err := w.writeMagic(); err != nil {
+		return err
+	}
+	if w.numRows == 0 {
+		return nil
+	}
+	for _, c := range w.columns {
+		chunk, err := c.writeChunk(&w.out, w.numRows)
+		if err != nil {
+			return err
+		}
+		c.chunks = append(c.chunks, chunk)
+		c.reset()
+	}
+	w.rowGroups = append(w.rowGroups, w.numRows)
+	w.numRows, w.size = 0, 0
+	return nil
+}
+
+// Columns added after the first row groups were written are null in them. As
+// the chunks of a row group don't need to be adjacent, they are written now.
+func (w *Writer) writeNullChunks() error {
+	for _, c := range w.columns {
+		var chunks []columnChunk
+		for _, numRows := range w.rowGroups[:c.firstRowGroup] {
+			nulls := columnData{Column: c.Column, defined: make([]bool, numRows)}
+			chunk, err := nulls.writeChunk(&w.out, numRows)
+			if err != nil {
+				return err
+			}
+			chunks = append(chunks, chunk)
+		}
+		c.chunks = append(chunks, c.chunks...)
+		c.firstRowGroup = 0
+	}
+	return nil
+}
+
+// The location of a column chunk in the file.
+type columnChunk struct {
+	offset int64
+	size   int64
+}
+
+// Writes the column as a single data page.
+func (c *columnData) writeChunk(cw *countingWriter, numRows int) (columnChunk, error) {
+	var page compactWriter
+	definitionLevels := c.definitionLevels()
+	binary.Write(&page, binary.LittleEndian, uint32(len(definitionLevels)))
+	page.Write(definitionLevels)
+
+	switch c.Type {
+	case Double:
+		for i, f := range c.doubles {
+			if c.defined[i] {
+				binary.Write(&page, binary.LittleEndian, math.Float64bits(f))
+			}
+		}
+	default:
+		for i, s := range c.strings {
+			if c.defined[i] {
+				binary.Write(&page, binary.LittleEndian, uint32(len(s)))
+				page.WriteString(s)
+			}
+		}
+	}
+
+	var header compactWriter
+	header.structBegin()
+	header.i32(1, pageTypeData)
+	header.i32(2, int32(page.Len()))
+	header.i32(3, int32(page.Len()))
+	header.structField(5)
+	header.i32(1, int32(numRows))
+	header.i32(2, encodingPlain)
+	header.i32(3, encodingRLE)
+	header.i32(4, encodingRLE)
+	header.structEnd()
+	header.structEnd()
+
+	chunk := columnChunk{offset: cw.n, size: int64(header.Len() + page.Len())}
+	if _, err := cw.Write(header.Bytes()); err != nil {
+		return chunk, err
+	}
+	_, err := cw.Write(page.Bytes())
+	return chunk, err
+}
+
+// The definition levels (1 for defined values and 0 for nulls) are encoded as
+// runs of the RLE/bit-packing hybrid encoding with a bit width of 1.
+func (c *columnData) definitionLevels() []byte {
+	var levels compactWriter
+	for i := 0; i < len(c.defined); {
+		run := 1
+		for i+run < len(c.defined) && c.defined[i+run] == c.defined[i] {
+			run++
+		}
+		levels.varint(uint64(run) << 1)
+		if c.defined[i] {
+			levels.WriteByte(1)
+		} else {
+			levels.WriteByte(0)
+		}
+		i += run
+	}
+	return levels.Bytes()
+}
+
+func (w *Writer) fileMetadata() []byte {
+	var m compactWriter
+	m.structBegin()
+	m.i32(1, 1)
+
+	m.listField(2, compactStruct, len(w.columns)+1)
+	m.structBegin()
+	m.binary(4, "schema")
+	m.i32(5, int32(len(w.columns)))
+	m.structEnd()
+	for _, c := range w.columns {
+		m.structBegin()
+		if c.Type == Double {
+			m.i32(1, physicalTypeDouble)
+		} else {
+			m.i32(1, physicalTypeByteArray)
+		}
+		m.i32(3, repetitionOptional)
+		m.binary(4, c.Name)
+		if c.Type == String {
+			m.i32(6, convertedTypeUTF8)
+		}
+		m.structEnd()
+	}
+
+	m.i64(3, int64(w.NumRows()))
+	m.listField(4, compactStruct, len(w.rowGroups))
+	for i, numRows := range w.rowGroups {
+		m.structBegin()
+		m.listField(1, compactStruct, len(w.columns))
+		var totalSize int64
+		for _, c := range w.columns {
+			writeColumnChunkMetadata(&m, c, c.chunks[i], numRows)
+			totalSize += c.chunks[i].size
+		}
+		m.i64(2, totalSize)
+		m.i64(3, int64(numRows))
+		m.structEnd()
+	}
+
+	m.binary(6, fmt.Sprintf("%s version %s", version.Name, version.Version))
+	m.structEnd()
+	return m.Bytes()
+}
+
+func writeColumnChunkMetadata(m *compactWriter, c *columnData, chunk columnChunk,
+	numRows int) {
+
+	m.structBegin()
+	m.i64(2, chunk.offset)
+	m.structField(3)
+	if c.Type == Double {
+		m.i32(1, physicalTypeDouble)
+	} else {
+		m.i32(1, physicalTypeByteArray)
+	}
+	m.listField(2, compactI32, 2)
+	m.zigzag(int64(encodingPlain))
+	m.zigzag(int64(encodingRLE))
+	m.listField(3, compactBinary, 1)
+	m.binaryElement(c.Name)
+	m.i32(4, codecUncompressed)
+	m.i64(5, int64(numRows))
+	m.i64(6, chunk.size)
+	m.i64(7, chunk.size)
+	m.i64(9, chunk.offset)
+	m.structEnd()
+	m.structEnd()
+}
+
+// Keeps track of the file offset.
+type countingWriter struct {
+	writer io.Writer
+	n      int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.writer.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
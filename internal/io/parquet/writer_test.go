@@ -0,0 +1,257 @@
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, Column{Name: "$hostname", Type: String},
+		Column{Name: "count($line)", Type: Double})
+	w.AddRow(map[string]string{"$hostname": "web1", "count($line)": "42"})
+	w.AddRow(map[string]string{"$hostname": "web2", "count($line)": "NaN"})
+	w.AddRow(map[string]string{"count($line)": "not a number", "$extra": "foo"})
+
+	if err := w.Close(); err != nil {
+		t.Errorf("Unable to write Parquet file: %v", err)
+		return
+	}
+	file := buf.Bytes()
+	if !bytes.HasPrefix(file, []byte(magic)) || !bytes.HasSuffix(file, []byte(magic)) {
+		t.Errorf("Expected Parquet magic bytes")
+		return
+	}
+
+	metadataLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	metadata, err := readStruct(bytes.NewReader(file[len(file)-8-metadataLen : len(file)-8]))
+	if err != nil {
+		t.Errorf("Unable to decode file metadata: %v", err)
+		return
+	}
+	if numRows := metadata[3]; numRows != int64(3) {
+		t.Errorf("Expected 3 rows but got %v", numRows)
+	}
+
+	schema := metadata[2].([]interface{})
+	expectedSchema := []struct {
+		name         string
+		physicalType int64
+	}{
+		{"$hostname", int64(physicalTypeByteArray)},
+		{"count($line)", int64(physicalTypeDouble)},
+		{"$extra", int64(physicalTypeByteArray)},
+	}
+	if len(schema) != len(expectedSchema)+1 {
+		t.Errorf("Expected %d schema elements but got %d", len(expectedSchema)+1, len(schema))
+		return
+	}
+	for i, expected := range expectedSchema {
+		element := schema[i+1].(map[int16]interface{})
+		if name := string(element[4].([]byte)); name != expected.name {
+			t.Errorf("Expected column '%s' but got '%s'", expected.name, name)
+		}
+		if element[1] != expected.physicalType {
+			t.Errorf("Expected physical type %d of column '%s' but got %v",
+				expected.physicalType, expected.name, element[1])
+		}
+	}
+
+	rowGroup := metadata[4].([]interface{})[0].(map[int16]interface{})
+	chunks := rowGroup[1].([]interface{})
+	pages := make([][]byte, len(chunks))
+	for i, chunk := range chunks {
+		columnMetadata := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+		offset := columnMetadata[9].(int64)
+		reader := bytes.NewReader(file[offset:])
+		header, err := readStruct(reader)
+		if err != nil {
+			t.Errorf("Unable to decode page header: %v", err)
+			return
+		}
+		pages[i] = make([]byte, header[3].(int64))
+		reader.Read(pages[i])
+	}
+
+	// Definition levels: 1 (RLE run length 2 of value 1), 0 (run length 1 of 0).
+	expectedPage := []byte{4, 0, 0, 0, 2 << 1, 1, 1 << 1, 0, 4, 0, 0, 0}
+	expectedPage = append(append(expectedPage, "web1"...), 4, 0, 0, 0)
+	expectedPage = append(expectedPage, "web2"...)
+	if !bytes.Equal(pages[0], expectedPage) {
+		t.Errorf("Expected page\n%v\nbut got\n%v", expectedPage, pages[0])
+	}
+
+	if len(pages[1]) != 4+4+16 {
+		t.Errorf("Expected two doubles in page but got %v", pages[1])
+		return
+	}
+	if f := math.Float64frombits(binary.LittleEndian.Uint64(pages[1][8:])); f != 42 {
+		t.Errorf("Expected 42 but got %v", f)
+	}
+	if f := math.Float64frombits(binary.LittleEndian.Uint64(pages[1][16:])); !math.IsNaN(f) {
+		t.Errorf("Expected NaN but got %v", f)
+	}
+}
+
+func TestWriterEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := NewWriter(&buf, Column{Name: "foo", Type: Double}).Close(); err != nil {
+		t.Errorf("Unable to write Parquet file: %v", err)
+		return
+	}
+	file := buf.Bytes()
+	metadataLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	if metadataLen+len(magic)*2+4 != len(file) {
+		t.Errorf("Expected only metadata in empty Parquet file but got %v", file)
+	}
+}
+
+func TestWriterRowGroups(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewWriter(&buf, Column{Name: "$line", Type: String})
+	w.rowGroupSize = 10
+
+	// The row group is written once its values reach the size.
+	w.AddRow(map[string]string{"$line": "12345"})
+	if buf.Len() != 0 {
+		t.Errorf("Expected the first row to be buffered but got %v", buf.Bytes())
+	}
+	w.AddRow(map[string]string{"$line": "67890"})
+	if buf.Len() == 0 {
+		t.Errorf("Expected the first row group to be written")
+	}
+	// A column added later is null in the previous row groups.
+	w.AddRow(map[string]string{"$line": "foo", "$extra": "bar"})
+	if err := w.Close(); err != nil {
+		t.Errorf("Unable to write Parquet file: %v", err)
+		return
+	}
+	if err := w.AddRow(map[string]string{"$line": "foo"}); err == nil {
+		t.Errorf("Expected an error when adding rows to a closed file")
+	}
+
+	file := buf.Bytes()
+	metadataLen := int(binary.LittleEndian.Uint32(file[len(file)-8:]))
+	metadata, err := readStruct(bytes.NewReader(file[len(file)-8-metadataLen : len(file)-8]))
+	if err != nil {
+		t.Errorf("Unable to decode file metadata: %v", err)
+		return
+	}
+	if numRows := metadata[3]; numRows != int64(3) {
+		t.Errorf("Expected 3 rows but got %v", numRows)
+	}
+	rowGroups := metadata[4].([]interface{})
+	if len(rowGroups) != 2 {
+		t.Errorf("Expected 2 row groups but got %d", len(rowGroups))
+		return
+	}
+
+	expected := []struct {
+		numRows int64
+		pages   [][]byte
+	}{
+		{2, [][]byte{
+			append(append([]byte{2, 0, 0, 0, 2 << 1, 1, 5, 0, 0, 0}, "12345"...),
+				append([]byte{5, 0, 0, 0}, "67890"...)...),
+			{2, 0, 0, 0, 2 << 1, 0},
+		}},
+		{1, [][]byte{
+			append([]byte{2, 0, 0, 0, 1 << 1, 1, 3, 0, 0, 0}, "foo"...),
+			append([]byte{2, 0, 0, 0, 1 << 1, 1, 3, 0, 0, 0}, "bar"...),
+		}},
+	}
+	for i, rowGroup := range rowGroups {
+		rowGroup := rowGroup.(map[int16]interface{})
+		if numRows := rowGroup[3]; numRows != expected[i].numRows {
+			t.Errorf("Expected %d rows in row group %d but got %v", expected[i].numRows, i, numRows)
+		}
+		for j, chunk := range rowGroup[1].([]interface{}) {
+			columnMetadata := chunk.(map[int16]interface{})[3].(map[int16]interface{})
+			if numValues := columnMetadata[5]; numValues != expected[i].numRows {
+				t.Errorf("Expected %d values in row group %d but got %v",
+					expected[i].numRows, i, numValues)
+			}
+			reader := bytes.NewReader(file[columnMetadata[9].(int64):])
+			header, err := readStruct(reader)
+			if err != nil {
+				t.Errorf("Unable to decode page header: %v", err)
+				return
+			}
+			page := make([]byte, header[3].(int64))
+			reader.Read(page)
+			if !bytes.Equal(page, expected[i].pages[j]) {
+				t.Errorf("Expected page %d of row group %d\n%v\nbut got\n%v",
+					j, i, expected[i].pages[j], page)
+			}
+		}
+	}
+}
+
+// Decodes a Thrift compact protocol struct into a map of field ids to values.
+func readStruct(reader *bytes.Reader) (map[int16]interface{}, error) {
+	fields := make(map[int16]interface{})
+	var fieldID int16
+	for {
+		header, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if header == 0 {
+			return fields, nil
+		}
+		if delta := int16(header >> 4); delta != 0 {
+			fieldID += delta
+		} else {
+			id, err := binary.ReadVarint(reader)
+			if err != nil {
+				return nil, err
+			}
+			fieldID = int16(id)
+		}
+		if fields[fieldID], err = readValue(reader, header&0x0f); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func readValue(reader *bytes.Reader, valueType byte) (interface{}, error) {
+	switch valueType {
+	case compactI32, compactI64:
+		return binary.ReadVarint(reader)
+	case compactBinary:
+		length, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return nil, err
+		}
+		value := make([]byte, length)
+		_, err = reader.Read(value)
+		return value, err
+	case compactStruct:
+		return readStruct(reader)
+	case compactList:
+		header, err := reader.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		size := uint64(header >> 4)
+		if size == 15 {
+			if size, err = binary.ReadUvarint(reader); err != nil {
+				return nil, err
+			}
+		}
+		var list []interface{}
+		for i := uint64(0); i < size; i++ {
+			value, err := readValue(reader, header&0x0f)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, nil
+	default:
+		return nil, fmt.Errorf("unexpected Thrift type %d", valueType)
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !windows
+// +build !windows
+
+package signal
+
+import (
+	"context"
+	"os"
+	gosignal "os/signal"
+	"syscall"
+)
+
+// UserCh returns a channel notified on SIGUSR1, e.g. to change the regex of a
+// running dtail.
+func UserCh(ctx context.Context) <-chan struct{} {
+	sigUsrCh := make(chan os.Signal, 1)
+	gosignal.Notify(sigUsrCh, syscall.SIGUSR1)
+	userCh := make(chan struct{})
+
+	go func() {
+		defer gosignal.Stop(sigUsrCh)
+		for {
+			select {
+			case <-sigUsrCh:
+				select {
+				case userCh <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return userCh
+}
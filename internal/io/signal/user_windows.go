@@ -0,0 +1,12 @@
+//go:build windows
+// +build windows
+
+package signal
+
+import "context"
+
+// UserCh returns a channel which is never notified, as there is no SIGUSR1 on
+// Windows.
+func UserCh(ctx context.Context) <-chan struct{} {
+	return make(chan struct{})
+}
@@ -8,16 +8,20 @@ import (
 
 	"github.com/mimecast/dtail/internal/io/dlog"
 	"github.com/mimecast/dtail/internal/io/pool"
+	"github.com/mimecast/dtail/internal/mapr/sketch"
 	"github.com/mimecast/dtail/internal/protocol"
 )
 
 // AggregateSet represents aggregated key/value pairs from the
 // MAPREDUCE log lines. These could be either string values or float
-// values.
+// values. Percentiles and distinct counts can't be merged from plain
+// floats, so these are kept as mergeable sketches.
 type AggregateSet struct {
 	Samples int
 	FValues map[string]float64
 	SValues map[string]string
+	QValues map[string]*sketch.Quantile
+	DValues map[string]*sketch.Distinct
 }
 
 // NewAggregateSet creates a new empty aggregate set.
@@ -25,20 +29,22 @@ func NewAggregateSet() *AggregateSet {
 	return &AggregateSet{
 		FValues: make(map[string]float64),
 		SValues: make(map[string]string),
+		QValues: make(map[string]*sketch.Quantile),
+		DValues: make(map[string]*sketch.Distinct),
 	}
 }
 
 // String representation of aggregate set.
 func (s *AggregateSet) String() string {
-	return fmt.Sprintf("AggregateSet(Samples:%d,FValues:%v,SValues:%v)",
-		s.Samples, s.FValues, s.SValues)
+	return fmt.Sprintf("AggregateSet(Samples:%d,FValues:%v,SValues:%v,QValues:%v,DValues:%v)",
+		s.Samples, s.FValues, s.SValues, s.QValues, s.DValues)
 }
 
 // Merge one aggregate set into this one.
 func (s *AggregateSet) Merge(query *Query, set *AggregateSet) error {
 	s.Samples += set.Samples
 	//dlog.Common.Trace("Merge", set)
-	for _, sc := range query.Select {
+	for _, sc := range query.Aggregations() {
 		storage := sc.FieldStorage
 		switch sc.Operation {
 		case Count:
@@ -60,6 +66,10 @@ func (s *AggregateSet) Merge(query *Query, set *AggregateSet) error {
 		case Len:
 			s.setString(storage, set.SValues[storage])
 			s.setFloat(storage, set.FValues[storage])
+		case Percentile:
+			s.mergeQuantile(storage, set.QValues[storage])
+		case DCount:
+			s.mergeDistinct(storage, set.DValues[storage])
 		default:
 			return fmt.Errorf("Unknown aggregation method '%v'", sc.Operation)
 		}
@@ -92,6 +102,20 @@ func (s *AggregateSet) Serialize(ctx context.Context, groupKey string, ch chan<-
 		sb.WriteString(protocol.AggregateDelimiter)
 	}
 
+	for k, v := range s.QValues {
+		sb.WriteString(k)
+		sb.WriteString(protocol.AggregateKVDelimiter)
+		sb.WriteString(v.Serialize())
+		sb.WriteString(protocol.AggregateDelimiter)
+	}
+
+	for k, v := range s.DValues {
+		sb.WriteString(k)
+		sb.WriteString(protocol.AggregateKVDelimiter)
+		sb.WriteString(v.Serialize())
+		sb.WriteString(protocol.AggregateDelimiter)
+	}
+
 	select {
 	case ch <- sb.String():
 	case <-ctx.Done():
@@ -131,6 +155,42 @@ func (s *AggregateSet) addFloatMax(key string, value float64) {
 	}
 }
 
+// Merge a quantile sketch.
+func (s *AggregateSet) mergeQuantile(key string, q *sketch.Quantile) {
+	if q == nil {
+		return
+	}
+	s.quantile(key).Merge(q)
+}
+
+// Get a quantile sketch, create it if not present yet.
+func (s *AggregateSet) quantile(key string) *sketch.Quantile {
+	q, ok := s.QValues[key]
+	if !ok {
+		q = sketch.NewQuantile()
+		s.QValues[key] = q
+	}
+	return q
+}
+
+// Merge a distinct count sketch.
+func (s *AggregateSet) mergeDistinct(key string, d *sketch.Distinct) {
+	if d == nil {
+		return
+	}
+	s.distinct(key).Merge(d)
+}
+
+// Get a distinct count sketch, create it if not present yet.
+func (s *AggregateSet) distinct(key string) *sketch.Distinct {
+	d, ok := s.DValues[key]
+	if !ok {
+		d = sketch.NewDistinct()
+		s.DValues[key] = d
+	}
+	return d
+}
+
 // Set a string.
 func (s *AggregateSet) setString(key, value string) {
 	s.SValues[key] = value
@@ -164,6 +224,26 @@ func (s *AggregateSet) Aggregate(key string, agg AggregateOperation, value strin
 		s.setString(key, value)
 		s.setFloat(key, float64(len(value)))
 		return
+	case Percentile:
+		if clientAggregation {
+			var q *sketch.Quantile
+			if q, err = sketch.DeserializeQuantile(value); err != nil {
+				return
+			}
+			s.mergeQuantile(key, q)
+			return
+		}
+	case DCount:
+		if clientAggregation {
+			var d *sketch.Distinct
+			if d, err = sketch.DeserializeDistinct(value); err != nil {
+				return
+			}
+			s.mergeDistinct(key, d)
+			return
+		}
+		s.distinct(key).Add(value)
+		return
 	default:
 	}
 
@@ -182,6 +262,8 @@ func (s *AggregateSet) Aggregate(key string, agg AggregateOperation, value strin
 		s.addFloatMin(key, f)
 	case Max:
 		s.addFloatMax(key, f)
+	case Percentile:
+		s.quantile(key).Add(f)
 	default:
 		err = fmt.Errorf("Unknown aggregation method '%v'", agg)
 	}
@@ -0,0 +1,52 @@
+package mapr
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAggregateSetSketchMerge(t *testing.T) {
+	queryStr := "select p50($latency), dcount($user) from STATS"
+	q, err := NewQuery(queryStr)
+	if err != nil {
+		t.Errorf("Query parse error: %s\n%v: %v", queryStr, q, err)
+		return
+	}
+
+	// Two servers aggregate their own values, the client merges them.
+	global := NewAggregateSet()
+	for server := 0; server < 2; server++ {
+		set := NewAggregateSet()
+		for i := 0; i < 100; i++ {
+			value := fmt.Sprintf("%d", server*100+i)
+			for _, sc := range q.Select {
+				if err := set.Aggregate(sc.FieldStorage, sc.Operation, value, false); err != nil {
+					t.Errorf("Unable to aggregate '%s': %v", value, err)
+				}
+			}
+		}
+
+		// Simulate sending the sketches over the wire to the client.
+		clientSet := NewAggregateSet()
+		serialized := map[string]string{
+			"p50($latency)": set.QValues["p50($latency)"].Serialize(),
+			"dcount($user)": set.DValues["dcount($user)"].Serialize(),
+		}
+		for _, sc := range q.Select {
+			value := serialized[sc.FieldStorage]
+			if err := clientSet.Aggregate(sc.FieldStorage, sc.Operation, value, true); err != nil {
+				t.Errorf("Unable to aggregate serialized '%s': %v", sc.FieldStorage, err)
+			}
+		}
+		if err := global.Merge(q, clientSet); err != nil {
+			t.Errorf("Unable to merge aggregate set: %v", err)
+		}
+	}
+
+	if p50 := global.QValues["p50($latency)"].Value(0.5); p50 < 97 || p50 > 102 {
+		t.Errorf("Expected merged p50 to be about 99.5 but got %v", p50)
+	}
+	if dcount := global.DValues["dcount($user)"].Value(); dcount != 200 {
+		t.Errorf("Expected merged distinct count to be 200 but got %v", dcount)
+	}
+}
@@ -0,0 +1,150 @@
+package mapr
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The layout of the time bucket values. Buckets are always in UTC, so that
+// results of servers in different time zones can be merged.
+const bucketLayout string = "2006-01-02T15:04:05Z"
+
+// The timestamp layouts understood by the bucket function. Numeric values
+// are interpreted as Unix epoch seconds (e.g. the $epoch variable).
+var timestampLayouts = [...]string{
+	"20060102-150405", // DTail default log format
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04:05.000",
+	"02/Jan/2006:15:04:05 -0700", // Common log format
+	time.Stamp,                   // Syslog (RFC 3164)
+}
+
+// Represents a parsed time bucket, e.g. "bucket($time, 5m)". It's used to
+// group by aligned time windows.
+type timeBucket struct {
+	Field        string
+	FieldStorage string
+	Size         time.Duration
+}
+
+func (tb timeBucket) String() string {
+	return fmt.Sprintf("timeBucket(Field:%s,FieldStorage:%s,Size:%v)",
+		tb.Field, tb.FieldStorage, tb.Size)
+}
+
+// Parse a time bucket function call. Returns false if str isn't a bucket at all.
+func makeTimeBucket(str string) (timeBucket, bool, error) {
+	var tb timeBucket
+	if !strings.HasPrefix(str, "bucket(") || !strings.HasSuffix(str, ")") {
+		return tb, false, nil
+	}
+
+	args := strings.Split(str[len("bucket("):len(str)-1], ",")
+	if len(args) != 2 || args[0] == "" {
+		return tb, true, errors.New(invalidQuery + "Expected field and size in " +
+			"time bucket, e.g. 'bucket($time, 5m)': " + str)
+	}
+
+	size, err := parseBucketSize(args[1])
+	if err != nil {
+		return tb, true, errors.New(invalidQuery + "Unable to parse time bucket size: " +
+			err.Error())
+	}
+
+	tb.Field = args[0]
+	tb.FieldStorage = str
+	tb.Size = size
+	return tb, true, nil
+}
+
+// Like time.ParseDuration, but also understands days, e.g. "1d".
+func parseBucketSize(str string) (time.Duration, error) {
+	var size time.Duration
+	var err error
+
+	if strings.HasSuffix(str, "d") {
+		var days int
+		days, err = strconv.Atoi(strings.TrimSuffix(str, "d"))
+		size = time.Duration(days) * time.Hour * 24
+	} else {
+		size, err = time.ParseDuration(str)
+	}
+	if err != nil {
+		return 0, err
+	}
+	if size < time.Second {
+		return 0, fmt.Errorf("time bucket size '%s' must be at least one second", str)
+	}
+	return size, nil
+}
+
+// Parse all time buckets used in the 'select' and 'group by' clauses.
+func (q *Query) parseTimeBuckets() error {
+	candidates := q.GroupBy
+	for _, sc := range q.Select {
+		candidates = append(candidates, sc.Field)
+	}
+
+	seen := make(map[string]struct{})
+	for _, candidate := range candidates {
+		if _, ok := seen[candidate]; ok {
+			continue
+		}
+		tb, ok, err := makeTimeBucket(candidate)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+		seen[candidate] = struct{}{}
+		q.Buckets = append(q.Buckets, tb)
+	}
+	return nil
+}
+
+// BucketClause adds the time bucket fields, e.g. "bucket($time,5m)", to the fields.
+func (q *Query) BucketClause(fields map[string]string) {
+	for _, tb := range q.Buckets {
+		value, ok := fields[tb.Field]
+		if !ok {
+			continue
+		}
+		t, ok := ParseTimestamp(value)
+		if !ok {
+			continue
+		}
+		fields[tb.FieldStorage] = t.Truncate(tb.Size).UTC().Format(bucketLayout)
+	}
+}
+
+// ParseTimestamp parses a log line timestamp of any of the well known layouts.
+// Timestamps without a time zone are in local time.
+func ParseTimestamp(value string) (time.Time, bool) {
+	if epoch, err := strconv.ParseFloat(value, 64); err == nil {
+		sec := int64(epoch)
+		return time.Unix(sec, int64((epoch-float64(sec))*float64(time.Second))), true
+	}
+
+	for _, layout := range timestampLayouts {
+		t, err := time.ParseInLocation(layout, value, time.Local)
+		if err != nil {
+			continue
+		}
+		if layout == time.Stamp {
+			// Syslog timestamps come without the year.
+			now := time.Now()
+			t = t.AddDate(now.Year(), 0, 0)
+			if t.After(now.Add(time.Hour * 24)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+		}
+		return t, true
+	}
+	return time.Time{}, false
+}
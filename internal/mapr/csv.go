@@ -0,0 +1,59 @@
+package mapr
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"strconv"
+	"unicode/utf8"
+
+	"github.com/mimecast/dtail/internal/protocol"
+)
+
+// The default delimiter of CSV outfiles and of the "csv" log format.
+var defaultCSVDelimiter, _ = utf8.DecodeRuneInString(protocol.CSVDelimiter)
+
+// Parse a quoted CSV delimiter, e.g. ";" or "\t" of 'logformat csv ";"' or of
+// 'outfile "result.csv" ";"'.
+func parseCSVDelimiter(str string) (rune, error) {
+	if unquoted, err := strconv.Unquote(`"` + str + `"`); err == nil {
+		str = unquoted
+	}
+	delimiter, size := utf8.DecodeRuneInString(str)
+	switch {
+	case size == 0 || size != len(str):
+		return 0, errors.New(invalidQuery + "Expected a single character as CSV " +
+			"delimiter but got '" + str + "'")
+	case delimiter == '"' || delimiter == '\r' || delimiter == '\n' ||
+		delimiter == utf8.RuneError:
+		return 0, errors.New(invalidQuery + "Invalid CSV delimiter '" + str + "'")
+	}
+	return delimiter, nil
+}
+
+// Write the result rows as RFC 4180 CSV, values containing the delimiter,
+// quotes or line breaks are quoted.
+func (g *GroupSet) resultWriteCSV(query *Query, delimiter rune, w io.Writer,
+	rows []result, writeHeader bool) error {
+
+	writer := csv.NewWriter(w)
+	writer.Comma = delimiter
+
+	if writeHeader {
+		header := make([]string, len(query.Select))
+		for i, sc := range query.Select {
+			header[i] = sc.FieldStorage
+		}
+		if err := writer.Write(header); err != nil {
+			return err
+		}
+	}
+	for _, r := range rows {
+		if err := writer.Write(r.values); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
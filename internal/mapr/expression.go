@@ -0,0 +1,283 @@
+package mapr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const arithmeticOperators string = "+-*/%"
+
+// Represents a parsed arithmetic expression, e.g. "$bytes / 1048576" in the
+// "set" clause or "sum(errors)/count(*)" in the "select" clause. Leaves are
+// either float constants or operands (field names or aggregations).
+type expression struct {
+	operator byte
+	left     *expression
+	right    *expression
+	operand  string
+	value    float64
+}
+
+func (e *expression) String() string {
+	switch {
+	case e.operator != 0:
+		return fmt.Sprintf("(%v %c %v)", e.left, e.operator, e.right)
+	case e.operand != "":
+		return e.operand
+	default:
+		return strconv.FormatFloat(e.value, 'f', -1, 64)
+	}
+}
+
+// Evaluate the expression, the operand values are looked up with the given
+// callback. Returns false if an operand value is missing or when dividing by 0.
+func (e *expression) eval(operandValue func(operand string) (float64, bool)) (float64, bool) {
+	switch {
+	case e.operator == 0 && e.operand != "":
+		return operandValue(e.operand)
+	case e.operator == 0:
+		return e.value, true
+	}
+
+	left, ok := e.left.eval(operandValue)
+	if !ok {
+		return 0, false
+	}
+	right, ok := e.right.eval(operandValue)
+	if !ok {
+		return 0, false
+	}
+
+	switch e.operator {
+	case '+':
+		return left + right, true
+	case '-':
+		return left - right, true
+	case '*':
+		return left * right, true
+	case '/':
+		if right == 0 {
+			return 0, false
+		}
+		return left / right, true
+	case '%':
+		if right == 0 {
+			return 0, false
+		}
+		return math.Mod(left, right), true
+	default:
+		return 0, false
+	}
+}
+
+// Return all operands of the expression in query order.
+func (e *expression) operands() []string {
+	if e.operator == 0 {
+		if e.operand == "" {
+			return nil
+		}
+		return []string{e.operand}
+	}
+	return append(e.left.operands(), e.right.operands()...)
+}
+
+// Helper to parse the lexemes of an expression with the usual precedence.
+type expressionParser struct {
+	lexemes []string
+}
+
+func makeExpression(str string) (*expression, error) {
+	p := expressionParser{lexemes: lexExpression(str)}
+	if len(p.lexemes) == 0 {
+		return nil, errors.New(invalidQuery + "Empty arithmetic expression")
+	}
+	e, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if len(p.lexemes) > 0 {
+		return nil, errors.New(invalidQuery + "Unexpected '" + p.lexemes[0] +
+			"' in arithmetic expression: " + str)
+	}
+	return e, nil
+}
+
+// Determines whether str is an arithmetic expression and not just a single
+// field, constant or function call.
+func isExpression(str string) bool {
+	return len(lexExpression(str)) > 1
+}
+
+func (p *expressionParser) peek(what string) bool {
+	return len(p.lexemes) > 0 && p.lexemes[0] == what
+}
+
+func (p *expressionParser) parseSum() (*expression, error) {
+	e, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek("+") || p.peek("-") {
+		operator := p.lexemes[0][0]
+		p.lexemes = p.lexemes[1:]
+		right, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		e = &expression{operator: operator, left: e, right: right}
+	}
+	return e, nil
+}
+
+func (p *expressionParser) parseProduct() (*expression, error) {
+	e, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek("*") || p.peek("/") || p.peek("%") {
+		operator := p.lexemes[0][0]
+		p.lexemes = p.lexemes[1:]
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		e = &expression{operator: operator, left: e, right: right}
+	}
+	return e, nil
+}
+
+func (p *expressionParser) parseUnary() (*expression, error) {
+	if p.peek("-") {
+		p.lexemes = p.lexemes[1:]
+		e, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &expression{operator: '-', left: &expression{}, right: e}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *expressionParser) parsePrimary() (*expression, error) {
+	if len(p.lexemes) == 0 {
+		return nil, errors.New(invalidQuery + "Unexpected end of arithmetic expression")
+	}
+
+	lexeme := p.lexemes[0]
+	p.lexemes = p.lexemes[1:]
+
+	switch {
+	case lexeme == "(":
+		e, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peek(")") {
+			return nil, errors.New(invalidQuery + "Missing ')' in arithmetic expression")
+		}
+		p.lexemes = p.lexemes[1:]
+		return e, nil
+	case lexeme == ")" || strings.Contains(arithmeticOperators, lexeme):
+		return nil, errors.New(invalidQuery + "Unexpected '" + lexeme +
+			"' in arithmetic expression")
+	}
+
+	if f, err := strconv.ParseFloat(lexeme, 64); err == nil {
+		return &expression{value: f}, nil
+	}
+	return &expression{operand: lexeme}, nil
+}
+
+// Split an expression into its lexemes. Operators must be separated by
+// whitespaces (as field names may contain e.g. '-'), except around function
+// calls, e.g. "sum(errors)/count(*)", and the unary minus, e.g. "-$bytes".
+func lexExpression(str string) []string {
+	var lexemes []string
+
+	for _, word := range strings.Fields(str) {
+		for strings.HasPrefix(word, "(") || strings.HasPrefix(word, "-$") ||
+			strings.HasPrefix(word, "-(") {
+			lexemes = append(lexemes, word[0:1])
+			word = word[1:]
+		}
+		var closing int
+		for strings.HasSuffix(word, ")") &&
+			strings.Count(word, ")") > strings.Count(word, "(") {
+			closing++
+			word = word[:len(word)-1]
+		}
+		lexemes = append(lexemes, lexFunctionCalls(word)...)
+		for ; closing > 0; closing-- {
+			lexemes = append(lexemes, ")")
+		}
+	}
+	return lexemes
+}
+
+// Split a word with function calls such as "sum(errors)/count(*)" at its top
+// level operators.
+func lexFunctionCalls(word string) []string {
+	if word == "" {
+		return nil
+	}
+	if !strings.Contains(word, "(") {
+		return []string{word}
+	}
+
+	var lexemes []string
+	var depth, start int
+	for i := 0; i < len(word); i++ {
+		switch c := word[i]; {
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case depth == 0 && i > 0 && strings.IndexByte(arithmeticOperators, c) >= 0:
+			if start < i {
+				lexemes = append(lexemes, word[start:i])
+			}
+			lexemes = append(lexemes, string(c))
+			start = i + 1
+		}
+	}
+	if start < len(word) {
+		lexemes = append(lexemes, word[start:])
+	}
+	return lexemes
+}
+
+// Returns the number of tokens of the arithmetic expression at the beginning
+// of the tokens, e.g. 3 for "$bytes / 1048576 $foo = ...".
+func tokensExpressionLength(tokens []token) int {
+	var depth, n int
+	for n < len(tokens) {
+		if t := tokens[n]; t.isBareword && !t.quotesStripped {
+			depth += strings.Count(t.str, "(") - strings.Count(t.str, ")")
+		}
+		n++
+		if depth > 0 {
+			continue
+		}
+		if n < len(tokens) && tokens[n].isArithmeticOperator() {
+			n++
+			continue
+		}
+		break
+	}
+	return n
+}
+
+// Joins the tokens of an arithmetic expression into a single token.
+func tokensJoinExpression(tokens []token) token {
+	if len(tokens) == 1 {
+		return tokens[0]
+	}
+	strs := make([]string, len(tokens))
+	for i, t := range tokens {
+		strs[i] = t.str
+	}
+	return token{str: strings.Join(strs, " "), isBareword: true}
+}
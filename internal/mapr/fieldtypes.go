@@ -8,7 +8,8 @@ const (
 	Field          fieldType = iota
 	String         fieldType = iota
 	Float          fieldType = iota
-	FunctionStack  fieldType = iota
+	FunctionCall   fieldType = iota
+	Arithmetic     fieldType = iota
 )
 
 func (w fieldType) String() string {
@@ -19,8 +20,10 @@ func (w fieldType) String() string {
 		return "String"
 	case Float:
 		return "Float"
-	case FunctionStack:
-		return "FunctionStack"
+	case FunctionCall:
+		return "FunctionCall"
+	case Arithmetic:
+		return "Arithmetic"
 	default:
 		return "UndefFieldType"
 	}
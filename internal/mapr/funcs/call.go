@@ -0,0 +1,216 @@
+package funcs
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Call is a parsed function call, e.g. substr($line, 0, 10). The arguments
+// are either nested function calls, fields, quoted strings or numbers.
+type Call struct {
+	Definition Definition
+	args       []argument
+}
+
+type argument struct {
+	call      *Call
+	field     string
+	literal   string
+	isLiteral bool
+}
+
+func (a argument) String() string {
+	switch {
+	case a.call != nil:
+		return a.call.String()
+	case a.isLiteral:
+		if _, err := strconv.ParseFloat(a.literal, 64); err == nil {
+			return a.literal
+		}
+		return strconv.Quote(a.literal)
+	default:
+		return a.field
+	}
+}
+
+// Type of the argument, fields are strings until evaluated.
+func (a argument) resultType() Type {
+	switch {
+	case a.call != nil:
+		return a.call.Definition.Result
+	case a.isLiteral:
+		if _, err := strconv.Atoi(a.literal); err == nil {
+			return Int
+		}
+		if _, err := strconv.ParseFloat(a.literal, 64); err == nil {
+			return Float
+		}
+	}
+	return String
+}
+
+// NewCall parses a function call, e.g. 'split($line,":",2)', and checks the
+// arity and argument types of all (nested) calls against the registry.
+func NewCall(in string) (*Call, error) {
+	in = strings.TrimSpace(in)
+	index := strings.Index(in, "(")
+	if index <= 0 || !strings.HasSuffix(in, ")") {
+		return nil, fmt.Errorf("unable to parse function call '%s'", in)
+	}
+
+	name := in[0:index]
+	definition, ok := Lookup(name)
+	if !ok {
+		return nil, fmt.Errorf("unknown function '%s', available are: %s", name,
+			strings.Join(Names(), ", "))
+	}
+	c := Call{Definition: definition}
+
+	argStrs, err := splitArgs(in[index+1 : len(in)-1])
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse function call '%s': %w", in, err)
+	}
+	if err := definition.checkArity(len(argStrs)); err != nil {
+		return nil, err
+	}
+
+	for i, argStr := range argStrs {
+		arg, err := newArgument(argStr)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkType(definition, i, arg); err != nil {
+			return nil, err
+		}
+		c.args = append(c.args, arg)
+	}
+	return &c, nil
+}
+
+func newArgument(str string) (argument, error) {
+	switch {
+	case str == "":
+		return argument{}, errors.New("empty function argument")
+	case strings.HasPrefix(str, `"`):
+		if len(str) < 2 || !strings.HasSuffix(str, `"`) {
+			return argument{}, fmt.Errorf("unterminated string argument %s", str)
+		}
+		return argument{literal: str[1 : len(str)-1], isLiteral: true}, nil
+	case strings.HasSuffix(str, ")"):
+		call, err := NewCall(str)
+		if err != nil {
+			return argument{}, err
+		}
+		return argument{call: call}, nil
+	}
+	if _, err := strconv.ParseFloat(str, 64); err == nil {
+		return argument{literal: str, isLiteral: true}, nil
+	}
+	return argument{field: str}, nil
+}
+
+// Everything can be used as a string, but float and int arguments must be
+// numbers (or fields, which are checked when evaluated).
+func checkType(definition Definition, i int, arg argument) error {
+	expected := definition.argType(i)
+	if expected == String || arg.call == nil && !arg.isLiteral {
+		return nil
+	}
+	got := arg.resultType()
+	if got == expected || (expected == Float && got == Int) {
+		return nil
+	}
+	return fmt.Errorf("function %v expects %s as argument %d but got %s %v",
+		definition, expected, i+1, got, arg)
+}
+
+// Split the arguments at all commas, which are not part of nested function
+// calls or quoted strings.
+func splitArgs(str string) ([]string, error) {
+	if strings.TrimSpace(str) == "" {
+		return nil, nil
+	}
+
+	var args []string
+	var depth, start int
+	var quoted bool
+	for i := 0; i < len(str); i++ {
+		switch c := str[i]; {
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth < 0 {
+				return nil, errors.New("unbalanced parentheses")
+			}
+		case c == ',' && depth == 0:
+			args = append(args, strings.TrimSpace(str[start:i]))
+			start = i + 1
+		}
+	}
+	if quoted || depth != 0 {
+		return nil, errors.New("unbalanced parentheses or quotes")
+	}
+	return append(args, strings.TrimSpace(str[start:])), nil
+}
+
+// String representation of the function call.
+func (c *Call) String() string {
+	args := make([]string, len(c.args))
+	for i, arg := range c.args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s(%s)", c.Definition.Name, strings.Join(args, ","))
+}
+
+// Fields returns the names of all fields used as (nested) arguments.
+func (c *Call) Fields() []string {
+	var fields []string
+	for _, arg := range c.args {
+		switch {
+		case arg.call != nil:
+			fields = append(fields, arg.call.Fields()...)
+		case !arg.isLiteral:
+			fields = append(fields, arg.field)
+		}
+	}
+	return fields
+}
+
+// Eval calls the function with the field values of a log line. Missing fields
+// are empty strings. Returns an error if a float or int argument isn't a number.
+func (c *Call) Eval(fields map[string]string) (string, error) {
+	args := make([]string, len(c.args))
+	for i, arg := range c.args {
+		switch {
+		case arg.call != nil:
+			value, err := arg.call.Eval(fields)
+			if err != nil {
+				return "", err
+			}
+			args[i] = value
+		case arg.isLiteral:
+			args[i] = arg.literal
+		default:
+			args[i] = fields[arg.field]
+		}
+
+		var err error
+		switch c.Definition.argType(i) {
+		case Float:
+			_, err = strconv.ParseFloat(args[i], 64)
+		case Int:
+			_, err = strconv.Atoi(args[i])
+		}
+		if err != nil {
+			return "", fmt.Errorf("function %v expects %s as argument %d but got '%s'",
+				c.Definition, c.Definition.argType(i), i+1, args[i])
+		}
+	}
+	return c.Definition.call(args)
+}
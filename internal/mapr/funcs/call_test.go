@@ -0,0 +1,121 @@
+package funcs
+
+import "testing"
+
+func TestCall(t *testing.T) {
+	fields := map[string]string{
+		"$line":   "Hello World",
+		"$path":   "/api/users/42?id=42#top",
+		"$ip":     "10.1.2.3",
+		"$ip6":    "2001:db8::1",
+		"$ms":     "1234.5678",
+		"$epoch":  "1633158729",
+		"$empty":  "",
+		"$nonnum": "foo",
+	}
+
+	testTable := map[string]string{
+		`lower($line)`:                        "hello world",
+		`upper($line)`:                        "HELLO WORLD",
+		`trim(" foo ")`:                       "foo",
+		`substr($line,6)`:                     "World",
+		`substr($line,0,5)`:                   "Hello",
+		`substr($line,6,100)`:                 "World",
+		`substr($line,1,9223372036854775807)`: "ello World",
+		`substr($line,-3,5)`:                  "Hello",
+		`split($line," ",1)`:                  "World",
+		`split($line," ",2)`:                  "",
+		`replace($line,"o","0")`:              "Hell0 W0rld",
+		`replace($line, " ", ", ")`:           "Hello, World",
+		`urlpath($path)`:                      "/api/users/42",
+		`ipsubnet($ip,24)`:                    "10.1.2.0/24",
+		`ipsubnet($ip6,32)`:                   "2001:db8::/32",
+		`round($ms)`:                          "1235",
+		`round($ms,2)`:                        "1234.57",
+		`floor($ms)`:                          "1234",
+		`ceil($ms)`:                           "1235",
+		`abs(-1.5)`:                           "1.5",
+		`todate($epoch)`:                      "2021-10-02T07:12:09Z",
+		`todate($epoch,"2006-01-02")`:         "2021-10-02",
+		`coalesce($missing,$empty,"default")`: "default",
+		`coalesce($line,"default")`:           "Hello World",
+		`upper(substr(lower($line),0,5))`:     "HELLO",
+		`md5sum(split($line," ",0))`:          "8b1a9953c4611296a827abf8c47804d7",
+	}
+
+	for input, expected := range testTable {
+		call, err := NewCall(input)
+		if err != nil {
+			t.Errorf("Unable to parse function call '%s': %s", input, err.Error())
+			continue
+		}
+		result, err := call.Eval(fields)
+		if err != nil {
+			t.Errorf("Unable to evaluate function call '%s': %s", input, err.Error())
+			continue
+		}
+		if result != expected {
+			t.Errorf("Expected '%s' to be '%s' but got '%s'", input, expected, result)
+		}
+	}
+
+	for _, input := range []string{`round($nonnum)`, `ipsubnet("foo",24)`, `ipsubnet($ip,33)`} {
+		call, err := NewCall(input)
+		if err != nil {
+			t.Errorf("Unable to parse function call '%s': %s", input, err.Error())
+			continue
+		}
+		if result, err := call.Eval(fields); err == nil {
+			t.Errorf("Expected error evaluating '%s' but got '%s'", input, result)
+		}
+	}
+
+	parseErrors := []string{
+		`unknown($line)`,
+		`lower()`,
+		`lower($line,$line)`,
+		`substr($line)`,
+		`substr($line,"foo")`,
+		`substr($line,1.5)`,
+		`round(lower($line))`,
+		`split($line,":")`,
+		`replace($line,"a",`,
+		`lower("foo)`,
+	}
+	for _, input := range parseErrors {
+		if call, err := NewCall(input); err == nil {
+			t.Errorf("Expected error parsing '%s' but got %v", input, call)
+		}
+	}
+}
+
+func TestFunction(t *testing.T) {
+	// Like the function stacks, the calls are evaluated with their own input
+	// as $line.
+	for input, expected := range map[string]string{
+		"md5sum($line)":                         "b38699013d79e50d9d122433753959c1",
+		"maskdigits(md5sum(maskdigits($line)))": ".fac.bbe..bb.........d...a.c..b.",
+	} {
+		call, err := NewCall(input)
+		if err != nil {
+			t.Errorf("error parsing function input '%s': %s\n", input, err.Error())
+			continue
+		}
+		result, err := call.Eval(map[string]string{"$line": input})
+		if err != nil {
+			t.Errorf("error executing function call '%s': %s\n", input, err.Error())
+			continue
+		}
+		if result != expected {
+			t.Errorf("error executing function call '%s': expected result "+
+				"'%s' but got '%s'\n", input, expected, result)
+		}
+	}
+
+	for _, input := range []string{"md5sum$line)", "md5sum(makedigits$line))"} {
+		if call, err := NewCall(input); err == nil {
+			t.Errorf("Expected error parsing function input '%s' (%v) but got no error\n",
+				input, call)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package funcs
+
+import (
+	"math"
+	"strconv"
+)
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// Rounds to the nearest integer, or to the given number of decimal places,
+// e.g. round(3.14159, 2) is 3.14.
+func round(args []string) (string, error) {
+	f, _ := strconv.ParseFloat(args[0], 64)
+	if len(args) < 2 {
+		return formatFloat(math.Round(f)), nil
+	}
+	places, _ := strconv.Atoi(args[1])
+	pow := math.Pow(10, float64(places))
+	return formatFloat(math.Round(f*pow) / pow), nil
+}
+
+// Returns the greatest integer value less than or equal to the argument.
+func floor(args []string) (string, error) {
+	f, _ := strconv.ParseFloat(args[0], 64)
+	return formatFloat(math.Floor(f)), nil
+}
+
+// Returns the least integer value greater than or equal to the argument.
+func ceil(args []string) (string, error) {
+	f, _ := strconv.ParseFloat(args[0], 64)
+	return formatFloat(math.Ceil(f)), nil
+}
+
+// Returns the absolute value of the argument.
+func abs(args []string) (string, error) {
+	f, _ := strconv.ParseFloat(args[0], 64)
+	return formatFloat(math.Abs(f)), nil
+}
@@ -0,0 +1,39 @@
+package funcs
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+)
+
+// Returns the path of an URL or of a HTTP request target (without the query
+// string), e.g. urlpath("/api/users?id=42") is "/api/users".
+func urlPath(args []string) (string, error) {
+	u, err := url.Parse(args[0])
+	if err != nil {
+		return "", err
+	}
+	return u.Path, nil
+}
+
+// Returns the subnet of an IPv4 or IPv6 address in CIDR notation, e.g.
+// ipsubnet("10.1.2.3", 24) is "10.1.2.0/24".
+func ipSubnet(args []string) (string, error) {
+	ip := net.ParseIP(args[0])
+	if ip == nil {
+		return "", fmt.Errorf("invalid IP address '%s'", args[0])
+	}
+	bits := 8 * net.IPv6len
+	if ipv4 := ip.To4(); ipv4 != nil {
+		ip = ipv4
+		bits = 8 * net.IPv4len
+	}
+
+	ones, _ := strconv.Atoi(args[1])
+	if ones < 0 || ones > bits {
+		return "", fmt.Errorf("invalid subnet size %d for IP address '%s'", ones, args[0])
+	}
+	network := net.IPNet{IP: ip.Mask(net.CIDRMask(ones, bits)), Mask: net.CIDRMask(ones, bits)}
+	return network.String(), nil
+}
@@ -0,0 +1,160 @@
+package funcs
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Type is the type of a function argument or of a function result.
+type Type int
+
+// The possible types. All values are passed around as strings, but float and
+// int arguments must be parsable as such.
+const (
+	String Type = iota
+	Float  Type = iota
+	Int    Type = iota
+)
+
+func (t Type) String() string {
+	switch t {
+	case String:
+		return "string"
+	case Float:
+		return "float"
+	case Int:
+		return "int"
+	default:
+		return "unknown"
+	}
+}
+
+// Definition describes a function of the registry, so that function calls
+// can be checked for arity and argument types at query parse time.
+type Definition struct {
+	// Name of the function, e.g. "substr".
+	Name string
+	// Types of the arguments. For variadic functions, the type of the last
+	// argument applies to all further arguments.
+	Args []Type
+	// Number of required arguments, the others are optional.
+	Required int
+	// Variadic functions accept any number of (at least Required) arguments.
+	Variadic bool
+	// Type of the result.
+	Result Type
+	// The Go-callback function to call. The arguments are already checked.
+	call func(args []string) (string, error)
+}
+
+// String representation of the function definition, e.g. "substr(string, int, [int])".
+func (d Definition) String() string {
+	str := d.Name + "("
+	for i, t := range d.Args {
+		if i > 0 {
+			str += ", "
+		}
+		if i >= d.Required {
+			str += fmt.Sprintf("[%s]", t)
+			continue
+		}
+		str += t.String()
+	}
+	if d.Variadic {
+		str += "..."
+	}
+	return str + ")"
+}
+
+// Type of the i-th argument.
+func (d Definition) argType(i int) Type {
+	if i >= len(d.Args) {
+		return d.Args[len(d.Args)-1]
+	}
+	return d.Args[i]
+}
+
+// Checks the number of arguments of a function call.
+func (d Definition) checkArity(numArgs int) error {
+	switch {
+	case numArgs < d.Required:
+		return fmt.Errorf("function %v expects at least %d argument(s) but got %d",
+			d, d.Required, numArgs)
+	case !d.Variadic && numArgs > len(d.Args):
+		return fmt.Errorf("function %v expects at most %d argument(s) but got %d",
+			d, len(d.Args), numArgs)
+	}
+	return nil
+}
+
+// The registry of all functions known to the mapreduce engine.
+var registry = map[string]Definition{}
+
+func register(definitions ...Definition) {
+	for _, d := range definitions {
+		registry[d.Name] = d
+	}
+}
+
+func init() {
+	register(
+		Definition{Name: "md5sum", Args: []Type{String}, Required: 1, Result: String,
+			call: unary(Md5Sum)},
+		Definition{Name: "maskdigits", Args: []Type{String}, Required: 1, Result: String,
+			call: unary(MaskDigits)},
+		Definition{Name: "lower", Args: []Type{String}, Required: 1, Result: String,
+			call: unary(Lower)},
+		Definition{Name: "upper", Args: []Type{String}, Required: 1, Result: String,
+			call: unary(Upper)},
+		Definition{Name: "trim", Args: []Type{String}, Required: 1, Result: String,
+			call: unary(Trim)},
+		Definition{Name: "substr", Args: []Type{String, Int, Int}, Required: 2,
+			Result: String, call: substr},
+		Definition{Name: "split", Args: []Type{String, String, Int}, Required: 3,
+			Result: String, call: split},
+		Definition{Name: "replace", Args: []Type{String, String, String}, Required: 3,
+			Result: String, call: replace},
+		Definition{Name: "coalesce", Args: []Type{String}, Required: 1, Variadic: true,
+			Result: String, call: coalesce},
+		Definition{Name: "urlpath", Args: []Type{String}, Required: 1, Result: String,
+			call: urlPath},
+		Definition{Name: "ipsubnet", Args: []Type{String, Int}, Required: 2,
+			Result: String, call: ipSubnet},
+		Definition{Name: "round", Args: []Type{Float, Int}, Required: 1, Result: Float,
+			call: round},
+		Definition{Name: "floor", Args: []Type{Float}, Required: 1, Result: Float,
+			call: floor},
+		Definition{Name: "ceil", Args: []Type{Float}, Required: 1, Result: Float,
+			call: ceil},
+		Definition{Name: "abs", Args: []Type{Float}, Required: 1, Result: Float,
+			call: abs},
+		Definition{Name: "todate", Args: []Type{Float, String}, Required: 1,
+			Result: String, call: toDate},
+	)
+}
+
+// Lookup returns the definition of a function of the registry.
+func Lookup(name string) (Definition, bool) {
+	d, ok := registry[name]
+	return d, ok
+}
+
+// Names returns the names of all registered functions in alphabetical order.
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// CallbackFunc is a string to string function.
+type CallbackFunc func(text string) string
+
+// Wraps a string to string function.
+func unary(cb CallbackFunc) func(args []string) (string, error) {
+	return func(args []string) (string, error) {
+		return cb(args[0]), nil
+	}
+}
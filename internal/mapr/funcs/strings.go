@@ -0,0 +1,69 @@
+package funcs
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Lower returns the input string in lower case.
+func Lower(input string) string {
+	return strings.ToLower(input)
+}
+
+// Upper returns the input string in upper case.
+func Upper(input string) string {
+	return strings.ToUpper(input)
+}
+
+// Trim removes all leading and trailing whitespaces.
+func Trim(input string) string {
+	return strings.TrimSpace(input)
+}
+
+// Returns the substring starting at a given (0-based) character position, with
+// an optional maximum length, e.g. substr("foobar", 1, 3) is "oob".
+func substr(args []string) (string, error) {
+	runes := []rune(args[0])
+	start, _ := strconv.Atoi(args[1])
+	if start < 0 {
+		start = 0
+	}
+	if start > len(runes) {
+		start = len(runes)
+	}
+	end := len(runes)
+	if len(args) > 2 {
+		length, _ := strconv.Atoi(args[2])
+		// Not start+length < end, which overflows for huge lengths.
+		if length >= 0 && length < end-start {
+			end = start + length
+		}
+	}
+	return string(runes[start:end]), nil
+}
+
+// Returns the n-th (0-based) element of the input string split by a separator,
+// e.g. split("a:b:c", ":", 1) is "b". It's empty if there is no such element.
+func split(args []string) (string, error) {
+	n, _ := strconv.Atoi(args[2])
+	splitted := strings.Split(args[0], args[1])
+	if n < 0 || n >= len(splitted) {
+		return "", nil
+	}
+	return splitted[n], nil
+}
+
+// Replaces all occurrences of a string, e.g. replace("a-b-c", "-", "") is "abc".
+func replace(args []string) (string, error) {
+	return strings.ReplaceAll(args[0], args[1], args[2]), nil
+}
+
+// Returns the first non-empty argument. Missing fields are empty.
+func coalesce(args []string) (string, error) {
+	for _, arg := range args {
+		if arg != "" {
+			return arg, nil
+		}
+	}
+	return "", nil
+}
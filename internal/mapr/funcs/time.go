@@ -0,0 +1,21 @@
+package funcs
+
+import (
+	"strconv"
+	"time"
+)
+
+// Formats Unix epoch seconds as an UTC date, e.g. todate(1633158729) is
+// "2021-10-02T07:12:09Z". The optional second argument is a Go time layout,
+// e.g. todate($epoch, "2006-01-02").
+func toDate(args []string) (string, error) {
+	epoch, _ := strconv.ParseFloat(args[0], 64)
+	sec := int64(epoch)
+	t := time.Unix(sec, int64((epoch-float64(sec))*float64(time.Second))).UTC()
+
+	layout := time.RFC3339
+	if len(args) > 1 {
+		layout = args[1]
+	}
+	return t.Format(layout), nil
+}
@@ -2,6 +2,8 @@ package mapr
 
 import (
 	"fmt"
+
+	"github.com/mimecast/dtail/internal/metrics"
 )
 
 // GlobalGroupSet is used on the dtail client to merge multiple group sets
@@ -86,8 +88,17 @@ func (g *GlobalGroupSet) WriteResult(query *Query, finalResult bool) error {
 }
 
 // Result returns the result of the mapreduce aggregation as a string.
-func (g *GlobalGroupSet) Result(query *Query, rowsLimit int) (string, int, error) {
+func (g *GlobalGroupSet) Result(query *Query, rowsLimit int,
+	format OutputFormat) (string, int, error) {
+
+	g.semaphore <- struct{}{}
+	defer func() { <-g.semaphore }()
+	return g.GroupSet.Result(query, rowsLimit, format)
+}
+
+// Metrics returns the result of the mapreduce aggregation as gauges.
+func (g *GlobalGroupSet) Metrics(query *Query, prefix string) ([]metrics.Family, error) {
 	g.semaphore <- struct{}{}
 	defer func() { <-g.semaphore }()
-	return g.GroupSet.Result(query, rowsLimit)
+	return g.GroupSet.Metrics(query, prefix)
 }
@@ -3,7 +3,7 @@ package mapr
 import (
 	"context"
 	"fmt"
-	"sort"
+	"math"
 	"strconv"
 )
 
@@ -21,7 +21,7 @@ type result struct {
 	groupKey     string
 	values       []string
 	columnWidths []int
-	orderBy      float64
+	orderValues  []string
 }
 
 // NewGroupSet returns a new empty group set.
@@ -66,37 +66,54 @@ func (g *GroupSet) result(query *Query, gathercolumnWidths bool) ([]result, []in
 	// Helpers for calculating the ASCII table output (output is the terminal and
 	// not a CSV file).
 	columnWidths := make([]int, len(query.Select))
-	var valueStrLen int
 
 	for groupKey, set := range g.sets {
 		result := result{groupKey: groupKey}
 
-		for i, sc := range query.Select {
-			if valueStrLen, err = g.resultSelect(query, &sc, set, &result); err != nil {
+		for _, sc := range query.Select {
+			if err = g.resultSelect(query, &sc, set, &result); err != nil {
 				return rows, columnWidths, err
 			}
-
-			// Do we want to gather the table withs? This is required to print out a decent
-			// ASCII formated table (table output is the terminal and not a CSV file).
-			if !gathercolumnWidths {
-				continue
-			}
-			if columnWidths[i] < len(sc.FieldStorage) {
-				columnWidths[i] = len(sc.FieldStorage)
-			}
-			if columnWidths[i] < valueStrLen {
-				columnWidths[i] = valueStrLen
+		}
+		// The having clause can only be evaluated on the fully aggregated values.
+		if !query.HavingClause(result.values) {
+			continue
+		}
+		result.orderValues = query.orderValues(groupKey, result.values)
+
+		// Do we want to gather the table withs? This is required to print out a decent
+		// ASCII formated table (table output is the terminal and not a CSV file).
+		if gathercolumnWidths {
+			for i, sc := range query.Select {
+				if columnWidths[i] < len(sc.FieldStorage) {
+					columnWidths[i] = len(sc.FieldStorage)
+				}
+				if columnWidths[i] < len(result.values[i]) {
+					columnWidths[i] = len(result.values[i])
+				}
 			}
 		}
 		rows = append(rows, result)
 	}
 
-	g.resultOrderBy(query, rows)
+	query.sortResult(rows)
 	return rows, columnWidths, nil
 }
 
-func (*GroupSet) resultSelect(query *Query, sc *selectCondition, set *AggregateSet,
-	result *result) (int, error) {
+func (g *GroupSet) resultSelect(query *Query, sc *selectCondition, set *AggregateSet,
+	result *result) error {
+
+	_, valueStr, err := g.resultValue(query, sc, set)
+	if err != nil {
+		return err
+	}
+	result.values = append(result.values, valueStr)
+
+	return nil
+}
+
+func (g *GroupSet) resultValue(query *Query, sc *selectCondition,
+	set *AggregateSet) (float64, string, error) {
 
 	var valueStr string
 	var value float64
@@ -120,29 +137,42 @@ func (*GroupSet) resultSelect(query *Query, sc *selectCondition, set *AggregateS
 	case Avg:
 		value = set.FValues[sc.FieldStorage] / float64(set.Samples)
 		valueStr = fmt.Sprintf("%f", value)
+	case Percentile:
+		if q, ok := set.QValues[sc.FieldStorage]; ok {
+			value = q.Value(sc.Rank)
+		}
+		valueStr = fmt.Sprintf("%f", value)
+	case DCount:
+		if d, ok := set.DValues[sc.FieldStorage]; ok {
+			value = d.Value()
+		}
+		valueStr = fmt.Sprintf("%d", int(value))
+	case Expression:
+		var ok bool
+		if value, ok = g.resultExpression(query, sc, set); !ok {
+			// E.g. division by zero.
+			value = math.NaN()
+		}
+		valueStr = fmt.Sprintf("%f", value)
 	default:
-		return 0, fmt.Errorf("Unknown aggregation method '%v'", sc.Operation)
+		return 0, "", fmt.Errorf("Unknown aggregation method '%v'", sc.Operation)
 	}
 
-	if sc.FieldStorage == query.OrderBy {
-		result.orderBy = value
-	}
-	result.values = append(result.values, valueStr)
-
-	return len(valueStr), nil
+	return value, valueStr, nil
 }
 
-func (*GroupSet) resultOrderBy(query *Query, rows []result) {
-	if query.OrderBy == "" {
-		return
-	}
-	if query.ReverseOrder {
-		sort.SliceStable(rows, func(i, j int) bool {
-			return rows[i].orderBy < rows[j].orderBy
-		})
-	} else {
-		sort.SliceStable(rows, func(i, j int) bool {
-			return rows[i].orderBy > rows[j].orderBy
-		})
-	}
+// Evaluate an arithmetic expression with the values of its aggregations.
+func (g *GroupSet) resultExpression(query *Query, sc *selectCondition,
+	set *AggregateSet) (float64, bool) {
+
+	return sc.expression.eval(func(operand string) (float64, bool) {
+		for _, aggregation := range query.Aggregations() {
+			if aggregation.FieldStorage != operand {
+				continue
+			}
+			value, _, err := g.resultValue(query, &aggregation, set)
+			return value, err == nil
+		}
+		return 0, false
+	})
 }
@@ -14,8 +14,8 @@ import (
 )
 
 // Result returns a nicely formated result of the query from the group set.
-func (g *GroupSet) Result(query *Query, rowsLimit int) (string, int, error) {
-	rows, columnWidths, err := g.result(query, true)
+func (g *GroupSet) Result(query *Query, rowsLimit int, format OutputFormat) (string, int, error) {
+	rows, columnWidths, err := g.result(query, format == TableOutput)
 	if err != nil {
 		return "", 0, err
 	}
@@ -27,6 +27,12 @@ func (g *GroupSet) Result(query *Query, rowsLimit int) (string, int, error) {
 	sb := pool.BuilderBuffer.Get().(*strings.Builder)
 	defer pool.RecycleBuilderBuffer(sb)
 
+	if format != TableOutput {
+		err := g.resultWriteUnformatted(query, format, defaultCSVDelimiter, sb, rows,
+			rowsLimit, true)
+		return sb.String(), len(rows), err
+	}
+
 	g.resultWriteFormattedHeader(query, sb, lastColumn, rowsLimit, columnWidths)
 	g.resultWriteFormattedHeaderRowSeparator(query, sb, lastColumn, columnWidths)
 	g.resultWriteFormattedData(query, sb, lastColumn, rowsLimit, columnWidths, rows)
@@ -57,7 +63,7 @@ func (g *GroupSet) resultWriteFormattedHeaderEntry(query *Query, sb *strings.Bui
 
 	if config.Client.TermColorsEnable {
 		attrs := []color.Attribute{config.Client.TermColors.MaprTable.HeaderAttr}
-		if sc.FieldStorage == query.OrderBy {
+		if query.isOrderedBy(sc.FieldStorage) {
 			attrs = append(attrs, config.Client.TermColors.MaprTable.HeaderSortKeyAttr)
 		}
 		for _, groupBy := range query.GroupBy {
@@ -175,7 +181,7 @@ func (*GroupSet) writeQueryFile(query *Query) error {
 	return os.Rename(tmpQueryFile, queryFile)
 }
 
-// WriteResult writes the result to an CSV outfile.
+// WriteResult writes the result to an outfile, by default in CSV format.
 func (g *GroupSet) WriteResult(query *Query, finalResult bool) error {
 	if !query.HasOutfile() {
 		return errors.New("No outfile specified")
@@ -188,10 +194,10 @@ func (g *GroupSet) WriteResult(query *Query, finalResult bool) error {
 		return err
 	}
 
-	// By default, also write the CSV header.
+	// By default, also write the header.
 	writeHeader := true
 
-	// In append mode, only write CSV header when file doesn't exist yet or is empty.
+	// In append mode, only write header when file doesn't exist yet or is empty.
 	if query.Outfile.AppendMode {
 		if info, err := os.Stat(query.Outfile.FilePath); err == nil && info.Size() > 0 {
 			writeHeader = false
@@ -204,48 +210,10 @@ func (g *GroupSet) WriteResult(query *Query, finalResult bool) error {
 	}
 	defer fd.Close()
 
-	return g.resultWriteUnformatted(query, rows, fd, writeHeader, finalResult)
-}
-
-func (g *GroupSet) getOutfileFD(query *Query) (*os.File, error) {
-	if !query.Outfile.AppendMode {
-		dlog.Common.Info("Writing to outfile", query.Outfile.FilePath)
-		tmpOutfile := fmt.Sprintf("%s.tmp", query.Outfile.FilePath)
-		return os.OpenFile(tmpOutfile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
-	}
-
-	dlog.Common.Info("Appending to outfile", query.Outfile.FilePath)
-	return os.OpenFile(query.Outfile.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
-}
-
-func (g *GroupSet) resultWriteUnformatted(query *Query, rows []result, fd *os.File, writeHeader, finalResult bool) error {
-	lastColumn := len(query.Select) - 1
-
-	if writeHeader {
-		if err := g.resultWriteUnformattedHeader(query, fd, lastColumn); err != nil {
-			return err
-		}
-	}
-
-	// And now write the data
-	for i, r := range rows {
-		if i == query.Limit {
-			break
-		}
-		for j, value := range r.values {
-			if _, err := fd.WriteString(value); err != nil {
-				return err
-			}
-			if j == lastColumn {
-				continue
-			}
-			if _, err := fd.WriteString(protocol.CSVDelimiter); err != nil {
-				return err
-			}
-		}
-		if _, err := fd.WriteString("\n"); err != nil {
-			return err
-		}
+	err = g.resultWriteUnformatted(query, query.Outfile.Format,
+		query.Outfile.CSVDelimiter, fd, rows, query.Limit, writeHeader)
+	if err != nil {
+		return err
 	}
 
 	if !query.Outfile.AppendMode && finalResult {
@@ -255,22 +223,16 @@ func (g *GroupSet) resultWriteUnformatted(query *Query, rows []result, fd *os.Fi
 			return err
 		}
 	}
-
 	return nil
 }
 
-func (g *GroupSet) resultWriteUnformattedHeader(query *Query, fd *os.File, lastColumn int) (err error) {
-	for i, sc := range query.Select {
-		if _, err = fd.WriteString(sc.FieldStorage); err != nil {
-			return
-		}
-		if i == lastColumn {
-			continue
-		}
-		if _, err = fd.WriteString(protocol.CSVDelimiter); err != nil {
-			return
-		}
+func (g *GroupSet) getOutfileFD(query *Query) (*os.File, error) {
+	if !query.Outfile.AppendMode {
+		dlog.Common.Info("Writing to outfile", query.Outfile.FilePath)
+		tmpOutfile := fmt.Sprintf("%s.tmp", query.Outfile.FilePath)
+		return os.OpenFile(tmpOutfile, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	}
-	_, err = fd.WriteString("\n")
-	return
+
+	dlog.Common.Info("Appending to outfile", query.Outfile.FilePath)
+	return os.OpenFile(query.Outfile.FilePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 }
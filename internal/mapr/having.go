@@ -0,0 +1,47 @@
+package mapr
+
+import (
+	"errors"
+)
+
+// The "having" clause filters the aggregated results (and not the input log
+// lines like the "where" clause does), e.g. 'having count($line) > 100'. It
+// uses the same syntax as the "where" clause, but its fields must be present
+// in the "select" clause.
+func (q *Query) parseHaving() error {
+	for _, wc := range q.Having.conditions() {
+		if wc.lType == Field && !q.isSelected(wc.lString) {
+			return errors.New(invalidQuery + "Can not use '" + wc.lString +
+				"' in 'having' clause, must be present in 'select' clause")
+		}
+		if wc.rType == Field && !q.isSelected(wc.rString) {
+			return errors.New(invalidQuery + "Can not use '" + wc.rString +
+				"' in 'having' clause, must be present in 'select' clause")
+		}
+	}
+	return nil
+}
+
+func (q *Query) isSelected(fieldStorage string) bool {
+	for _, sc := range q.Select {
+		if sc.FieldStorage == fieldStorage {
+			return true
+		}
+	}
+	return false
+}
+
+// HavingClause interprets the having clause of the mapreduce query. The values
+// are the results of the select clause (in the same order).
+func (q *Query) HavingClause(values []string) bool {
+	if q.Having == nil {
+		return true
+	}
+	fields := make(map[string]string, len(q.Select))
+	for i, sc := range q.Select {
+		if i < len(values) {
+			fields[sc.FieldStorage] = values[i]
+		}
+	}
+	return q.Having.eval(fields)
+}
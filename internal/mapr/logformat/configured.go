@@ -0,0 +1,172 @@
+package logformat
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/mimecast/dtail/internal/config"
+)
+
+// The names of the log formats implemented in Go, these can't be configured.
+var builtinLogFormats = [...]string{"generic", "generickv", "csv", "json", "logfmt",
+	"syslog", "regex", "mimecast", "mimecastgeneric", "default", "custom1", "custom2"}
+
+// A log format configured in the LogFormats section of the server config.
+type configuredParser struct {
+	defaultParser
+	format config.LogFormat
+	re     *regexp.Regexp
+	names  []string
+}
+
+func newConfiguredParser(hostname, timeZoneName string, timeZoneOffset int,
+	format config.LogFormat) (*configuredParser, error) {
+
+	defaultParser, err := newDefaultParser(hostname, timeZoneName, timeZoneOffset)
+	if err != nil {
+		return &configuredParser{}, err
+	}
+	if format.TimeField == "" {
+		format.TimeField = "time"
+	}
+
+	p := configuredParser{defaultParser: *defaultParser, format: format}
+	if format.Regex != "" {
+		if p.re, err = regexp.Compile(format.Regex); err != nil {
+			return &p, fmt.Errorf("Unable to compile regex of log format '%s': %w",
+				format.Name, err)
+		}
+		p.names = p.re.SubexpNames()
+	}
+	return &p, nil
+}
+
+// ValidateConfigured checks all configured log formats, so that errors are
+// reported at server start and not only when a query uses the log format.
+func ValidateConfigured(formats []config.LogFormat) error {
+	var errs []error
+	seen := make(map[string]struct{}, len(formats))
+
+	for _, format := range formats {
+		if format.Name == "" {
+			errs = append(errs, errors.New("Configured log format without a name"))
+			continue
+		}
+		if _, ok := seen[format.Name]; ok {
+			errs = append(errs, fmt.Errorf("Log format '%s' configured more than once",
+				format.Name))
+		}
+		seen[format.Name] = struct{}{}
+		for _, name := range builtinLogFormats {
+			if format.Name == name {
+				errs = append(errs, fmt.Errorf("Can't configure built-in log format '%s'", name))
+			}
+		}
+		if _, err := newConfiguredParser("", "", 0, format); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// IsBuiltin returns whether the log format is implemented in Go, and not
+// configured in the server config.
+func IsBuiltin(logFormatName string) bool {
+	for _, name := range builtinLogFormats {
+		if logFormatName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the configured log format of a given name.
+func lookupConfigured(logFormatName string) (config.LogFormat, bool) {
+	if config.Server == nil {
+		return config.LogFormat{}, false
+	}
+	for _, format := range config.Server.LogFormats {
+		if format.Name == logFormatName {
+			return format, true
+		}
+	}
+	return config.LogFormat{}, false
+}
+
+func (p *configuredParser) MakeFields(maprLine string) (map[string]string, error) {
+	fields := make(map[string]string, 16)
+
+	fields["*"] = "*"
+	fields["$line"] = maprLine
+	fields["$empty"] = ""
+	fields["$hostname"] = p.hostname
+	fields["$server"] = p.hostname
+	fields["$timezone"] = p.timeZoneName
+	fields["$timeoffset"] = p.timeZoneOffset
+
+	if p.re != nil {
+		matches := p.re.FindStringSubmatch(maprLine)
+		if matches == nil {
+			// Log line doesn't match the log format.
+			return nil, ErrIgnoreFields
+		}
+		for i, name := range p.names {
+			if name != "" {
+				fields[name] = matches[i]
+			}
+		}
+	} else {
+		p.makeDelimitedFields(maprLine, fields)
+	}
+
+	if p.format.TimeLayout != "" {
+		p.makeTimeFields(fields)
+	}
+	return fields, nil
+}
+
+func (p *configuredParser) makeDelimitedFields(maprLine string, fields map[string]string) {
+	var splitted []string
+	if p.format.FieldDelimiter == "" {
+		splitted = strings.Fields(maprLine)
+	} else {
+		splitted = strings.Split(maprLine, p.format.FieldDelimiter)
+	}
+
+	for i, value := range splitted {
+		if i < len(p.format.Fields) {
+			if name := p.format.Fields[i]; name != "" && name != "-" {
+				fields[name] = value
+			}
+			continue
+		}
+		if p.format.KVSeparator == "" {
+			continue
+		}
+		keyAndValue := strings.SplitN(value, p.format.KVSeparator, 2)
+		if len(keyAndValue) != 2 {
+			continue
+		}
+		fields[keyAndValue[0]] = keyAndValue[1]
+	}
+}
+
+// Add the same date and time fields as the default log format does.
+func (p *configuredParser) makeTimeFields(fields map[string]string) {
+	value, ok := fields[p.format.TimeField]
+	if !ok {
+		return
+	}
+	t, err := time.ParseInLocation(p.format.TimeLayout, value, time.Local)
+	if err != nil {
+		return
+	}
+	fields["$date"] = t.Format("20060102")
+	fields["$hour"] = t.Format("15")
+	fields["$minute"] = t.Format("04")
+	fields["$second"] = t.Format("05")
+	fields["$epoch"] = fmt.Sprintf("%d", t.Unix())
+}
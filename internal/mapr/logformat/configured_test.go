@@ -0,0 +1,100 @@
+package logformat
+
+import (
+	"testing"
+
+	"github.com/mimecast/dtail/internal/config"
+)
+
+func TestConfiguredLogFormat(t *testing.T) {
+	formats := []config.LogFormat{
+		{
+			Name:           "access",
+			FieldDelimiter: " ",
+			KVSeparator:    "=",
+			Fields:         []string{"time", "-", "severity"},
+			TimeLayout:     "2006-01-02T15:04:05",
+		},
+		{
+			Name:  "nginx",
+			Regex: `^(?P<ip>\S+) \S+ \S+ \[[^\]]+\] "(?P<method>\S+) (?P<path>\S+)`,
+		},
+	}
+	if err := ValidateConfigured(formats); err != nil {
+		t.Errorf("Unable to validate log formats: %s", err.Error())
+	}
+
+	oldServer := config.Server
+	defer func() { config.Server = oldServer }()
+	config.Server = &config.ServerConfig{LogFormats: formats}
+
+	parser, err := NewParser("access", nil)
+	if err != nil {
+		t.Errorf("Unable to create parser: %s", err.Error())
+		return
+	}
+	fields, err := parser.MakeFields("2021-10-02T07:23:42 pid=1 WARN status=503 bytes=42")
+	if err != nil {
+		t.Errorf("Parser unable to make fields: %s", err.Error())
+	}
+	expected := map[string]string{
+		"time":     "2021-10-02T07:23:42",
+		"severity": "WARN",
+		"status":   "503",
+		"bytes":    "42",
+		"$date":    "20211002",
+		"$hour":    "07",
+		"$minute":  "23",
+		"$second":  "42",
+	}
+	for name, value := range expected {
+		if fields[name] != value {
+			t.Errorf("Expected field '%s' to be '%s' but got '%s'", name, value, fields[name])
+		}
+	}
+	if _, ok := fields["pid"]; ok {
+		t.Errorf("Expected skipped field 'pid' not to be set")
+	}
+
+	parser, err = NewParser("nginx", nil)
+	if err != nil {
+		t.Errorf("Unable to create parser: %s", err.Error())
+		return
+	}
+	fields, err = parser.MakeFields(`10.0.0.1 - - [02/Oct/2021:07:23:42 +0000] "GET /index.html HTTP/1.1" 200`)
+	if err != nil {
+		t.Errorf("Parser unable to make fields: %s", err.Error())
+	}
+	if fields["path"] != "/index.html" {
+		t.Errorf("Expected field 'path' to be '/index.html' but got '%s'", fields["path"])
+	}
+	if _, err := parser.MakeFields("garbage"); err != ErrIgnoreFields {
+		t.Errorf("Expected non-matching line to be ignored but got '%v'", err)
+	}
+
+	invalidFormats := [][]config.LogFormat{
+		{{Name: ""}},
+		{{Name: "csv"}},
+		{{Name: "foo", Regex: "(unclosed"}},
+		{{Name: "foo"}, {Name: "foo"}},
+	}
+	for _, formats := range invalidFormats {
+		if err := ValidateConfigured(formats); err == nil {
+			t.Errorf("Expected error validating log formats %v", formats)
+		}
+	}
+}
+
+func TestIsBuiltin(t *testing.T) {
+	for name, builtin := range map[string]bool{
+		"generic": true,
+		"json":    true,
+		"regex":   true,
+		"nginx":   false,
+		"":        false,
+	} {
+		if IsBuiltin(name) != builtin {
+			t.Errorf("Expected built-in %v for log format '%s'", builtin, name)
+		}
+	}
+}
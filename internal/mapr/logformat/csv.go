@@ -1,29 +1,43 @@
 package logformat
 
 import (
+	"encoding/csv"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
-
-	"github.com/mimecast/dtail/internal/protocol"
 )
 
+// A record with quoted line breaks spans at most this many log lines.
+const csvMaxRecordLines int = 1000
+
 type csvParser struct {
 	defaultParser
 	header    []string
 	hasHeader bool
+	delimiter rune
+	// The lines of a record with quoted line breaks read so far.
+	pending []string
 }
 
-func newCSVParser(hostname, timeZoneName string, timeZoneOffset int) (*csvParser, error) {
+func newCSVParser(hostname, timeZoneName string, timeZoneOffset int,
+	delimiter rune) (*csvParser, error) {
+
 	defaultParser, err := newDefaultParser(hostname, timeZoneName, timeZoneOffset)
 	if err != nil {
 		return &csvParser{}, err
 	}
-	return &csvParser{defaultParser: *defaultParser}, nil
+	return &csvParser{defaultParser: *defaultParser, delimiter: delimiter}, nil
 }
 
 func (p *csvParser) MakeFields(maprLine string) (map[string]string, error) {
+	record, values, err := p.parseRecord(maprLine)
+	if err != nil {
+		return nil, err
+	}
 	if !p.hasHeader {
-		p.parseHeader(maprLine)
+		p.header = values
+		p.hasHeader = true
 		return nil, ErrIgnoreFields
 	}
 
@@ -31,13 +45,12 @@ func (p *csvParser) MakeFields(maprLine string) (map[string]string, error) {
 	fields["*"] = "*"
 	fields["$hostname"] = p.hostname
 	fields["$server"] = p.hostname
-	fields["$line"] = maprLine
+	fields["$line"] = record
 	fields["$empty"] = ""
 	fields["$timezone"] = p.timeZoneName
 	fields["$timeoffset"] = p.timeZoneOffset
 
-	splitted := strings.Split(maprLine, protocol.CSVDelimiter)
-	for i, value := range splitted {
+	for i, value := range values {
 		if i >= len(p.header) {
 			return fields, fmt.Errorf("CSV file seems corrupted, more fields than header values?")
 		}
@@ -47,7 +60,38 @@ func (p *csvParser) MakeFields(maprLine string) (map[string]string, error) {
 	return fields, nil
 }
 
-func (p *csvParser) parseHeader(maprLine string) {
-	p.header = strings.Split(maprLine, protocol.CSVDelimiter)
-	p.hasHeader = true
+// Parse a RFC 4180 CSV record. A quoted field may contain line breaks, so the
+// record is only complete once all quotes are closed. Records which aren't RFC
+// 4180 compliant (e.g. with a bare quote in an unquoted field) are parsed as
+// good as possible.
+func (p *csvParser) parseRecord(maprLine string) (string, []string, error) {
+	p.pending = append(p.pending, maprLine)
+	record := strings.Join(p.pending, "\n")
+
+	values, err := p.split(record, false)
+	var parseErr *csv.ParseError
+	switch {
+	case err == nil:
+	case errors.Is(err, io.EOF):
+		// Ignore empty lines.
+		p.pending = p.pending[:0]
+		return record, nil, ErrIgnoreFields
+	case errors.As(err, &parseErr) && parseErr.Err == csv.ErrQuote &&
+		strings.Count(record, `"`)%2 == 1 && len(p.pending) < csvMaxRecordLines:
+		// The record continues on the next line.
+		return record, nil, ErrIgnoreFields
+	default:
+		values, err = p.split(record, true)
+	}
+
+	p.pending = p.pending[:0]
+	return record, values, err
+}
+
+func (p *csvParser) split(record string, lazyQuotes bool) ([]string, error) {
+	reader := csv.NewReader(strings.NewReader(record))
+	reader.Comma = p.delimiter
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = lazyQuotes
+	return reader.Read()
 }
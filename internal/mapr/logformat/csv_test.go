@@ -1,12 +1,34 @@
 package logformat
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 
+	"github.com/mimecast/dtail/internal/config"
+	"github.com/mimecast/dtail/internal/io/dlog"
+	"github.com/mimecast/dtail/internal/mapr"
 	"github.com/mimecast/dtail/internal/protocol"
+	"github.com/mimecast/dtail/internal/source"
 )
 
+func TestMain(m *testing.M) {
+	config.Setup(source.Client, &config.Args{ConfigFile: "none", Logger: "none",
+		What: "test"}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	dlog.Start(ctx, &wg, source.Client)
+
+	code := m.Run()
+	cancel()
+	wg.Wait()
+	os.Exit(code)
+}
+
 func TestCSVLogFormat(t *testing.T) {
 	parser, err := NewParser("csv", nil)
 	if err != nil {
@@ -52,3 +74,98 @@ func TestCSVLogFormat(t *testing.T) {
 		t.Errorf("Expected 'color' to be 'Black' but got '%s'", val)
 	}
 }
+
+func TestCSVRoundTrip(t *testing.T) {
+	outfile := filepath.Join(t.TempDir(), "result.csv")
+	for _, delimiter := range []string{"", ";", `\t`} {
+		// Written to an outfile and read back with the same delimiter.
+		queryStr := "select $name, $comment, count($line) group by $name outfile " +
+			`"` + outfile + `"`
+		if delimiter != "" {
+			queryStr += ` "` + delimiter + `"`
+		}
+		queryStr += " logformat csv"
+		if delimiter != "" {
+			queryStr += ` "` + delimiter + `"`
+		}
+		query, err := mapr.NewQuery(queryStr)
+		if err != nil {
+			t.Errorf("Query parse error: %s: %v", queryStr, err)
+			continue
+		}
+
+		comments := map[string]string{
+			"a": `with "quotes", commas; and	tabs`,
+			"b": "with a\nline break",
+			"c": `"quoted"`,
+			"d": "",
+		}
+		group := mapr.NewGroupSet()
+		for name, comment := range comments {
+			set := group.GetSet(name)
+			set.Samples = 1
+			set.SValues["$name"] = name
+			set.SValues["$comment"] = comment
+			set.FValues["count($line)"] = 1
+		}
+		if err := group.WriteResult(query, true); err != nil {
+			t.Errorf("Unable to write CSV outfile: %v", err)
+			continue
+		}
+		data, err := os.ReadFile(outfile)
+		if err != nil {
+			t.Errorf("Unable to read CSV outfile: %v", err)
+			continue
+		}
+		result := string(data)
+
+		// Read the result back line by line like a log file.
+		parser, err := NewParser("csv", query)
+		if err != nil {
+			t.Errorf("Unable to create parser: %s", err.Error())
+			continue
+		}
+		var numRecords int
+		for _, line := range strings.Split(strings.TrimSuffix(result, "\n"), "\n") {
+			fields, err := parser.MakeFields(line)
+			if err == ErrIgnoreFields {
+				continue
+			}
+			if err != nil {
+				t.Errorf("Unable to parse CSV line '%s': %v", line, err)
+				continue
+			}
+			numRecords++
+			if expected := comments[fields["$name"]]; fields["$comment"] != expected {
+				t.Errorf("Expected comment '%s' but got '%s' with delimiter '%s'",
+					expected, fields["$comment"], delimiter)
+			}
+			if fields["count($line)"] != "1" {
+				t.Errorf("Expected count '1' but got '%s'", fields["count($line)"])
+			}
+		}
+		if numRecords != len(comments) {
+			t.Errorf("Expected %d CSV records but got %d with delimiter '%s':\n%s",
+				len(comments), numRecords, delimiter, result)
+		}
+	}
+}
+
+func TestCSVNotCompliant(t *testing.T) {
+	parser, err := NewParser("csv", nil)
+	if err != nil {
+		t.Errorf("Unable to create parser: %s", err.Error())
+	}
+	if _, err := parser.MakeFields("name,size"); err != ErrIgnoreFields {
+		t.Errorf("Unable to parse the CSV header")
+	}
+
+	// A bare quote in an unquoted field.
+	fields, err := parser.MakeFields(`screen,27"`)
+	if err != nil {
+		t.Errorf("Unable to parse CSV line: %v", err)
+	}
+	if fields["size"] != `27"` {
+		t.Errorf("Expected size '27\"' but got '%s'", fields["size"])
+	}
+}
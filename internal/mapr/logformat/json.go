@@ -0,0 +1,76 @@
+package logformat
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type jsonParser struct {
+	defaultParser
+}
+
+func newJSONParser(hostname, timeZoneName string, timeZoneOffset int) (*jsonParser, error) {
+	defaultParser, err := newDefaultParser(hostname, timeZoneName, timeZoneOffset)
+	if err != nil {
+		return &jsonParser{}, err
+	}
+	return &jsonParser{defaultParser: *defaultParser}, nil
+}
+
+func (p *jsonParser) MakeFields(maprLine string) (map[string]string, error) {
+	if !strings.HasPrefix(maprLine, "{") {
+		// Not a JSON object log line.
+		return nil, ErrIgnoreFields
+	}
+
+	var object map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(maprLine))
+	// Keep numbers as they are, e.g. don't turn large integers into 1.2e+06.
+	decoder.UseNumber()
+	if err := decoder.Decode(&object); err != nil {
+		return nil, ErrIgnoreFields
+	}
+
+	fields := make(map[string]string, 7+len(object))
+	fields["*"] = "*"
+	fields["$line"] = maprLine
+	fields["$empty"] = ""
+	fields["$hostname"] = p.hostname
+	fields["$server"] = p.hostname
+	fields["$timezone"] = p.timeZoneName
+	fields["$timeoffset"] = p.timeZoneOffset
+
+	p.flatten(fields, "", object)
+	return fields, nil
+}
+
+// Flatten nested objects and arrays into dotted field names, e.g.
+// {"http":{"status":200}} becomes the field "http.status".
+func (p *jsonParser) flatten(fields map[string]string, prefix string, value interface{}) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			p.flatten(fields, p.key(prefix, key), child)
+		}
+	case []interface{}:
+		for i, child := range v {
+			p.flatten(fields, p.key(prefix, fmt.Sprintf("%d", i)), child)
+		}
+	case json.Number:
+		fields[prefix] = v.String()
+	case string:
+		fields[prefix] = v
+	case bool:
+		fields[prefix] = fmt.Sprintf("%t", v)
+	case nil:
+		fields[prefix] = ""
+	}
+}
+
+func (*jsonParser) key(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
@@ -0,0 +1,50 @@
+package logformat
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestJSONLogFormat(t *testing.T) {
+	parser, err := NewParser("json", nil)
+	if err != nil {
+		t.Errorf("Unable to create parser: %s", err.Error())
+	}
+
+	input := `{"level":"error","latency":12.5,"bytes":1234567890,` +
+		`"http":{"status":503,"path":"/api"},"tags":["a","b"],"cached":false,"user":null}`
+	fields, err := parser.MakeFields(input)
+	if err != nil {
+		t.Errorf("Parser unable to make fields: %s", err.Error())
+	}
+
+	expected := map[string]string{
+		"level":       "error",
+		"latency":     "12.5",
+		"bytes":       "1234567890",
+		"http.status": "503",
+		"http.path":   "/api",
+		"tags.0":      "a",
+		"tags.1":      "b",
+		"cached":      "false",
+		"user":        "",
+		"$line":       input,
+	}
+	for name, value := range expected {
+		if fields[name] != value {
+			t.Errorf("Expected field '%s' to be '%s' but got '%s'", name, value, fields[name])
+		}
+	}
+	if _, err := strconv.ParseFloat(fields["http.status"], 64); err != nil {
+		t.Errorf("Expected field 'http.status' to be a float: %s", err.Error())
+	}
+	if _, ok := fields["$hostname"]; !ok {
+		t.Errorf("Expected field '$hostname' to be set")
+	}
+
+	for _, input := range []string{"plain text line", `{"broken":`, `["not","an","object"]`} {
+		if _, err := parser.MakeFields(input); err != ErrIgnoreFields {
+			t.Errorf("Expected line '%s' to be ignored but got '%v'", input, err)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package logformat
+
+import (
+	"strings"
+)
+
+type logfmtParser struct {
+	defaultParser
+}
+
+func newLogfmtParser(hostname, timeZoneName string, timeZoneOffset int) (*logfmtParser, error) {
+	defaultParser, err := newDefaultParser(hostname, timeZoneName, timeZoneOffset)
+	if err != nil {
+		return &logfmtParser{}, err
+	}
+	return &logfmtParser{defaultParser: *defaultParser}, nil
+}
+
+func (p *logfmtParser) MakeFields(maprLine string) (map[string]string, error) {
+	fields := make(map[string]string, 16)
+
+	fields["*"] = "*"
+	fields["$line"] = maprLine
+	fields["$empty"] = ""
+	fields["$hostname"] = p.hostname
+	fields["$server"] = p.hostname
+	fields["$timezone"] = p.timeZoneName
+	fields["$timeoffset"] = p.timeZoneOffset
+
+	if !parseLogfmt(maprLine, fields) {
+		// Not a single key-value pair found, not a logfmt log line.
+		return nil, ErrIgnoreFields
+	}
+	return fields, nil
+}
+
+// Parse logfmt key-value pairs, e.g. 'level=info msg="hello world" debug', into
+// fields. Values may be quoted, keys without any value are set to "true".
+// Returns false if there isn't any key=value pair, e.g. a plain text line.
+func parseLogfmt(line string, fields map[string]string) bool {
+	var found bool
+
+	for i := 0; i < len(line); {
+		// Skip whitespaces between the pairs.
+		if line[i] == ' ' || line[i] == '\t' {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(line) && line[i] != '=' && line[i] != ' ' && line[i] != '\t' {
+			i++
+		}
+		key := line[start:i]
+		if i >= len(line) || line[i] != '=' {
+			// A bare word, doesn't make it a logfmt line on its own.
+			fields[key] = "true"
+			continue
+		}
+		i++ // Skip '='
+
+		var value string
+		value, i = parseLogfmtValue(line, i)
+		if key != "" {
+			fields[key] = value
+			found = true
+		}
+	}
+	return found
+}
+
+func parseLogfmtValue(line string, i int) (string, int) {
+	if i >= len(line) || line[i] != '"' {
+		start := i
+		for i < len(line) && line[i] != ' ' && line[i] != '\t' {
+			i++
+		}
+		return line[start:i], i
+	}
+
+	// Quoted value, unescape \" and \\ (and all other escaped characters).
+	var sb strings.Builder
+	for i++; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			if i+1 < len(line) {
+				i++
+				switch line[i] {
+				case 'n':
+					sb.WriteByte('\n')
+				case 't':
+					sb.WriteByte('\t')
+				default:
+					sb.WriteByte(line[i])
+				}
+			}
+		case '"':
+			return sb.String(), i + 1
+		default:
+			sb.WriteByte(line[i])
+		}
+	}
+	// Unterminated quote, take everything until the end of the line.
+	return sb.String(), i
+}
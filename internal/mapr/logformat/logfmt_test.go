@@ -0,0 +1,44 @@
+package logformat
+
+import (
+	"testing"
+)
+
+func TestLogfmtLogFormat(t *testing.T) {
+	parser, err := NewParser("logfmt", nil)
+	if err != nil {
+		t.Errorf("Unable to create parser: %s", err.Error())
+	}
+
+	input := `time=2021-10-02T07:23:42Z level=warn msg="disk \"sda\" is full, a=b" ` +
+		`duration=1.5 dry_run empty= path=/var/log`
+	fields, err := parser.MakeFields(input)
+	if err != nil {
+		t.Errorf("Parser unable to make fields: %s", err.Error())
+	}
+
+	expected := map[string]string{
+		"time":     "2021-10-02T07:23:42Z",
+		"level":    "warn",
+		"msg":      `disk "sda" is full, a=b`,
+		"duration": "1.5",
+		"dry_run":  "true",
+		"empty":    "",
+		"path":     "/var/log",
+		"$line":    input,
+	}
+	for name, value := range expected {
+		if val, ok := fields[name]; !ok || val != value {
+			t.Errorf("Expected field '%s' to be '%s' but got '%s'", name, value, val)
+		}
+	}
+	if _, ok := fields["a"]; ok {
+		t.Errorf("Expected no field 'a' from within a quoted value")
+	}
+
+	for _, input := range []string{"   ", "Just a plain text log line", "= foo"} {
+		if _, err := parser.MakeFields(input); err != ErrIgnoreFields {
+			t.Errorf("Expected line '%s' to be ignored but got '%v'", input, err)
+		}
+	}
+}
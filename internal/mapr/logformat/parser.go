@@ -4,9 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"time"
+	"unicode/utf8"
 
 	"github.com/mimecast/dtail/internal/config"
 	"github.com/mimecast/dtail/internal/mapr"
+	"github.com/mimecast/dtail/internal/protocol"
 )
 
 // ErrIgnoreFields indicates that the fields should be ignored.
@@ -34,7 +36,17 @@ func NewParser(logFormatName string, query *mapr.Query) (Parser, error) {
 	case "generickv":
 		return newGenericKVParser(hostname, timeZoneName, timeZoneOffset)
 	case "csv":
-		return newCSVParser(hostname, timeZoneName, timeZoneOffset)
+		delimiter, _ := utf8.DecodeRuneInString(protocol.CSVDelimiter)
+		if query != nil && query.CSVDelimiter != 0 {
+			delimiter = query.CSVDelimiter
+		}
+		return newCSVParser(hostname, timeZoneName, timeZoneOffset, delimiter)
+	case "json":
+		return newJSONParser(hostname, timeZoneName, timeZoneOffset)
+	case "logfmt":
+		return newLogfmtParser(hostname, timeZoneName, timeZoneOffset)
+	case "syslog":
+		return newSyslogParser(hostname, timeZoneName, timeZoneOffset)
 	case "mimecast":
 		return newMimecastParser(hostname, timeZoneName, timeZoneOffset)
 	case "mimecastgeneric":
@@ -45,7 +57,15 @@ func NewParser(logFormatName string, query *mapr.Query) (Parser, error) {
 		return newCustom1Parser(hostname, timeZoneName, timeZoneOffset)
 	case "custom2":
 		return newCustom2Parser(hostname, timeZoneName, timeZoneOffset)
+	case "regex":
+		if query == nil || query.LogFormatRegex == "" {
+			return nil, errors.New("The 'regex' mapr log format requires a regex")
+		}
+		return newRegexParser(hostname, timeZoneName, timeZoneOffset, query.LogFormatRegex)
 	default:
+		if format, ok := lookupConfigured(logFormatName); ok {
+			return newConfiguredParser(hostname, timeZoneName, timeZoneOffset, format)
+		}
 		p, err := newDefaultParser(hostname, timeZoneName, timeZoneOffset)
 		if err != nil {
 			return p, fmt.Errorf("No '%s' mapr log format and problem creating default one: %v",
@@ -0,0 +1,56 @@
+package logformat
+
+import (
+	"regexp"
+)
+
+type regexParser struct {
+	defaultParser
+	re    *regexp.Regexp
+	names []string
+}
+
+func newRegexParser(hostname, timeZoneName string, timeZoneOffset int,
+	pattern string) (*regexParser, error) {
+
+	defaultParser, err := newDefaultParser(hostname, timeZoneName, timeZoneOffset)
+	if err != nil {
+		return &regexParser{}, err
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return &regexParser{}, err
+	}
+	return &regexParser{
+		defaultParser: *defaultParser,
+		re:            re,
+		names:         re.SubexpNames(),
+	}, nil
+}
+
+func (p *regexParser) MakeFields(maprLine string) (map[string]string, error) {
+	matches := p.re.FindStringSubmatch(maprLine)
+	if matches == nil {
+		// Log line doesn't match the log format.
+		return nil, ErrIgnoreFields
+	}
+
+	fields := make(map[string]string, 7+len(matches))
+	fields["*"] = "*"
+	fields["$line"] = maprLine
+	fields["$empty"] = ""
+	fields["$hostname"] = p.hostname
+	fields["$server"] = p.hostname
+	fields["$timezone"] = p.timeZoneName
+	fields["$timeoffset"] = p.timeZoneOffset
+
+	// Every named capture group becomes a field.
+	for i, name := range p.names {
+		if name == "" {
+			continue
+		}
+		fields[name] = matches[i]
+	}
+
+	return fields, nil
+}
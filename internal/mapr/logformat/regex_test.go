@@ -0,0 +1,50 @@
+package logformat
+
+import (
+	"testing"
+
+	"github.com/mimecast/dtail/internal/mapr"
+)
+
+func TestRegexLogFormat(t *testing.T) {
+	queryStr := "select count($line), avg(latency) group by status logformat regex " +
+		"\"^(?P<ip>[0-9.]+) - (?P<method>[A-Z]+) (?P<path>\\S+) (?P<status>\\d{3}) (?P<latency>\\d+)ms$\""
+	query, err := mapr.NewQuery(queryStr)
+	if err != nil {
+		t.Errorf("Unable to parse query: %s: %s", queryStr, err.Error())
+		return
+	}
+
+	parser, err := NewParser("regex", query)
+	if err != nil {
+		t.Errorf("Unable to create parser: %s", err.Error())
+		return
+	}
+
+	input := "10.1.2.3 - GET /api/v1/users 503 1234ms"
+	fields, err := parser.MakeFields(input)
+	if err != nil {
+		t.Errorf("Parser unable to make fields: %s", err.Error())
+	}
+	expected := map[string]string{
+		"ip":      "10.1.2.3",
+		"method":  "GET",
+		"path":    "/api/v1/users",
+		"status":  "503",
+		"latency": "1234",
+		"$line":   input,
+	}
+	for name, value := range expected {
+		if fields[name] != value {
+			t.Errorf("Expected field '%s' to be '%s' but got '%s'", name, value, fields[name])
+		}
+	}
+
+	if _, err := parser.MakeFields("not an access log line"); err != ErrIgnoreFields {
+		t.Errorf("Expected non-matching line to be ignored but got '%v'", err)
+	}
+
+	if _, err := NewParser("regex", nil); err == nil {
+		t.Errorf("Expected error creating 'regex' parser without a regex")
+	}
+}
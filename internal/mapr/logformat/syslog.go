@@ -0,0 +1,206 @@
+package logformat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var syslogSeverities = [...]string{"emerg", "alert", "crit", "err", "warning",
+	"notice", "info", "debug"}
+
+var syslogFacilities = [...]string{"kern", "user", "mail", "daemon", "auth",
+	"syslog", "lpr", "news", "uucp", "cron", "authpriv", "ftp", "ntp", "security",
+	"console", "solaris-cron", "local0", "local1", "local2", "local3", "local4",
+	"local5", "local6", "local7"}
+
+// The syslog parser understands RFC 5424 and RFC 3164 (BSD) syslog lines. The
+// <PRI> part is optional, as it usually isn't written to the files under /var/log.
+type syslogParser struct {
+	defaultParser
+}
+
+func newSyslogParser(hostname, timeZoneName string, timeZoneOffset int) (*syslogParser, error) {
+	defaultParser, err := newDefaultParser(hostname, timeZoneName, timeZoneOffset)
+	if err != nil {
+		return &syslogParser{}, err
+	}
+	return &syslogParser{defaultParser: *defaultParser}, nil
+}
+
+func (p *syslogParser) MakeFields(maprLine string) (map[string]string, error) {
+	fields := make(map[string]string, 20)
+
+	fields["*"] = "*"
+	fields["$line"] = maprLine
+	fields["$empty"] = ""
+	fields["$hostname"] = p.hostname
+	fields["$server"] = p.hostname
+	fields["$timezone"] = p.timeZoneName
+	fields["$timeoffset"] = p.timeZoneOffset
+
+	rest, err := p.parsePriority(maprLine, fields)
+	if err != nil {
+		return nil, ErrIgnoreFields
+	}
+	if strings.HasPrefix(rest, "1 ") {
+		err = p.parseRFC5424(rest[2:], fields)
+	} else {
+		err = p.parseRFC3164(rest, fields)
+	}
+	if err != nil {
+		return nil, ErrIgnoreFields
+	}
+	return fields, nil
+}
+
+// Decode the optional <PRI> into facility and severity.
+func (p *syslogParser) parsePriority(line string, fields map[string]string) (string, error) {
+	if !strings.HasPrefix(line, "<") {
+		return line, nil
+	}
+	end := strings.IndexByte(line, '>')
+	if end < 2 || end > 4 {
+		return line, fmt.Errorf("invalid syslog priority in '%s'", line)
+	}
+	priority, err := strconv.Atoi(line[1:end])
+	if err != nil || priority > 191 {
+		return line, fmt.Errorf("invalid syslog priority in '%s'", line)
+	}
+
+	facility, severity := priority/8, priority%8
+	fields["$priority"] = line[1:end]
+	fields["$facilitycode"] = fmt.Sprintf("%d", facility)
+	fields["$facility"] = syslogFacilities[facility]
+	fields["$severitycode"] = fmt.Sprintf("%d", severity)
+	fields["$severity"] = syslogSeverities[severity]
+	fields["$loglevel"] = syslogSeverities[severity]
+
+	return line[end+1:], nil
+}
+
+// Example: 2003-10-11T22:14:15.003Z host app 123 ID47 [id foo="bar"] message
+func (p *syslogParser) parseRFC5424(line string, fields map[string]string) error {
+	parts := strings.SplitN(line, " ", 6)
+	if len(parts) < 6 {
+		return fmt.Errorf("not enough fields in RFC 5424 syslog line '%s'", line)
+	}
+
+	nilValue := func(value string) string {
+		if value == "-" {
+			return ""
+		}
+		return value
+	}
+	fields["$version"] = "1"
+	fields["$time"] = nilValue(parts[0])
+	fields["$loghost"] = nilValue(parts[1])
+	fields["$appname"] = nilValue(parts[2])
+	fields["$procid"] = nilValue(parts[3])
+	fields["$msgid"] = nilValue(parts[4])
+
+	message, err := p.parseStructuredData(parts[5], fields)
+	if err != nil {
+		return err
+	}
+	// The message may start with an UTF-8 byte order mark.
+	fields["$message"] = strings.TrimPrefix(message, "\ufeff")
+	return nil
+}
+
+// Parse the structured data elements, e.g. '[id@1 foo="bar" baz="\]"][id2 ...]'.
+// Each parameter becomes a field named "id@1.foo". Returns the remaining message.
+func (p *syslogParser) parseStructuredData(line string, fields map[string]string) (string, error) {
+	if strings.HasPrefix(line, "-") {
+		return strings.TrimPrefix(line[1:], " "), nil
+	}
+
+	i := 0
+	for i < len(line) && line[i] == '[' {
+		i++
+		start := i
+		for i < len(line) && line[i] != ' ' && line[i] != ']' {
+			i++
+		}
+		id := line[start:i]
+
+		for i < len(line) && line[i] != ']' {
+			i++ // Skip ' '
+			start = i
+			for i < len(line) && line[i] != '=' {
+				i++
+			}
+			if i+1 >= len(line) || line[i+1] != '"' {
+				return "", fmt.Errorf("invalid structured data in '%s'", line)
+			}
+			name := line[start:i]
+
+			var sb strings.Builder
+			for i += 2; i < len(line) && line[i] != '"'; i++ {
+				if line[i] == '\\' && i+1 < len(line) {
+					i++
+				}
+				sb.WriteByte(line[i])
+			}
+			if i >= len(line) {
+				return "", fmt.Errorf("unterminated structured data in '%s'", line)
+			}
+			fields[id+"."+name] = sb.String()
+			i++ // Skip '"'
+		}
+		if i >= len(line) {
+			return "", fmt.Errorf("unterminated structured data in '%s'", line)
+		}
+		i++ // Skip ']'
+	}
+	if i == 0 {
+		return "", fmt.Errorf("invalid structured data in '%s'", line)
+	}
+
+	return strings.TrimPrefix(line[i:], " "), nil
+}
+
+// Example: Oct 11 22:14:15 mymachine su[123]: 'su root' failed on /dev/pts/8
+func (p *syslogParser) parseRFC3164(line string, fields map[string]string) error {
+	// Some syslog daemons write RFC 3339 timestamps instead of the BSD ones.
+	var rest string
+	if timestamp, r, ok := strings.Cut(line, " "); ok && p.isRFC3339(timestamp) {
+		fields["$time"] = timestamp
+		rest = r
+	} else {
+		if len(line) < 16 || line[15] != ' ' {
+			return fmt.Errorf("no timestamp in RFC 3164 syslog line '%s'", line)
+		}
+		if _, err := time.Parse(time.Stamp, line[0:15]); err != nil {
+			return err
+		}
+		fields["$time"] = line[0:15]
+		rest = line[16:]
+	}
+
+	loghost, rest, ok := strings.Cut(rest, " ")
+	if !ok {
+		return fmt.Errorf("no hostname in RFC 3164 syslog line '%s'", line)
+	}
+	fields["$loghost"] = loghost
+
+	// The tag, e.g. "su[123]:", is optional.
+	tag, message, ok := strings.Cut(rest, ": ")
+	if !ok || strings.ContainsAny(tag, " \t") {
+		fields["$message"] = rest
+		return nil
+	}
+	if index := strings.IndexByte(tag, '['); index > 0 && strings.HasSuffix(tag, "]") {
+		fields["$procid"] = tag[index+1 : len(tag)-1]
+		tag = tag[0:index]
+	}
+	fields["$appname"] = tag
+	fields["$message"] = message
+	return nil
+}
+
+func (*syslogParser) isRFC3339(timestamp string) bool {
+	_, err := time.Parse(time.RFC3339Nano, timestamp)
+	return err == nil
+}
@@ -0,0 +1,85 @@
+package logformat
+
+import (
+	"testing"
+)
+
+func TestSyslogLogFormat(t *testing.T) {
+	parser, err := NewParser("syslog", nil)
+	if err != nil {
+		t.Errorf("Unable to create parser: %s", err.Error())
+	}
+
+	testTable := map[string]map[string]string{
+		// RFC 5424 with structured data
+		`<165>1 2003-10-11T22:14:15.003Z mymachine.example.com evntslog - ID47 ` +
+			`[exampleSDID@32473 iut="3" eventSource="App \"lication\""][meta x="\]"] ` +
+			`An application event`: {
+			"$priority":                     "165",
+			"$facility":                     "local4",
+			"$facilitycode":                 "20",
+			"$severity":                     "notice",
+			"$severitycode":                 "5",
+			"$time":                         "2003-10-11T22:14:15.003Z",
+			"$loghost":                      "mymachine.example.com",
+			"$appname":                      "evntslog",
+			"$procid":                       "",
+			"$msgid":                        "ID47",
+			"exampleSDID@32473.iut":         "3",
+			"exampleSDID@32473.eventSource": `App "lication"`,
+			"meta.x":                        "]",
+			"$message":                      "An application event",
+		},
+		// RFC 5424 without structured data
+		`<34>1 2003-10-11T22:14:15Z host su 42 - - 'su root' failed`: {
+			"$facility": "auth",
+			"$severity": "crit",
+			"$procid":   "42",
+			"$message":  "'su root' failed",
+		},
+		// RFC 3164
+		`<34>Oct 11 22:14:15 mymachine su[123]: 'su root' failed for lonvick`: {
+			"$facility": "auth",
+			"$severity": "crit",
+			"$time":     "Oct 11 22:14:15",
+			"$loghost":  "mymachine",
+			"$appname":  "su",
+			"$procid":   "123",
+			"$message":  "'su root' failed for lonvick",
+		},
+		// RFC 3164 as written to /var/log (no priority)
+		`Feb  3 08:01:02 web01 CRON: (root) CMD (run-parts /etc/cron.hourly)`: {
+			"$time":    "Feb  3 08:01:02",
+			"$loghost": "web01",
+			"$appname": "CRON",
+			"$message": "(root) CMD (run-parts /etc/cron.hourly)",
+		},
+		// RFC 3339 timestamps as written by rsyslog
+		`2021-10-02T07:23:42.123456+00:00 web01 kernel: Out of memory`: {
+			"$time":    "2021-10-02T07:23:42.123456+00:00",
+			"$loghost": "web01",
+			"$appname": "kernel",
+			"$message": "Out of memory",
+		},
+	}
+
+	for input, expected := range testTable {
+		fields, err := parser.MakeFields(input)
+		if err != nil {
+			t.Errorf("Parser unable to make fields of '%s': %s", input, err.Error())
+			continue
+		}
+		for name, value := range expected {
+			if val, ok := fields[name]; !ok || val != value {
+				t.Errorf("Expected field '%s' to be '%s' but got '%s': %s",
+					name, value, val, input)
+			}
+		}
+	}
+
+	for _, input := range []string{"not syslog", "<999>1 foo", `<13>1 2003-10-11T22:14:15Z h a - - [x y="z`} {
+		if _, err := parser.MakeFields(input); err != ErrIgnoreFields {
+			t.Errorf("Expected line '%s' to be ignored but got '%v'", input, err)
+		}
+	}
+}
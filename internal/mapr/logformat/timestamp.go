@@ -0,0 +1,95 @@
+package logformat
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mimecast/dtail/internal/mapr"
+	"github.com/mimecast/dtail/internal/protocol"
+)
+
+// The fields checked (in this order) for the timestamp of a log line.
+var timestampFields = [...]string{"$epoch", "$time", "time", "timestamp", "@timestamp", "ts"}
+
+// Timestamper extracts the timestamps of the log lines of a log format. It's
+// used to skip all log lines outside of a time range (e.g. dgrep -since).
+type Timestamper struct {
+	parser Parser
+}
+
+// NewTimestamper returns a timestamper for the given log format. On error, the
+// timestamper is still usable but only guesses the timestamps.
+func NewTimestamper(logFormatName string, query *mapr.Query) (Timestamper, error) {
+	parser, err := NewParser(logFormatName, query)
+	return Timestamper{parser: parser}, err
+}
+
+// Timestamp returns the time of a log line, or false if the line has none
+// (e.g. a stack trace line following the actual log line).
+func (t Timestamper) Timestamp(line string) (time.Time, bool) {
+	switch t.parser.(type) {
+	case *jsonParser, *logfmtParser, *syslogParser, *regexParser, *configuredParser:
+		if ts, ok := t.fieldsTimestamp(line); ok {
+			return ts, true
+		}
+	}
+	return guessTimestamp(line)
+}
+
+// Log formats with structured fields know where their timestamps are.
+func (t Timestamper) fieldsTimestamp(line string) (time.Time, bool) {
+	fields, err := t.parser.MakeFields(line)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	names := timestampFields[:]
+	if p, ok := t.parser.(*configuredParser); ok {
+		names = append([]string{p.format.TimeField}, names...)
+	}
+	for _, name := range names {
+		if value, ok := fields[name]; ok && value != "" {
+			if ts, ok := mapr.ParseTimestamp(value); ok {
+				return ts, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// Guess the timestamp from the beginning of a log line. Understood are the
+// DTail default log format, lines starting with a timestamp (e.g. syslog or
+// "2023-01-30 10:00:00,123 ...") and the common log format.
+func guessTimestamp(line string) (time.Time, bool) {
+	var candidates []string
+
+	if splitted := strings.SplitN(line, protocol.FieldDelimiter, 3); len(splitted) == 3 {
+		candidates = append(candidates, splitted[1])
+	}
+	if len(line) >= len(time.Stamp) {
+		candidates = append(candidates, line[0:len(time.Stamp)])
+	}
+	if splitted := strings.SplitN(line, " ", 3); len(splitted) > 1 {
+		candidates = append(candidates, splitted[0]+" "+splitted[1], splitted[0])
+	} else {
+		candidates = append(candidates, line)
+	}
+	if i := strings.IndexByte(line, '['); i >= 0 {
+		if j := strings.IndexByte(line[i:], ']'); j > 0 {
+			candidates = append(candidates, line[i+1:i+j])
+		}
+	}
+
+	for _, candidate := range candidates {
+		candidate = strings.Trim(candidate, "[]")
+		if epoch, err := strconv.ParseFloat(candidate, 64); err == nil && epoch < 1e9 {
+			// Just some number, not a Unix epoch of this millennium.
+			continue
+		}
+		if ts, ok := mapr.ParseTimestamp(candidate); ok {
+			return ts, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,48 @@
+package logformat
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTimestamp(t *testing.T) {
+	expected := time.Date(2023, 1, 30, 10, 0, 5, 0, time.Local)
+
+	inputs := []struct {
+		logFormat string
+		line      string
+	}{
+		{"default", "INFO|20230130-100005|1|caller.go:1|8|13|7|0.21|471h0m21s|MAPREDUCE:STATS|foo=1"},
+		{"generic", "2023-01-30 10:00:05,123 ERROR Something went wrong"},
+		{"generic", "2023-01-30T10:00:05 ERROR Something went wrong"},
+		{"generic", `127.0.0.1 - - [30/Jan/2023:10:00:05 ` +
+			expected.Format("-0700") + `] "GET / HTTP/1.1" 200 2326`},
+		{"json", `{"level":"info","time":"` + expected.Format(time.RFC3339) + `"}`},
+		{"json", `{"level":"info","ts":` + strconv.FormatInt(expected.Unix(), 10) + `}`},
+		{"logfmt", `level=info time="2023-01-30 10:00:05" msg="Hello"`},
+	}
+
+	for _, input := range inputs {
+		timestamper, err := NewTimestamper(input.logFormat, nil)
+		if err != nil {
+			t.Errorf("Unable to create timestamper: %s", err.Error())
+		}
+		got, ok := timestamper.Timestamp(input.line)
+		if !ok {
+			t.Errorf("Expected a timestamp in '%s' line '%s'", input.logFormat, input.line)
+			continue
+		}
+		if !got.Truncate(time.Second).Equal(expected) {
+			t.Errorf("Expected timestamp %v in '%s' line '%s' but got %v",
+				expected, input.logFormat, input.line, got)
+		}
+	}
+
+	timestamper, _ := NewTimestamper("generic", nil)
+	for _, line := range []string{"\tat com.example.Foo(Foo.java:42)", "42 is the answer", ""} {
+		if got, ok := timestamper.Timestamp(line); ok {
+			t.Errorf("Expected no timestamp in line '%s' but got %v", line, got)
+		}
+	}
+}
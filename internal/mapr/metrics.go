@@ -0,0 +1,115 @@
+package mapr
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/mimecast/dtail/internal/metrics"
+	"github.com/mimecast/dtail/internal/protocol"
+)
+
+// Metrics returns the result as gauges, e.g. to publish the results of the
+// continuous mapr jobs. Each aggregation becomes a gauge named after the
+// prefix and the aggregation (e.g. "dtail_myjob_count_line") and the group by
+// fields become its labels.
+func (g *GroupSet) Metrics(query *Query, prefix string) ([]metrics.Family, error) {
+	familyNames, indices, labelNames, err := query.metricNames(prefix)
+	if err != nil {
+		return nil, err
+	}
+	families := make([]metrics.Family, len(familyNames))
+	for i, name := range familyNames {
+		sc := query.Select[indices[i]]
+		families[i] = metrics.Family{
+			Name: name,
+			Help: fmt.Sprintf("Result of %s of query: %s", sc.FieldStorage, query.RawQuery),
+			Type: metrics.GaugeType,
+		}
+	}
+
+	for groupKey, set := range g.sets {
+		var result result
+		values := make([]float64, len(query.Select))
+		for i, sc := range query.Select {
+			value, valueStr, err := g.resultValue(query, &sc, set)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+			result.values = append(result.values, valueStr)
+		}
+		if !query.HavingClause(result.values) {
+			continue
+		}
+
+		var labels []metrics.Label
+		if len(labelNames) > 0 {
+			groupValues := strings.Split(groupKey, protocol.AggregateGroupKeyCombinator)
+			for i, labelName := range labelNames {
+				var labelValue string
+				if i < len(groupValues) {
+					labelValue = groupValues[i]
+				}
+				labels = append(labels, metrics.Label{Name: labelName, Value: labelValue})
+			}
+		}
+		for i, index := range indices {
+			families[i].Samples = append(families[i].Samples,
+				metrics.Sample{Labels: labels, Value: values[index]})
+		}
+	}
+
+	for _, family := range families {
+		metrics.SortSamples(family.Samples)
+	}
+	return families, nil
+}
+
+// ValidateMetrics checks whether the result can be published as gauges with
+// the prefix, see Metrics.
+func (q *Query) ValidateMetrics(prefix string) error {
+	_, _, _, err := q.metricNames(prefix)
+	return err
+}
+
+// Returns the names of the gauges of the aggregations (and the indices of the
+// aggregations in the select clause) and the names of their labels. Different
+// fields can have the same sanitized name (e.g. $a.b and $a_b), which is an
+// error as their metrics would overwrite each other.
+func (q *Query) metricNames(prefix string) (familyNames []string, indices []int,
+	labelNames []string, err error) {
+
+	var fields []string
+	for i, sc := range q.Select {
+		// Only aggregations are numbers, plain fields are strings.
+		if sc.Operation == Last {
+			continue
+		}
+		familyNames = append(familyNames,
+			metrics.SanitizeName(fmt.Sprintf("dtail_%s_%s", prefix, sc.FieldStorage)))
+		fields = append(fields, sc.FieldStorage)
+		indices = append(indices, i)
+	}
+	if err = checkUniqueNames("metric", familyNames, fields); err != nil {
+		return
+	}
+
+	labelNames = make([]string, len(q.GroupBy))
+	for i, field := range q.GroupBy {
+		labelNames[i] = metrics.SanitizeName(field)
+	}
+	err = checkUniqueNames("label", labelNames, q.GroupBy)
+	return
+}
+
+func checkUniqueNames(kind string, names, fields []string) error {
+	seen := make(map[string]string, len(names))
+	for i, name := range names {
+		if field, ok := seen[name]; ok {
+			return fmt.Errorf("Fields '%s' and '%s' have the same %s name '%s'",
+				field, fields[i], kind, name)
+		}
+		seen[name] = fields[i]
+	}
+	return nil
+}
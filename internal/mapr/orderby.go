@@ -0,0 +1,154 @@
+package mapr
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mimecast/dtail/internal/protocol"
+)
+
+// Represents a single sort key of the "order by" clause, e.g. 'count($line) desc'.
+type orderCondition struct {
+	// Field is either a field of the "select" or of the "group by" clause.
+	Field      string
+	Descending bool
+	// Index of the field in the "select" clause, -1 if not selected.
+	selectIndex int
+	// Index of the field in the "group by" clause, -1 if not grouped by.
+	groupIndex int
+}
+
+func (oc orderCondition) String() string {
+	return fmt.Sprintf("orderCondition(Field:%s,Descending:%v)", oc.Field, oc.Descending)
+}
+
+// Parse the sort keys of the "order by" clause, e.g. 'count($line) desc,
+// $hostname asc'. Keys without a direction are sorted descending for "order
+// by" and ascending for "rorder by".
+func makeOrderConditions(tokens []token, descending bool) ([]orderCondition, error) {
+	var conditions []orderCondition
+	for _, t := range tokens {
+		if t.isBareword && !t.quotesStripped {
+			switch strings.ToLower(t.str) {
+			case "asc", "desc":
+				if len(conditions) == 0 {
+					return nil, errors.New(invalidQuery + "Expected field before '" +
+						t.str + "' in 'order by' clause")
+				}
+				conditions[len(conditions)-1].Descending = strings.EqualFold(t.str, "desc")
+				continue
+			}
+		}
+		conditions = append(conditions, orderCondition{Field: t.str, Descending: descending})
+	}
+	if len(conditions) == 0 {
+		return nil, errors.New(invalidQuery + unexpectedEnd)
+	}
+	return conditions, nil
+}
+
+// All sort keys must either be present in the "select" or in the "group by" clause.
+func (q *Query) parseOrderBy() error {
+	for i := range q.OrderBy {
+		oc := &q.OrderBy[i]
+		oc.selectIndex, oc.groupIndex = -1, -1
+		for j, sc := range q.Select {
+			if sc.FieldStorage == oc.Field {
+				oc.selectIndex = j
+				break
+			}
+		}
+		for j, groupBy := range q.GroupBy {
+			if groupBy == oc.Field {
+				oc.groupIndex = j
+				break
+			}
+		}
+		if oc.selectIndex == -1 && oc.groupIndex == -1 {
+			return errors.New(invalidQuery + fmt.Sprintf("Can not '(r)order by' '%s', "+
+				"must be present in 'select' or 'group by' clause", oc.Field))
+		}
+	}
+	return nil
+}
+
+func (q *Query) isOrderedBy(fieldStorage string) bool {
+	for _, oc := range q.OrderBy {
+		if oc.selectIndex != -1 && oc.Field == fieldStorage {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the values of all sort keys of a result row.
+func (q *Query) orderValues(groupKey string, values []string) []string {
+	if len(q.OrderBy) == 0 {
+		return nil
+	}
+	var groupValues []string
+	orderValues := make([]string, len(q.OrderBy))
+
+	for i, oc := range q.OrderBy {
+		if oc.selectIndex != -1 && oc.selectIndex < len(values) {
+			orderValues[i] = values[oc.selectIndex]
+			continue
+		}
+		if groupValues == nil {
+			groupValues = strings.Split(groupKey, protocol.AggregateGroupKeyCombinator)
+		}
+		if oc.groupIndex < len(groupValues) {
+			orderValues[i] = groupValues[oc.groupIndex]
+		}
+	}
+	return orderValues
+}
+
+// Sort the result rows by all sort keys of the "order by" clause.
+func (q *Query) sortResult(rows []result) {
+	if len(q.OrderBy) == 0 {
+		return
+	}
+	sort.SliceStable(rows, func(i, j int) bool {
+		for k, oc := range q.OrderBy {
+			cmp := compareOrderValues(rows[i].orderValues[k], rows[j].orderValues[k])
+			if cmp == 0 {
+				continue
+			}
+			if oc.Descending {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return false
+	})
+}
+
+// Compares two values numerically if both are numbers (NaN is the smallest
+// number), and lexicographically otherwise.
+func compareOrderValues(a, b string) int {
+	aFloat, aErr := strconv.ParseFloat(a, 64)
+	bFloat, bErr := strconv.ParseFloat(b, 64)
+	if aErr != nil || bErr != nil {
+		return strings.Compare(a, b)
+	}
+
+	switch aNaN, bNaN := math.IsNaN(aFloat), math.IsNaN(bFloat); {
+	case aNaN && bNaN:
+		return 0
+	case aNaN:
+		return -1
+	case bNaN:
+		return 1
+	case aFloat < bFloat:
+		return -1
+	case aFloat > bFloat:
+		return 1
+	default:
+		return 0
+	}
+}
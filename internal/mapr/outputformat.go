@@ -0,0 +1,239 @@
+package mapr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/mimecast/dtail/internal/io/parquet"
+)
+
+// OutputFormat specifies how the result of a mapreduce query is rendered.
+type OutputFormat int
+
+// The supported output formats.
+const (
+	// TableOutput is a (colored) ASCII table for the terminal.
+	TableOutput OutputFormat = iota
+	// CSVOutput is comma separated, the default format of outfiles.
+	CSVOutput OutputFormat = iota
+	// TSVOutput is tab separated.
+	TSVOutput OutputFormat = iota
+	// JSONOutput is a JSON array of objects, one object per result row.
+	JSONOutput OutputFormat = iota
+	// NDJSONOutput is newline delimited JSON, one object per line.
+	NDJSONOutput OutputFormat = iota
+	// MarkdownOutput is a Markdown table, e.g. for incident tickets.
+	MarkdownOutput OutputFormat = iota
+	// ParquetOutput is an Apache Parquet file, for outfiles only.
+	ParquetOutput OutputFormat = iota
+)
+
+var outputFormatNames = map[OutputFormat]string{
+	TableOutput:    "table",
+	CSVOutput:      "csv",
+	TSVOutput:      "tsv",
+	JSONOutput:     "json",
+	NDJSONOutput:   "ndjson",
+	MarkdownOutput: "markdown",
+	ParquetOutput:  "parquet",
+}
+
+func (f OutputFormat) String() string {
+	if name, ok := outputFormatNames[f]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// ParseOutputFormat returns the output format of the given name, e.g. "json".
+// An empty name is the table output. Parquet is binary and can't be printed.
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	if name == "" {
+		return TableOutput, nil
+	}
+	for f, n := range outputFormatNames {
+		if strings.EqualFold(name, n) && f != ParquetOutput {
+			return f, nil
+		}
+	}
+	return TableOutput, fmt.Errorf("Unknown output format '%s', expected one of "+
+		"table, json, ndjson, csv, tsv or markdown", name)
+}
+
+// Determines the output format of an outfile by its extension, CSV by default.
+func outputFormatByExtension(filePath string) OutputFormat {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".tsv":
+		return TSVOutput
+	case ".json":
+		return JSONOutput
+	case ".ndjson", ".jsonl":
+		return NDJSONOutput
+	case ".md", ".markdown":
+		return MarkdownOutput
+	case ".parquet":
+		return ParquetOutput
+	default:
+		return CSVOutput
+	}
+}
+
+// Writes the result rows in a machine readable format (everything but the
+// table output). The header is only written by formats having one, the CSV
+// delimiter is only used by the CSV format.
+func (g *GroupSet) resultWriteUnformatted(query *Query, format OutputFormat,
+	csvDelimiter rune, w io.Writer, rows []result, rowsLimit int, writeHeader bool) error {
+
+	if rowsLimit >= 0 && len(rows) > rowsLimit {
+		rows = rows[:rowsLimit]
+	}
+
+	switch format {
+	case JSONOutput, NDJSONOutput:
+		return g.resultWriteJSON(query, format, w, rows)
+	case MarkdownOutput:
+		return g.resultWriteDelimited(query, w, rows, writeHeader, "| ", " | ", " |",
+			escapeMarkdown)
+	case TSVOutput:
+		return g.resultWriteDelimited(query, w, rows, writeHeader, "", "\t", "", escapeTSV)
+	case ParquetOutput:
+		return g.resultWriteParquet(query, w, rows)
+	default:
+		return g.resultWriteCSV(query, csvDelimiter, w, rows, writeHeader)
+	}
+}
+
+func (g *GroupSet) resultWriteDelimited(query *Query, w io.Writer, rows []result,
+	writeHeader bool, prefix, delimiter, suffix string, escape func(string) string) error {
+
+	writeLine := func(values []string) error {
+		escaped := make([]string, len(values))
+		for i, value := range values {
+			escaped[i] = escape(value)
+		}
+		_, err := io.WriteString(w, prefix+strings.Join(escaped, delimiter)+suffix+"\n")
+		return err
+	}
+
+	if writeHeader {
+		header := make([]string, len(query.Select))
+		for i, sc := range query.Select {
+			header[i] = sc.FieldStorage
+		}
+		if err := writeLine(header); err != nil {
+			return err
+		}
+		// Markdown tables require a separator line below the header.
+		if prefix != "" {
+			separators := make([]string, len(query.Select))
+			for i := range separators {
+				separators[i] = "---"
+			}
+			if _, err := io.WriteString(w, prefix+strings.Join(separators, delimiter)+
+				suffix+"\n"); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, r := range rows {
+		if err := writeLine(r.values); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (g *GroupSet) resultWriteJSON(query *Query, format OutputFormat, w io.Writer,
+	rows []result) error {
+
+	var sb strings.Builder
+	if format == JSONOutput {
+		sb.WriteString("[")
+	}
+	for i, r := range rows {
+		if i > 0 && format == JSONOutput {
+			sb.WriteString(",")
+		}
+		sb.WriteString("{")
+		for j, sc := range query.Select {
+			if j > 0 {
+				sb.WriteString(",")
+			}
+			key, err := json.Marshal(sc.FieldStorage)
+			if err != nil {
+				return err
+			}
+			sb.Write(key)
+			sb.WriteString(":")
+			value, err := jsonValue(sc, r.values[j])
+			if err != nil {
+				return err
+			}
+			sb.WriteString(value)
+		}
+		sb.WriteString("}")
+		if format == NDJSONOutput {
+			sb.WriteString("\n")
+		}
+	}
+	if format == JSONOutput {
+		sb.WriteString("]\n")
+	}
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// Aggregations are JSON numbers (or null, e.g. on division by zero), whereas
+// the "last" values are strings, as they are copied from the log lines as is.
+func jsonValue(sc selectCondition, value string) (string, error) {
+	if sc.Operation != Last {
+		f, err := strconv.ParseFloat(value, 64)
+		switch {
+		case err != nil, math.IsNaN(f), math.IsInf(f, 0):
+			return "null", nil
+		default:
+			return value, nil
+		}
+	}
+	str, err := json.Marshal(value)
+	return string(str), err
+}
+
+// Aggregations are float64 columns (as stored in the FValues of the aggregate
+// sets), whereas the "last" values are string columns (as in the SValues).
+func (g *GroupSet) resultWriteParquet(query *Query, w io.Writer, rows []result) error {
+	columns := make([]parquet.Column, len(query.Select))
+	for i, sc := range query.Select {
+		columns[i] = parquet.Column{Name: sc.FieldStorage, Type: parquet.Double}
+		if sc.Operation == Last {
+			columns[i].Type = parquet.String
+		}
+	}
+
+	writer := parquet.NewWriter(w, columns...)
+	for _, r := range rows {
+		fields := make(map[string]string, len(query.Select))
+		for i, sc := range query.Select {
+			fields[sc.FieldStorage] = r.values[i]
+		}
+		if err := writer.AddRow(fields); err != nil {
+			return err
+		}
+	}
+	return writer.Close()
+}
+
+func escapeMarkdown(value string) string {
+	value = strings.ReplaceAll(value, "|", "\\|")
+	return strings.ReplaceAll(value, "\n", " ")
+}
+
+func escapeTSV(value string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", " ").Replace(value)
+}
@@ -3,6 +3,7 @@ package mapr
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 	"time"
@@ -17,48 +18,64 @@ const (
 type Outfile struct {
 	FilePath   string
 	AppendMode bool
+	// The format is determined by the file extension, e.g. ".json".
+	Format OutputFormat
+	// The delimiter of CSV outfiles, e.g. 'outfile "result.csv" ";"'.
+	CSVDelimiter rune
 }
 
 func (o Outfile) String() string {
-	return fmt.Sprintf("Outfile(FilePath:%v,AppendMode:%v)", o.FilePath, o.AppendMode)
+	return fmt.Sprintf("Outfile(FilePath:%v,AppendMode:%v,Format:%v,CSVDelimiter:%q)",
+		o.FilePath, o.AppendMode, o.Format, o.CSVDelimiter)
 }
 
 // Query represents a parsed mapr query.
 type Query struct {
-	Select       []selectCondition
-	Table        string
-	Where        []whereCondition
-	Set          []setCondition
-	GroupBy      []string
-	OrderBy      string
-	ReverseOrder bool
-	GroupKey     string
-	Interval     time.Duration
-	Limit        int
-	Outfile      *Outfile
-	RawQuery     string
-	tokens       []token
-	LogFormat    string
+	Select    []selectCondition
+	Table     string
+	Where     *whereExpression
+	Set       []setCondition
+	GroupBy   []string
+	Buckets   []timeBucket
+	Having    *whereExpression
+	OrderBy   []orderCondition
+	GroupKey  string
+	Interval  time.Duration
+	Limit     int
+	Outfile   *Outfile
+	RawQuery  string
+	tokens    []token
+	LogFormat string
+	// The user supplied regex of the "regex" log format.
+	LogFormatRegex string
+	// The delimiter of the "csv" log format.
+	CSVDelimiter rune
+	// All aggregations of the select clause, including the ones used in
+	// arithmetic expressions only.
+	aggregations []selectCondition
 }
 
 func (q Query) String() string {
-	return fmt.Sprintf("Query(Select:%v,Table:%s,Where:%v,Set:%vGroupBy:%v,"+
-		"GroupKey:%s,OrderBy:%v,ReverseOrder:%v,Interval:%v,Limit:%d,Outfile:%s,"+
-		"RawQuery:%s,tokens:%v,LogFormat:%s)",
+	return fmt.Sprintf("Query(Select:%v,Table:%s,Where:%v,Set:%vGroupBy:%v,Buckets:%v,"+
+		"Having:%v,GroupKey:%s,OrderBy:%v,Interval:%v,Limit:%d,Outfile:%s,"+
+		"RawQuery:%s,tokens:%v,LogFormat:%s,LogFormatRegex:%s,CSVDelimiter:%q)",
 		q.Select,
 		q.Table,
 		q.Where,
 		q.Set,
 		q.GroupBy,
+		q.Buckets,
+		q.Having,
 		q.GroupKey,
 		q.OrderBy,
-		q.ReverseOrder,
 		q.Interval,
 		q.Limit,
 		q.Outfile,
 		q.RawQuery,
 		q.tokens,
-		q.LogFormat)
+		q.LogFormat,
+		q.LogFormatRegex,
+		q.CSVDelimiter)
 }
 
 // NewQuery returns a new mapreduce query.
@@ -68,10 +85,11 @@ func NewQuery(queryStr string) (*Query, error) {
 	}
 	tokens := tokenize(queryStr)
 	q := Query{
-		RawQuery: queryStr,
-		tokens:   tokens,
-		Interval: time.Second * 5,
-		Limit:    -1,
+		RawQuery:     queryStr,
+		tokens:       tokens,
+		Interval:     time.Second * 5,
+		Limit:        -1,
+		CSVDelimiter: defaultCSVDelimiter,
 	}
 
 	// If log format is CSV, then use "." as the table. It means, that
@@ -83,6 +101,12 @@ func NewQuery(queryStr string) (*Query, error) {
 	return &q, q.parse(tokens)
 }
 
+// Aggregations returns all aggregations of the select clause. Arithmetic
+// expressions aren't aggregated themselves, but their operands are.
+func (q *Query) Aggregations() []selectCondition {
+	return q.aggregations
+}
+
 // HasOutfile returns true if query result will be written to a CVS output file.
 func (q *Query) HasOutfile() bool {
 	return q.Outfile != nil
@@ -103,26 +127,24 @@ func (q *Query) parse(tokens []token) error {
 			"clause but got none")
 	}
 
+	if err := q.parseAggregations(); err != nil {
+		return err
+	}
+
 	if len(q.GroupBy) == 0 {
 		field := q.Select[0].Field
 		q.GroupBy = append(q.GroupBy, field)
 	}
 
-	if q.OrderBy != "" {
-		var orderFieldIsValid bool
-		for _, sc := range q.Select {
-			if q.OrderBy == sc.FieldStorage {
-				orderFieldIsValid = true
-				break
-			}
-		}
-		if !orderFieldIsValid {
-			return errors.New(invalidQuery + fmt.Sprintf("Can not '(r)order by' '%s',"+
-				"must be present in 'select' clause", q.OrderBy))
-		}
+	if err := q.parseTimeBuckets(); err != nil {
+		return err
 	}
 
-	return nil
+	if err := q.parseHaving(); err != nil {
+		return err
+	}
+
+	return q.parseOrderBy()
 }
 
 // One can argue that this function is too large (as reported by automatic tools such
@@ -152,7 +174,7 @@ func (q *Query) parseTokens(tokens []token) ([]token, error) {
 			q.Table = strings.ToUpper(found[0].str)
 		case "where":
 			tokens, found = tokensConsume(tokens[1:])
-			if q.Where, err = makeWhereConditions(found); err != nil {
+			if q.Where, err = makeWhereExpression(found); err != nil {
 				return tokens, err
 			}
 		case "set":
@@ -167,27 +189,24 @@ func (q *Query) parseTokens(tokens []token) ([]token, error) {
 			}
 			tokens, q.GroupBy = tokensConsumeStr(tokens)
 			q.GroupKey = strings.Join(q.GroupBy, ",")
-		case "rorder":
-			tokens = tokensConsumeOptional(tokens[1:], "by")
-			if tokens == nil || len(tokens) < 1 {
-				return tokens, errors.New(invalidQuery + unexpectedEnd)
-			}
-			tokens, found = tokensConsume(tokens)
+		case "having":
+			tokens, found = tokensConsume(tokens[1:])
 			if len(found) == 0 {
 				return tokens, errors.New(invalidQuery + unexpectedEnd)
 			}
-			q.OrderBy = found[0].str
-			q.ReverseOrder = true
-		case "order":
+			if q.Having, err = makeWhereExpression(found); err != nil {
+				return tokens, err
+			}
+		case "order", "rorder":
+			descending := strings.EqualFold(tokens[0].str, "order")
 			tokens = tokensConsumeOptional(tokens[1:], "by")
 			if tokens == nil || len(tokens) < 1 {
 				return tokens, errors.New(invalidQuery + unexpectedEnd)
 			}
 			tokens, found = tokensConsume(tokens)
-			if len(found) == 0 {
-				return tokens, errors.New(invalidQuery + unexpectedEnd)
+			if q.OrderBy, err = makeOrderConditions(found, descending); err != nil {
+				return tokens, err
 			}
-			q.OrderBy = found[0].str
 		case "interval":
 			tokens, found = tokensConsume(tokens[1:])
 			if len(found) > 0 {
@@ -209,24 +228,51 @@ func (q *Query) parseTokens(tokens []token) ([]token, error) {
 			q.Limit = i
 		case "outfile":
 			tokens, found = tokensConsume(tokens[1:])
+			q.Outfile = &Outfile{CSVDelimiter: defaultCSVDelimiter}
+			if len(found) > 1 && found[0].str == "append" {
+				q.Outfile.AppendMode = true
+				found = found[1:]
+			}
 			switch len(found) {
 			case 1:
-				q.Outfile = &Outfile{FilePath: found[0].str, AppendMode: false}
+				q.Outfile.FilePath = found[0].str
 			case 2:
-				if found[0].str == "append" {
-					q.Outfile = &Outfile{FilePath: found[1].str, AppendMode: true}
-				} else {
-					return tokens, errors.New(invalidQuery + invalidQuery)
+				q.Outfile.FilePath = found[0].str
+				if q.Outfile.CSVDelimiter, err = parseCSVDelimiter(found[1].str); err != nil {
+					return tokens, err
 				}
 			default:
 				return tokens, errors.New(invalidQuery + invalidQuery)
 			}
+			q.Outfile.Format = outputFormatByExtension(q.Outfile.FilePath)
+			switch {
+			case len(found) > 1 && q.Outfile.Format != CSVOutput:
+				return tokens, errors.New(invalidQuery + "Unexpected CSV delimiter for " +
+					"outfile " + q.Outfile.FilePath)
+			case q.Outfile.AppendMode && q.Outfile.Format == JSONOutput:
+				return tokens, errors.New(invalidQuery + "Can not append to JSON outfile " +
+					q.Outfile.FilePath + ", use NDJSON (.ndjson) instead")
+			case q.Outfile.AppendMode && q.Outfile.Format == ParquetOutput:
+				return tokens, errors.New(invalidQuery + "Can not append to Parquet outfile " +
+					q.Outfile.FilePath)
+			}
 		case "logformat":
 			tokens, found = tokensConsume(tokens[1:])
 			if len(found) == 0 {
 				return tokens, errors.New(invalidQuery + unexpectedEnd)
 			}
 			q.LogFormat = found[0].str
+			switch {
+			case len(found) > 1 && q.LogFormat == "csv":
+				if q.CSVDelimiter, err = parseCSVDelimiter(found[1].str); err != nil {
+					return tokens, err
+				}
+			case len(found) > 1:
+				q.LogFormatRegex = found[1].str
+			}
+			if err := q.parseLogFormatRegex(); err != nil {
+				return tokens, err
+			}
 		default:
 			return tokens, errors.New(invalidQuery + "Unexpected keyword " + tokens[0].str)
 		}
@@ -234,3 +280,29 @@ func (q *Query) parseTokens(tokens []token) ([]token, error) {
 
 	return tokens, nil
 }
+
+// The "regex" log format requires a quoted regex with named capture groups,
+// e.g. 'logformat regex "(?P<status>\d+) (?P<path>\S+)"'.
+func (q *Query) parseLogFormatRegex() error {
+	if q.LogFormat != "regex" {
+		if q.LogFormatRegex != "" {
+			return errors.New(invalidQuery + "Unexpected argument to 'logformat' " +
+				q.LogFormat + ": " + q.LogFormatRegex)
+		}
+		return nil
+	}
+	if q.LogFormatRegex == "" {
+		return errors.New(invalidQuery + "Expected quoted regex after 'logformat regex'")
+	}
+	re, err := regexp.Compile(q.LogFormatRegex)
+	if err != nil {
+		return errors.New(invalidQuery + "Unable to compile 'logformat regex': " + err.Error())
+	}
+	for _, name := range re.SubexpNames() {
+		if name != "" {
+			return nil
+		}
+	}
+	return errors.New(invalidQuery + "Expected at least one named capture group, " +
+		"e.g. (?P<name>...), in 'logformat regex'")
+}
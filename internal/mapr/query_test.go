@@ -1,8 +1,12 @@
 package mapr
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/mimecast/dtail/internal/metrics"
 )
 
 func TestParseQueryOutfile(t *testing.T) {
@@ -154,33 +158,39 @@ func TestParseQueryDeep(t *testing.T) {
 		}
 
 		// 'where' clause
-		if len(q.Where) != 2 {
+		where := q.Where.conditions()
+		if len(where) != 2 {
 			t.Errorf("Expected two elements in 'where' clause but got '%v': %s\n%v",
 				q.Where, queryStr, q)
+			continue
 		}
-		if q.Where[0].lString != "w1" {
+		if q.Where.Operation != LogicalAnd {
+			t.Errorf("Expected 'And' as logical operation of 'where' clause but got "+
+				"'%v': %s\n%v", q.Where.Operation, queryStr, q)
+		}
+		if where[0].lString != "w1" {
 			t.Errorf("Expected w1 as first element in 'where' clause but got '%v': %s\n%v",
-				q.Where[0].lString, queryStr, q)
+				where[0].lString, queryStr, q)
 		}
-		if q.Where[0].Operation != FloatEq {
+		if where[0].Operation != FloatEq {
 			t.Errorf("Expected FloatEq operation in first 'where' condition but got "+
-				"'%v': %s\n%v", q.Where[0].Operation, queryStr, q)
+				"'%v': %s\n%v", where[0].Operation, queryStr, q)
 		}
-		if q.Where[0].rFloat != 2 {
+		if where[0].rFloat != 2 {
 			t.Errorf("Expected '2' as float argument in first 'where' condition but "+
-				"got '%v': %s\n%v", q.Where[0].rFloat, queryStr, q)
+				"got '%v': %s\n%v", where[0].rFloat, queryStr, q)
 		}
-		if q.Where[1].lString != "w2" {
+		if where[1].lString != "w2" {
 			t.Errorf("Expected w2 as second element in 'where' clause but got '%v': "+
-				"%s\n%v", q.Where[1].lString, queryStr, q)
+				"%s\n%v", where[1].lString, queryStr, q)
 		}
-		if q.Where[1].Operation != StringEq {
+		if where[1].Operation != StringEq {
 			t.Errorf("Expected StringEq operation in second 'where' condition but got "+
-				"'%v': %s\n%v", q.Where[0].Operation, queryStr, q)
+				"'%v': %s\n%v", where[0].Operation, queryStr, q)
 		}
-		if q.Where[1].rString != "free beer" {
+		if where[1].rString != "free beer" {
 			t.Errorf("Expected 'free beer' as string argument in second 'where' "+
-				"condition but got '%v': %s\n%v", q.Where[0].rString, queryStr, q)
+				"condition but got '%v': %s\n%v", where[0].rString, queryStr, q)
 		}
 
 		// 'group by' clause
@@ -202,8 +212,8 @@ func TestParseQueryDeep(t *testing.T) {
 		}
 
 		// 'order by' clause
-		if q.OrderBy != "count(s3)" {
-			t.Errorf("Expected 'count(s3)' as element in 'order by' clause but got "+
+		if len(q.OrderBy) != 1 || q.OrderBy[0].Field != "count(s3)" || !q.OrderBy[0].Descending {
+			t.Errorf("Expected 'count(s3)' as descending element in 'order by' clause but got "+
 				"'%v': %s\n%v", q.OrderBy, queryStr, q)
 		}
 
@@ -292,3 +302,607 @@ func TestQuotedSelectCondition(t *testing.T) {
 			"'select' clause but got '%v': %s\n%v", q.Select[3].Operation, queryStr, q)
 	}
 }
+
+func TestSketchSelectConditions(t *testing.T) {
+	queryStr := "select p50($latency), p95($latency), p999($latency), dcount($user) " +
+		"from STATS group by $hostname"
+
+	q, err := NewQuery(queryStr)
+	if err != nil {
+		t.Errorf("Query parse error: %s\n%v: %v", queryStr, q, err)
+		return
+	}
+
+	expectedRanks := []float64{0.5, 0.95, 0.999}
+	for i, rank := range expectedRanks {
+		if q.Select[i].Operation != Percentile {
+			t.Errorf("Expected 'Percentile' as aggregation function of element %d in "+
+				"'select' clause but got '%v': %s\n%v", i, q.Select[i].Operation, queryStr, q)
+		}
+		if q.Select[i].Rank != rank {
+			t.Errorf("Expected rank '%v' of element %d in 'select' clause but got "+
+				"'%v': %s\n%v", rank, i, q.Select[i].Rank, queryStr, q)
+		}
+	}
+	if q.Select[3].Operation != DCount {
+		t.Errorf("Expected 'DCount' as aggregation function of fourth element in "+
+			"'select' clause but got '%v': %s\n%v", q.Select[3].Operation, queryStr, q)
+	}
+
+	for _, queryStr := range []string{"select p($foo)", "select p5($foo)", "select pxx($foo)"} {
+		if q, err := NewQuery(queryStr); err == nil {
+			t.Errorf("Expected a parse error: %s\n%v", queryStr, q)
+		}
+	}
+}
+
+func TestWhereClauseLogic(t *testing.T) {
+	fields := map[string]string{
+		"status":   "503",
+		"latency":  "120",
+		"$caller":  "handlers/foo.go",
+		"$message": "not found",
+	}
+
+	testTable := map[string]bool{
+		"status >= 500 or latency > 2000":                                  true,
+		"status >= 500 and latency > 2000":                                 false,
+		"status < 500 or latency > 2000":                                   false,
+		"not status < 500":                                                 true,
+		"not (status >= 500 or latency > 2000)":                            false,
+		"(status >= 500 and latency > 2000) or $caller hasprefix \"hand\"": true,
+		"status >= 500 and (latency > 2000 or $caller hasprefix \"hand\")": true,
+		"((status == 503)) latency < 200":                                  true,
+		"status == 503, latency < 100 or $message eq \"not found\"":        true,
+		"`not` eq \"x\" or status == 503":                                  true,
+		"$caller matches \"^handlers/.*\\.go$\"":                           true,
+		"$caller nmatches \"^handlers/\"":                                  false,
+		"$message matches \"^found\" or $message matches \"(not|yes) f\"":  true,
+	}
+
+	for where, expected := range testTable {
+		queryStr := "select count($line) from STATS where " + where
+		q, err := NewQuery(queryStr)
+		if err != nil {
+			t.Errorf("Query parse error: %s\n%v: %v", queryStr, q, err)
+			continue
+		}
+		if result := q.WhereClause(fields); result != expected {
+			t.Errorf("Expected 'where' clause to be %v but got %v: %s\n%v",
+				expected, result, queryStr, q.Where)
+		}
+	}
+
+	errorQueries := []string{
+		"select foo from bar where (baz < 100",
+		"select foo from bar where baz < 100)",
+		"select foo from bar where baz < 100 or",
+		"select foo from bar where not",
+		"select foo from bar where ()",
+		"select foo from bar where baz matches qux",
+		"select foo from bar where baz matches \"(unclosed\"",
+	}
+	for _, queryStr := range errorQueries {
+		if q, err := NewQuery(queryStr); err == nil {
+			t.Errorf("Expected a parse error: %s\n%v", queryStr, q)
+		}
+	}
+}
+
+func TestParseQueryLogFormatRegex(t *testing.T) {
+	queryStr := "select count($line) group by status logformat regex \"(?P<status>\\d+)\""
+	q, err := NewQuery(queryStr)
+	if err != nil {
+		t.Errorf("Query parse error: %s\n%v: %v", queryStr, q, err)
+		return
+	}
+	if q.LogFormat != "regex" {
+		t.Errorf("Expected 'regex' logformat got '%v': %s\n%v", q.LogFormat, queryStr, q)
+	}
+	if q.LogFormatRegex != "(?P<status>\\d+)" {
+		t.Errorf("Expected '(?P<status>\\d+)' logformat regex got '%v': %s\n%v",
+			q.LogFormatRegex, queryStr, q)
+	}
+
+	errorQueries := []string{
+		"select foo logformat regex",
+		"select foo logformat regex \"(unclosed\"",
+		"select foo logformat regex \"(\\d+)\"",
+		"select foo logformat generic \"(?P<foo>.*)\"",
+	}
+	for _, queryStr := range errorQueries {
+		if q, err := NewQuery(queryStr); err == nil {
+			t.Errorf("Expected a parse error: %s\n%v", queryStr, q)
+		}
+	}
+}
+
+func TestTimeBuckets(t *testing.T) {
+	queryStr := "select bucket($time, 5m), count($line) from STATS " +
+		"group by bucket($time, 5m), $hostname"
+	q, err := NewQuery(queryStr)
+	if err != nil {
+		t.Errorf("Query parse error: %s\n%v: %v", queryStr, q, err)
+		return
+	}
+	if len(q.Buckets) != 1 {
+		t.Errorf("Expected one time bucket but got '%v': %s\n%v", q.Buckets, queryStr, q)
+		return
+	}
+	if q.GroupBy[0] != "bucket($time,5m)" || q.Select[0].FieldStorage != q.GroupBy[0] {
+		t.Errorf("Expected 'bucket($time,5m)' in 'select' and 'group by' clauses but "+
+			"got '%v' and '%v': %s", q.Select[0].FieldStorage, q.GroupBy[0], queryStr)
+	}
+	if q.Buckets[0].Field != "$time" || q.Buckets[0].Size != 5*time.Minute {
+		t.Errorf("Expected 5m time bucket of '$time' but got '%v': %s", q.Buckets[0], queryStr)
+	}
+
+	utc := func(str string) string {
+		ts, _ := time.ParseInLocation("20060102-150405", str, time.Local)
+		return ts.Truncate(5 * time.Minute).UTC().Format(bucketLayout)
+	}
+	testTable := map[string]string{
+		"20211002-071209":           utc("20211002-071209"),
+		"2021-10-02T07:12:09Z":      "2021-10-02T07:10:00Z",
+		"2021-10-02T07:14:59+02:00": "2021-10-02T05:10:00Z",
+		"1633158729":                "2021-10-02T07:10:00Z",
+	}
+	for value, expected := range testTable {
+		fields := map[string]string{"$time": value}
+		q.BucketClause(fields)
+		if fields["bucket($time,5m)"] != expected {
+			t.Errorf("Expected time bucket '%s' of '%s' but got '%s'",
+				expected, value, fields["bucket($time,5m)"])
+		}
+	}
+
+	fields := map[string]string{"$time": "not a timestamp"}
+	q.BucketClause(fields)
+	if value, ok := fields["bucket($time,5m)"]; ok {
+		t.Errorf("Expected no time bucket of an invalid timestamp but got '%s'", value)
+	}
+
+	errorQueries := []string{
+		"select count($line) group by bucket($time)",
+		"select count($line) group by bucket($time, 5x)",
+		"select count($line) group by bucket($time, 1ms)",
+	}
+	for _, queryStr := range errorQueries {
+		if q, err := NewQuery(queryStr); err == nil {
+			t.Errorf("Expected a parse error: %s\n%v", queryStr, q)
+		}
+	}
+}
+
+func TestHavingClause(t *testing.T) {
+	queryStr := "select $hostname, count($line), avg($time) from STATS group by $hostname " +
+		"having count($line) > 100 and not avg($time) >= 5 order by count($line)"
+	q, err := NewQuery(queryStr)
+	if err != nil {
+		t.Errorf("Query parse error: %s\n%v: %v", queryStr, q, err)
+		return
+	}
+
+	g := NewGroupSet()
+	for hostname, count := range map[string]float64{"a": 50, "b": 150, "c": 500, "d": 1000} {
+		set := g.GetSet(hostname)
+		set.Samples = 1
+		set.SValues["$hostname"] = hostname
+		set.FValues["count($line)"] = count
+		set.FValues["avg($time)"] = count / 100
+	}
+
+	rows, _, err := g.result(q, true)
+	if err != nil {
+		t.Errorf("Unable to get result: %v", err)
+	}
+	var hostnames []string
+	for _, row := range rows {
+		hostnames = append(hostnames, row.values[0])
+	}
+	if strings.Join(hostnames, ",") != "b" {
+		t.Errorf("Expected only host 'b' to be in the result but got %v", hostnames)
+	}
+
+	errorQueries := []string{
+		"select count($line) having",
+		"select count($line) having sum($line) > 100",
+		"select count($line) having count($line) >",
+	}
+	for _, queryStr := range errorQueries {
+		if q, err := NewQuery(queryStr); err == nil {
+			t.Errorf("Expected a parse error: %s\n%v", queryStr, q)
+		}
+	}
+}
+
+func TestArithmeticExpressions(t *testing.T) {
+	queryStr := "select $hostname, sum(errors)/count(*), (sum(errors) + 1) * 100 / count(*), " +
+		"count(*) from STATS set $mb = $bytes / 1048576, $ratio = ($errors + 1) % $total, " +
+		"$neg = -$bytes group by $hostname"
+	q, err := NewQuery(queryStr)
+	if err != nil {
+		t.Errorf("Query parse error: %s\n%v: %v", queryStr, q, err)
+		return
+	}
+	if len(q.Select) != 4 || len(q.Set) != 3 {
+		t.Errorf("Expected 4 select and 3 set conditions but got %v and %v: %s",
+			q.Select, q.Set, queryStr)
+		return
+	}
+
+	// Aggregations used directly and in expressions are aggregated only once.
+	var aggregations []string
+	for _, sc := range q.Aggregations() {
+		aggregations = append(aggregations, sc.FieldStorage)
+	}
+	if strings.Join(aggregations, ",") != "$hostname,count(*),sum(errors)" {
+		t.Errorf("Expected aggregations '$hostname,count(*),sum(errors)' but got '%v'",
+			aggregations)
+	}
+
+	fields := map[string]string{"$bytes": "3145728", "$errors": "9", "$total": "4"}
+	if err := q.SetClause(fields); err != nil {
+		t.Errorf("Unable to run set clause: %v", err)
+	}
+	expected := map[string]string{"$mb": "3", "$ratio": "2", "$neg": "-3145728"}
+	for name, value := range expected {
+		if fields[name] != value {
+			t.Errorf("Expected field '%s' to be '%s' but got '%s'", name, value, fields[name])
+		}
+	}
+
+	fields = map[string]string{"$bytes": "foo", "$errors": "1", "$total": "0"}
+	q.SetClause(fields)
+	for _, name := range []string{"$mb", "$ratio", "$neg"} {
+		if value, ok := fields[name]; ok {
+			t.Errorf("Expected field '%s' to be unset but got '%s'", name, value)
+		}
+	}
+
+	g := NewGroupSet()
+	set := g.GetSet("host")
+	set.SValues["$hostname"] = "host"
+	set.FValues["sum(errors)"] = 3
+	set.FValues["count(*)"] = 12
+	rows, _, err := g.result(q, false)
+	if err != nil {
+		t.Errorf("Unable to get result: %v", err)
+	}
+	if got := strings.Join(rows[0].values, ","); got != "host,0.250000,33.333333,12" {
+		t.Errorf("Expected result 'host,0.250000,33.333333,12' but got '%s'", got)
+	}
+
+	errorQueries := []string{
+		"select sum(foo) / from STATS",
+		"select (sum(foo) / 2 from STATS",
+		"select sum(foo) / bar(baz) from STATS",
+		"select count($line) set $foo = $bar * from STATS",
+		"select count($line) set $foo = ($bar + 1 from STATS",
+	}
+	for _, queryStr := range errorQueries {
+		if q, err := NewQuery(queryStr); err == nil {
+			t.Errorf("Expected a parse error: %s\n%v", queryStr, q)
+		}
+	}
+}
+
+func TestSetFunctions(t *testing.T) {
+	queryStr := `select $subnet, $ms, $day, count($line) from STATS ` +
+		`set $subnet = ipsubnet($ip, 24), $day = todate($epoch, "2006-01-02"), ` +
+		`$ms = round($latency, 3) * 1000, $sec = round($latency, 1) * 2, ` +
+		`$name = coalesce($user, "anonymous") group by $subnet`
+	q, err := NewQuery(queryStr)
+	if err != nil {
+		t.Errorf("Query parse error: %s\n%v: %v", queryStr, q, err)
+		return
+	}
+
+	fields := map[string]string{"$ip": "192.168.1.42", "$epoch": "1633158729",
+		"$latency": "0.1234"}
+	if err := q.SetClause(fields); err != nil {
+		t.Errorf("Unable to run set clause: %v", err)
+	}
+	expected := map[string]string{"$subnet": "192.168.1.0/24", "$day": "2021-10-02",
+		"$ms": "123", "$sec": "0.2", "$name": "anonymous"}
+	for name, value := range expected {
+		if fields[name] != value {
+			t.Errorf("Expected field '%s' to be '%s' but got '%s'", name, value, fields[name])
+		}
+	}
+
+	errorQueries := []string{
+		`select count($line) set $foo = nosuchfunction($bar)`,
+		`select count($line) set $foo = substr($bar)`,
+		`select count($line) set $foo = round($bar, "two")`,
+		`select count($line) set $foo = lower($bar) * 2`,
+	}
+	for _, queryStr := range errorQueries {
+		if q, err := NewQuery(queryStr); err == nil {
+			t.Errorf("Expected a parse error: %s\n%v", queryStr, q)
+		}
+	}
+}
+
+func TestOrderBy(t *testing.T) {
+	g := NewGroupSet()
+	for _, row := range []struct {
+		hostname, dc string
+		count        float64
+	}{
+		{"web10", "eu", 100}, {"web9", "eu", 100}, {"web2", "us", 300},
+		{"web1", "us", 100}, {"web3", "eu", 20},
+	} {
+		set := g.GetSet(row.hostname + "," + row.dc)
+		set.Samples = 1
+		set.SValues["$hostname"] = row.hostname
+		set.FValues["count($line)"] = row.count
+	}
+
+	tests := map[string]string{
+		// By default, "order by" is descending and "rorder by" ascending.
+		"order by count($line), $hostname":       "web2,web9,web10,web1,web3",
+		"rorder by count($line), $hostname desc": "web3,web9,web10,web1,web2",
+		// The count is compared numerically, the hostnames are strings.
+		"order by count($line) desc, $hostname asc": "web2,web1,web10,web9,web3",
+		// Ordering by a not selected group by field.
+		"order by $dc asc, count($line) desc, $hostname": "web9,web10,web3,web2,web1",
+	}
+	for orderBy, expected := range tests {
+		queryStr := "select $hostname, count($line) group by $hostname, $dc " + orderBy
+		q, err := NewQuery(queryStr)
+		if err != nil {
+			t.Errorf("Query parse error: %s\n%v: %v", queryStr, q, err)
+			continue
+		}
+		rows, _, err := g.result(q, false)
+		if err != nil {
+			t.Errorf("Unable to get result: %v", err)
+			continue
+		}
+		var hostnames []string
+		for _, row := range rows {
+			hostnames = append(hostnames, row.values[0])
+		}
+		if strings.Join(hostnames, ",") != expected {
+			t.Errorf("Expected '%s' but got '%v': %s", expected, hostnames, queryStr)
+		}
+	}
+
+	errorQueries := []string{
+		"select count($line) order by",
+		"select count($line) order by desc",
+		"select count($line) group by $hostname order by sum($line)",
+	}
+	for _, queryStr := range errorQueries {
+		if q, err := NewQuery(queryStr); err == nil {
+			t.Errorf("Expected a parse error: %s\n%v", queryStr, q)
+		}
+	}
+}
+
+func TestResultOutputFormats(t *testing.T) {
+	queryStr := "select $hostname, count($line), sum($errors)/count($line) " +
+		"group by $hostname order by count($line)"
+	q, err := NewQuery(queryStr)
+	if err != nil {
+		t.Errorf("Query parse error: %s\n%v: %v", queryStr, q, err)
+		return
+	}
+
+	g := NewGroupSet()
+	for hostname, count := range map[string]float64{"web|1": 2, "web\"2": 1} {
+		set := g.GetSet(hostname)
+		set.Samples = 1
+		set.SValues["$hostname"] = hostname
+		set.FValues["count($line)"] = count
+		set.FValues["sum($errors)"] = count
+	}
+	// Division by zero.
+	set := g.GetSet("web3")
+	set.SValues["$hostname"] = "web3"
+
+	expected := map[OutputFormat]string{
+		JSONOutput: `[{"$hostname":"web|1","count($line)":2,"sum($errors)/count($line)":1.000000},` +
+			`{"$hostname":"web\"2","count($line)":1,"sum($errors)/count($line)":1.000000},` +
+			`{"$hostname":"web3","count($line)":0,"sum($errors)/count($line)":null}]` + "\n",
+		NDJSONOutput: `{"$hostname":"web|1","count($line)":2,"sum($errors)/count($line)":1.000000}` + "\n" +
+			`{"$hostname":"web\"2","count($line)":1,"sum($errors)/count($line)":1.000000}` + "\n" +
+			`{"$hostname":"web3","count($line)":0,"sum($errors)/count($line)":null}` + "\n",
+		TSVOutput: "$hostname\tcount($line)\tsum($errors)/count($line)\n" +
+			"web|1\t2\t1.000000\nweb\"2\t1\t1.000000\nweb3\t0\tNaN\n",
+		MarkdownOutput: "| $hostname | count($line) | sum($errors)/count($line) |\n" +
+			"| --- | --- | --- |\n| web\\|1 | 2 | 1.000000 |\n| web\"2 | 1 | 1.000000 |\n" +
+			"| web3 | 0 | NaN |\n",
+	}
+	for format, expected := range expected {
+		result, numRows, err := g.Result(q, -1, format)
+		if err != nil {
+			t.Errorf("Unable to get %v result: %v", format, err)
+			continue
+		}
+		if numRows != 3 {
+			t.Errorf("Expected 3 %v result rows but got %d", format, numRows)
+		}
+		if result != expected {
+			t.Errorf("Expected %v result\n%s\nbut got\n%s", format, expected, result)
+		}
+	}
+
+	for name, expected := range map[string]OutputFormat{
+		"": TableOutput, "json": JSONOutput, "NDJSON": NDJSONOutput, "markdown": MarkdownOutput,
+	} {
+		if format, err := ParseOutputFormat(name); err != nil || format != expected {
+			t.Errorf("Expected output format %v for '%s' but got %v: %v",
+				expected, name, format, err)
+		}
+	}
+	if format, err := ParseOutputFormat("xml"); err == nil {
+		t.Errorf("Expected an error for output format 'xml' but got %v", format)
+	}
+
+	for outfile, expected := range map[string]OutputFormat{
+		"result.csv": CSVOutput, "result.json": JSONOutput, "result.jsonl": NDJSONOutput,
+		"result.tsv": TSVOutput, "result.md": MarkdownOutput, "result": CSVOutput,
+		"result.parquet": ParquetOutput,
+	} {
+		queryStr := "select count($line) outfile \"" + outfile + "\""
+		q, err := NewQuery(queryStr)
+		if err != nil {
+			t.Errorf("Query parse error: %s\n%v: %v", queryStr, q, err)
+			continue
+		}
+		if q.Outfile.Format != expected {
+			t.Errorf("Expected outfile format %v but got %v: %s", expected,
+				q.Outfile.Format, queryStr)
+		}
+	}
+	for _, outfile := range []string{"result.json", "result.parquet"} {
+		queryStr := "select count($line) outfile append \"" + outfile + "\""
+		if q, err := NewQuery(queryStr); err == nil {
+			t.Errorf("Expected a parse error: %s\n%v", queryStr, q)
+		}
+	}
+	if format, err := ParseOutputFormat("parquet"); err == nil {
+		t.Errorf("Expected an error for output format 'parquet' but got %v", format)
+	}
+
+	result, _, err := g.Result(q, -1, ParquetOutput)
+	if err != nil || !strings.HasPrefix(result, "PAR1") || !strings.HasSuffix(result, "PAR1") {
+		t.Errorf("Expected a Parquet file but got %q: %v", result, err)
+	}
+}
+
+func TestCSVDelimiter(t *testing.T) {
+	type delimiters struct{ logFormat, outfile rune }
+	for queryStr, expected := range map[string]delimiters{
+		"select count($line) logformat csv":         {',', 0},
+		"select count($line) logformat csv \";\"":   {';', 0},
+		"select count($line) logformat csv \"\\t\"": {'\t', 0},
+		// The outfile delimiter is independent of the log format.
+		"select count($line) outfile \"result.csv\"":                           {',', ','},
+		"select count($line) outfile \"result.csv\" \";\"":                     {',', ';'},
+		"select count($line) outfile append \"result.csv\" \"\\t\"":            {',', '\t'},
+		"select count($line) logformat csv \";\" outfile \"result.csv\"":       {';', ','},
+		"select count($line) outfile \"result.csv\" \"|\" logformat csv \";\"": {';', '|'},
+	} {
+		q, err := NewQuery(queryStr)
+		if err != nil {
+			t.Errorf("Query parse error: %s\n%v: %v", queryStr, q, err)
+			continue
+		}
+		if q.CSVDelimiter != expected.logFormat {
+			t.Errorf("Expected CSV log format delimiter %q but got %q: %s",
+				expected.logFormat, q.CSVDelimiter, queryStr)
+		}
+		if q.HasOutfile() && q.Outfile.CSVDelimiter != expected.outfile {
+			t.Errorf("Expected CSV outfile delimiter %q but got %q: %s",
+				expected.outfile, q.Outfile.CSVDelimiter, queryStr)
+		}
+	}
+
+	for _, queryStr := range []string{
+		"select count($line) logformat csv \";;\"",
+		"select count($line) logformat csv \"\\n\"",
+		"select count($line) logformat json \";\"",
+		"select count($line) outfile \"result.csv\" \";;\"",
+		"select count($line) outfile \"result.json\" \";\"",
+		"select count($line) outfile append \"result.csv\" \";\" \",\"",
+	} {
+		if q, err := NewQuery(queryStr); err == nil {
+			t.Errorf("Expected a parse error: %s\n%v", queryStr, q)
+		}
+	}
+
+	queryStr := "select $hostname, count($line) group by $hostname logformat csv \";\" " +
+		"outfile \"result.csv\" \"\\t\""
+	q, err := NewQuery(queryStr)
+	if err != nil {
+		t.Errorf("Query parse error: %s\n%v: %v", queryStr, q, err)
+		return
+	}
+	g := NewGroupSet()
+	set := g.GetSet("web1")
+	set.Samples = 1
+	set.SValues["$hostname"] = "web1"
+	set.FValues["count($line)"] = 2
+	rows, _, err := g.result(q, false)
+	if err != nil {
+		t.Errorf("Unable to get result: %v", err)
+		return
+	}
+
+	var sb strings.Builder
+	err = g.resultWriteUnformatted(q, q.Outfile.Format, q.Outfile.CSVDelimiter, &sb, rows,
+		-1, true)
+	if expected := "$hostname\tcount($line)\nweb1\t2\n"; err != nil || sb.String() != expected {
+		t.Errorf("Expected outfile %q but got %q: %v", expected, sb.String(), err)
+	}
+	// Printed CSV always uses the default delimiter.
+	result, _, err := g.Result(q, -1, CSVOutput)
+	if expected := "$hostname,count($line)\nweb1,2\n"; err != nil || result != expected {
+		t.Errorf("Expected CSV output %q but got %q: %v", expected, result, err)
+	}
+}
+
+func TestResultMetrics(t *testing.T) {
+	queryStr := "select $hostname, count($line), sum($errors)/count($line) " +
+		"group by $hostname, $status having count($line) > 1"
+	q, err := NewQuery(queryStr)
+	if err != nil {
+		t.Errorf("Query parse error: %s\n%v: %v", queryStr, q, err)
+		return
+	}
+
+	g := NewGroupSet()
+	for groupKey, count := range map[string]float64{"web2,200": 3, "web1,500": 2, "web1,200": 1} {
+		set := g.GetSet(groupKey)
+		set.Samples = 1
+		set.SValues["$hostname"] = strings.Split(groupKey, ",")[0]
+		set.FValues["count($line)"] = count
+		set.FValues["sum($errors)"] = count * 2
+	}
+
+	families, err := g.Metrics(q, "my-job")
+	if err != nil {
+		t.Errorf("Unable to get metrics: %v", err)
+		return
+	}
+	var buf bytes.Buffer
+	writer := metrics.NewTextWriter(&buf)
+	for _, family := range families {
+		writer.WriteFamily(family)
+	}
+
+	expected := "# HELP dtail_my_job_count_line Result of count($line) of query: " + queryStr + "\n" +
+		"# TYPE dtail_my_job_count_line gauge\n" +
+		"dtail_my_job_count_line{hostname=\"web1\",status=\"500\"} 2\n" +
+		"dtail_my_job_count_line{hostname=\"web2\",status=\"200\"} 3\n" +
+		"# HELP dtail_my_job_sum_errors_count_line Result of sum($errors)/count($line) " +
+		"of query: " + queryStr + "\n" +
+		"# TYPE dtail_my_job_sum_errors_count_line gauge\n" +
+		"dtail_my_job_sum_errors_count_line{hostname=\"web1\",status=\"500\"} 2\n" +
+		"dtail_my_job_sum_errors_count_line{hostname=\"web2\",status=\"200\"} 2\n"
+	if buf.String() != expected {
+		t.Errorf("Expected metrics\n%s\nbut got\n%s", expected, buf.String())
+	}
+}
+
+func TestResultMetricsNameCollision(t *testing.T) {
+	for _, queryStr := range []string{
+		"select count($a.b), count($a_b) group by $hostname",
+		"select count($line) group by $a.b, $a_b",
+	} {
+		q, err := NewQuery(queryStr)
+		if err != nil {
+			t.Errorf("Query parse error: %s\n%v: %v", queryStr, q, err)
+			continue
+		}
+		if err := q.ValidateMetrics("my-job"); err == nil {
+			t.Errorf("Expected an error for the same metric names of '%s'", queryStr)
+		}
+		if _, err := NewGroupSet().Metrics(q, "my-job"); err == nil {
+			t.Errorf("Expected an error getting the metrics of '%s'", queryStr)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package mapr
 import (
 	"errors"
 	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -19,6 +20,10 @@ const (
 	Last                    AggregateOperation = iota
 	Avg                     AggregateOperation = iota
 	Len                     AggregateOperation = iota
+	Percentile              AggregateOperation = iota
+	DCount                  AggregateOperation = iota
+	// An arithmetic expression over aggregations, e.g. "sum(errors)/count(*)".
+	Expression AggregateOperation = iota
 )
 
 // Represents a parsed "select" clause, used by mapr.Query.
@@ -26,73 +31,180 @@ type selectCondition struct {
 	Field        string
 	FieldStorage string
 	Operation    AggregateOperation
+	// The quantile rank (between 0 and 1) of a percentile aggregation.
+	Rank float64
+	// The arithmetic expression, evaluated on the client after the merge.
+	expression *expression
 }
 
 func (sc selectCondition) String() string {
-	return fmt.Sprintf("selectCondition(Field:%s,FieldStorage:%s,Operation:%v)",
+	return fmt.Sprintf("selectCondition(Field:%s,FieldStorage:%s,Operation:%v,Rank:%v,"+
+		"expression:%v)",
 		sc.Field,
 		sc.FieldStorage,
-		sc.Operation)
+		sc.Operation,
+		sc.Rank,
+		sc.expression)
 }
 
 func makeSelectConditions(tokens []token) ([]selectCondition, error) {
 	var sel []selectCondition
-	// Parse select aggregation, e.g. sum(foo)
-	parse := func(token token) (selectCondition, error) {
-		var sc selectCondition
-
-		// With quotes stripped: We got a quoted select expression, e.g.
-		// "select `count($foo)` ...", which will literaly look for field
-		// "count($foo)" without performing the count aggregation.
-		if token.quotesStripped || (!strings.Contains(token.str, "(") && !strings.Contains(token.str, ")")) {
-			sc.Field = token.str
-			sc.FieldStorage = token.str
-			sc.Operation = Last
+	for len(tokens) > 0 {
+		// An arithmetic expression may span multiple tokens, e.g. "sum(foo) / 2".
+		n := tokensExpressionLength(tokens)
+		sc, err := makeSelectCondition(tokensJoinExpression(tokens[:n]))
+		if err != nil {
+			return nil, err
+		}
+		sel = append(sel, sc)
+		tokens = tokens[n:]
+	}
+	return sel, nil
+}
+
+// Parse select aggregation, e.g. sum(foo)
+func makeSelectCondition(token token) (selectCondition, error) {
+	var sc selectCondition
+
+	// With quotes stripped: We got a quoted select expression, e.g.
+	// "select `count($foo)` ...", which will literaly look for field
+	// "count($foo)" without performing the count aggregation.
+	if token.quotesStripped || (!isExpression(token.str) &&
+		!strings.Contains(token.str, "(") && !strings.Contains(token.str, ")")) {
+		sc.Field = token.str
+		sc.FieldStorage = token.str
+		sc.Operation = Last
+		return sc, nil
+	}
+
+	if isExpression(token.str) {
+		return makeSelectExpression(token.str)
+	}
+
+	// A time bucket isn't an aggregation, it's the (last) value of the
+	// bucket field, e.g. "bucket($time,5m)".
+	if strings.HasPrefix(token.str, "bucket(") {
+		sc.Field = token.str
+		sc.FieldStorage = token.str
+		sc.Operation = Last
+		return sc, nil
+	}
+
+	a := strings.Split(token.str, "(")
+	if len(a) != 2 {
+		return sc, errors.New(invalidQuery + "Can't parse 'select' aggregation: " +
+			token.str)
+	}
+	agg := a[0] // Aggregation, e.g. 'sum'
+
+	b := strings.Split(a[1], ")")
+	if len(b) != 2 {
+		return sc, errors.New(invalidQuery + "Can't parse 'select' field name " +
+			"from aggregation: " + token.str)
+	}
+	sc.Field = b[0]             // Field name, e.g. 'foo'
+	sc.FieldStorage = token.str // e.g. 'sum(foo)'
+
+	switch agg {
+	case "count":
+		sc.Operation = Count
+	case "sum":
+		sc.Operation = Sum
+	case "min":
+		sc.Operation = Min
+	case "max":
+		sc.Operation = Max
+	case "last":
+		sc.Operation = Last
+	case "avg":
+		sc.Operation = Avg
+	case "len":
+		sc.Operation = Len
+	case "dcount":
+		sc.Operation = DCount
+	default:
+		if rank, ok := parsePercentile(agg); ok {
+			sc.Operation = Percentile
+			sc.Rank = rank
 			return sc, nil
 		}
+		return sc, errors.New(invalidQuery + "Unknown aggregation in 'select' clause: " + agg)
+	}
+	return sc, nil
+}
 
-		a := strings.Split(token.str, "(")
-		if len(a) != 2 {
-			return sc, errors.New(invalidQuery + "Can't parse 'select' aggregation: " +
-				token.str)
+// Parse an arithmetic expression over aggregations, e.g. "sum(errors)/count(*)".
+// Plain fields (without any aggregation) are used with their last value.
+func makeSelectExpression(str string) (selectCondition, error) {
+	sc := selectCondition{
+		Field:        str,
+		FieldStorage: str,
+		Operation:    Expression,
+	}
+	var err error
+	if sc.expression, err = makeExpression(str); err != nil {
+		return sc, err
+	}
+	for _, operand := range sc.expression.operands() {
+		if operand == "*" || strings.HasPrefix(operand, "bucket(") {
+			return sc, errors.New(invalidQuery + "Can't use '" + operand +
+				"' in arithmetic expression: " + str)
+		}
+		if _, err := makeSelectCondition(token{str: operand, isBareword: true}); err != nil {
+			return sc, err
 		}
-		agg := a[0] // Aggregation, e.g. 'sum'
+	}
+	return sc, nil
+}
+
+// Collect the aggregations of all select conditions. An aggregation used both
+// directly and in an expression must be aggregated only once.
+func (q *Query) parseAggregations() error {
+	q.aggregations = nil
+	seen := make(map[string]struct{}, len(q.Select))
 
-		b := strings.Split(a[1], ")")
-		if len(b) != 2 {
-			return sc, errors.New(invalidQuery + "Can't parse 'select' field name " +
-				"from aggregation: " + token.str)
+	add := func(sc selectCondition) {
+		if _, ok := seen[sc.FieldStorage]; ok {
+			return
 		}
-		sc.Field = b[0]             // Field name, e.g. 'foo'
-		sc.FieldStorage = token.str // e.g. 'sum(foo)'
-
-		switch agg {
-		case "count":
-			sc.Operation = Count
-		case "sum":
-			sc.Operation = Sum
-		case "min":
-			sc.Operation = Min
-		case "max":
-			sc.Operation = Max
-		case "last":
-			sc.Operation = Last
-		case "avg":
-			sc.Operation = Avg
-		case "len":
-			sc.Operation = Len
-		default:
-			return sc, errors.New(invalidQuery + "Unknown aggregation in 'select' clause: " + agg)
+		seen[sc.FieldStorage] = struct{}{}
+		q.aggregations = append(q.aggregations, sc)
+	}
+
+	for _, sc := range q.Select {
+		if sc.Operation != Expression {
+			add(sc)
 		}
-		return sc, nil
 	}
+	for _, sc := range q.Select {
+		if sc.Operation != Expression {
+			continue
+		}
+		for _, operand := range sc.expression.operands() {
+			operandSc, err := makeSelectCondition(token{str: operand, isBareword: true})
+			if err != nil {
+				return err
+			}
+			add(operandSc)
+		}
+	}
+	return nil
+}
 
-	for _, token := range tokens {
-		sc, err := parse(token)
-		if err != nil {
-			return nil, err
+// Parse a percentile aggregation name into its quantile rank, e.g. p50 is 0.5,
+// p95 is 0.95 and p999 is 0.999.
+func parsePercentile(agg string) (float64, bool) {
+	if len(agg) < 3 || agg[0] != 'p' {
+		return 0, false
+	}
+	for _, c := range agg[1:] {
+		if c < '0' || c > '9' {
+			return 0, false
 		}
-		sel = append(sel, sc)
 	}
-	return sel, nil
+	rank, err := strconv.ParseFloat("0."+agg[1:], 64)
+	if err != nil || rank == 0 {
+		return 0, false
+	}
+	return rank, true
 }
@@ -28,6 +28,8 @@ type Aggregate struct {
 	query *mapr.Query
 	// The mapr log format parser
 	parser logformat.Parser
+	// The name of the mapr log format
+	parserName string
 }
 
 // NewAggregate return a new server side aggregator.
@@ -61,6 +63,7 @@ func NewAggregate(queryStr string) (*Aggregate, error) {
 		if logParser, err = logformat.NewParser("generic", query); err != nil {
 			dlog.Server.FatalPanic("Could not create log format parser", err)
 		}
+		parserName = "generic"
 	}
 
 	return &Aggregate{
@@ -70,16 +73,25 @@ func NewAggregate(queryStr string) (*Aggregate, error) {
 		hostname:    s[0],
 		query:       query,
 		parser:      logParser,
+		parserName:  parserName,
 	}, nil
 }
 
+// LogFormat returns the name of the mapr log format and the mapr query.
+func (a *Aggregate) LogFormat() (string, *mapr.Query) {
+	return a.parserName, a.query
+}
+
 // Shutdown the aggregation engine.
 func (a *Aggregate) Shutdown() {
 	a.done.Shutdown()
 }
 
-// Start an aggregation.
-func (a *Aggregate) Start(ctx context.Context, maprMessages chan<- string) {
+// Start an aggregation. With a timeout (if greater than 0) the aggregation
+// stops once it's reached, after serializing the final result.
+func (a *Aggregate) Start(ctx context.Context, timeout time.Duration,
+	maprMessages chan<- string) (timedOut bool) {
+
 	myCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
@@ -93,13 +105,20 @@ func (a *Aggregate) Start(ctx context.Context, maprMessages chan<- string) {
 	}()
 
 	fieldsCh := a.fieldsFromLines(myCtx)
-	// Add fields (e.g. via 'set' clause)
-	if len(a.query.Set) > 0 {
+	// Add fields (e.g. via 'set' clause or time buckets)
+	if len(a.query.Set) > 0 || len(a.query.Buckets) > 0 {
 		fieldsCh = a.setAdditionalFields(myCtx, fieldsCh)
 	}
 	// Periodically pre-aggregate data every a.query.Interval seconds.
 	go a.aggregateTimer(myCtx)
-	a.aggregateAndSerialize(myCtx, fieldsCh, maprMessages)
+
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+	return a.aggregateAndSerialize(myCtx, fieldsCh, maprMessages, timeoutCh)
 }
 
 func (a *Aggregate) aggregateTimer(ctx context.Context) {
@@ -222,6 +241,7 @@ func (a *Aggregate) setAdditionalFields(ctx context.Context,
 			if err := a.query.SetClause(fields); err != nil {
 				dlog.Server.Error(err)
 			}
+			a.query.BucketClause(fields)
 
 			select {
 			case newFieldsCh <- fields:
@@ -233,7 +253,8 @@ func (a *Aggregate) setAdditionalFields(ctx context.Context,
 }
 
 func (a *Aggregate) aggregateAndSerialize(ctx context.Context,
-	fieldsCh <-chan map[string]string, maprMessages chan<- string) {
+	fieldsCh <-chan map[string]string, maprMessages chan<- string,
+	timeoutCh <-chan time.Time) (timedOut bool) {
 
 	group := mapr.NewGroupSet()
 	serialize := func() {
@@ -251,6 +272,10 @@ func (a *Aggregate) aggregateAndSerialize(ctx context.Context,
 			a.aggregate(group, fields)
 		case <-a.serialize:
 			serialize()
+		case <-timeoutCh:
+			dlog.Server.Info("Mapreduce timeout reached")
+			serialize()
+			return true
 		case <-ctx.Done():
 			return
 		}
@@ -271,7 +296,7 @@ func (a *Aggregate) aggregate(group *mapr.GroupSet, fields map[string]string) {
 	set := group.GetSet(groupKey)
 
 	var addedSample bool
-	for _, sc := range a.query.Select {
+	for _, sc := range a.query.Aggregations() {
 		if val, ok := fields[sc.Field]; ok {
 			if err := set.Aggregate(sc.FieldStorage, sc.Operation, val, false); err != nil {
 				dlog.Server.Error(err)
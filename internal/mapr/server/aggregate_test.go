@@ -0,0 +1,64 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mimecast/dtail/internal/config"
+	"github.com/mimecast/dtail/internal/io/dlog"
+	"github.com/mimecast/dtail/internal/io/line"
+	"github.com/mimecast/dtail/internal/source"
+)
+
+func TestMain(m *testing.M) {
+	config.Setup(source.Server, &config.Args{ConfigFile: "none", Logger: "none",
+		What: "test"}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	dlog.Start(ctx, &wg, source.Server)
+
+	code := m.Run()
+	cancel()
+	wg.Wait()
+	os.Exit(code)
+}
+
+func TestAggregateTimeout(t *testing.T) {
+	for _, timeout := range []time.Duration{0, time.Second} {
+		// The interval is too long to serialize an interim result.
+		a, err := NewAggregate("select count($line) interval 3600")
+		if err != nil {
+			t.Fatalf("Unable to create aggregate: %v", err)
+		}
+		linesCh := make(chan *line.Line, 10)
+		for i := 0; i < 3; i++ {
+			linesCh <- line.New(bytes.NewBufferString("Hello"), uint64(i), 100, "a.log")
+		}
+		a.NextLinesCh <- linesCh
+		// Without a timeout, the aggregation runs until all lines were read.
+		if timeout == 0 {
+			close(linesCh)
+		}
+
+		maprMessages := make(chan string, 10)
+		if timedOut := a.Start(context.Background(), timeout, maprMessages); timedOut != (timeout > 0) {
+			t.Errorf("Expected timed out %v with timeout %v but got %v",
+				timeout > 0, timeout, timedOut)
+		}
+
+		// The final result is serialized in any case.
+		if len(maprMessages) != 1 {
+			t.Errorf("Expected one result with timeout %v but got %d", timeout, len(maprMessages))
+			continue
+		}
+		if message := <-maprMessages; !strings.Contains(message, "count($line)≔3") {
+			t.Errorf("Expected a count of 3 with timeout %v but got %q", timeout, message)
+		}
+	}
+}
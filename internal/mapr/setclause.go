@@ -1,5 +1,7 @@
 package mapr
 
+import "strconv"
+
 // SetClause interprets the set clause of the mapreduce query.
 func (q *Query) SetClause(fields map[string]string) error {
 	for _, sc := range q.Set {
@@ -8,8 +10,30 @@ func (q *Query) SetClause(fields map[string]string) error {
 			value = sc.rString
 		}
 		switch sc.rType {
-		case FunctionStack:
-			fields[sc.lString] = sc.functionStack.Call(value)
+		case Arithmetic:
+			result, ok := sc.expression.eval(func(operand string) (float64, bool) {
+				value := fields[operand]
+				if call, ok := sc.expressionCalls[operand]; ok {
+					var err error
+					if value, err = call.Eval(fields); err != nil {
+						return 0, false
+					}
+				}
+				f, err := strconv.ParseFloat(value, 64)
+				return f, err == nil
+			})
+			if !ok {
+				// Leave the field unset, e.g. on division by zero.
+				continue
+			}
+			fields[sc.lString] = strconv.FormatFloat(result, 'f', -1, 64)
+		case FunctionCall:
+			result, err := sc.call.Eval(fields)
+			if err != nil {
+				// Leave the field unset, e.g. on a non-numeric float argument.
+				continue
+			}
+			fields[sc.lString] = result
 		default:
 			fields[sc.lString] = value
 		}
@@ -17,15 +17,18 @@ type setCondition struct {
 	rString string
 	rFloat  float64
 
-	// For now only text functions are supported.
-	// Maybe in the future we can have typed functions too
-	// so that a float input/output is possible.
-	functionStack funcs.FunctionStack
+	// Function call, e.g. "substr($line, 0, 10)".
+	call *funcs.Call
+	// Arithmetic expression over float fields, e.g. "$bytes / 1048576".
+	expression *expression
+	// The function calls used as operands of the arithmetic expression.
+	expressionCalls map[string]*funcs.Call
 }
 
 func (sc *setCondition) String() string {
-	return fmt.Sprintf("setCondition(lString:%s,rString:%s,rType:%s,functionStack:%v)",
-		sc.lString, sc.rString, sc.rType.String(), sc.functionStack)
+	return fmt.Sprintf("setCondition(lString:%s,rString:%s,rType:%s,call:%v,"+
+		"expression:%v)",
+		sc.lString, sc.rString, sc.rType.String(), sc.call, sc.expression)
 }
 
 func makeSetConditions(tokens []token) (set []setCondition, err error) {
@@ -44,15 +47,32 @@ func makeSetConditions(tokens []token) (set []setCondition, err error) {
 			return sc, tokens[3:], nil
 		}
 
+		// Seems like an arithmetic expression? E.g.: "set $mb = $bytes / 1048576"
+		if n := tokensExpressionLength(tokens[2:]); n > 1 || isExpression(sc.rString) {
+			expression, err := makeExpression(tokensJoinExpression(tokens[2 : 2+n]).str)
+			if err != nil {
+				return sc, nil, err
+			}
+			sc.expression = expression
+			sc.rType = Arithmetic
+			sc.rString = expression.String()
+			if sc.expressionCalls, err = makeExpressionCalls(expression); err != nil {
+				return sc, nil, err
+			}
+			return sc, tokens[2+n:], nil
+		}
+
 		// Seems like a function call?
 		if strings.HasSuffix(sc.rString, ")") {
-			functionStack, functionArg, err := funcs.NewFunctionStack(tokens[2].str)
+			call, err := funcs.NewCall(tokens[2].str)
 			if err != nil {
-				return sc, nil, err
+				return sc, nil, errors.New(invalidQuery + err.Error())
+			}
+			sc.call = call
+			sc.rType = FunctionCall
+			if fields := call.Fields(); len(fields) > 0 {
+				sc.rString = fields[0]
 			}
-			sc.functionStack = functionStack
-			sc.rType = FunctionStack
-			sc.rString = functionArg
 			return sc, tokens[3:], nil
 		}
 
@@ -79,6 +99,29 @@ func makeSetConditions(tokens []token) (set []setCondition, err error) {
 	return
 }
 
+// Function calls can be used in arithmetic expressions, e.g. "round($ms) / 1000".
+func makeExpressionCalls(e *expression) (map[string]*funcs.Call, error) {
+	var calls map[string]*funcs.Call
+	for _, operand := range e.operands() {
+		if !strings.HasSuffix(operand, ")") {
+			continue
+		}
+		call, err := funcs.NewCall(operand)
+		if err != nil {
+			return nil, errors.New(invalidQuery + err.Error())
+		}
+		if call.Definition.Result == funcs.String {
+			return nil, errors.New(invalidQuery + "Can't use string function " +
+				call.Definition.String() + " in arithmetic expression")
+		}
+		if calls == nil {
+			calls = make(map[string]*funcs.Call)
+		}
+		calls[operand] = call
+	}
+	return calls, nil
+}
+
 func initSetConditions(sc *setCondition, tokens []token) error {
 	if len(tokens) < 3 {
 		return errors.New(invalidQuery + "Not enough arguments in 'set' clause")
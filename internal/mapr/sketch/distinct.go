@@ -0,0 +1,161 @@
+package sketch
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/bits"
+)
+
+const (
+	// The HyperLogLog precision, 2^12 registers result in a standard error
+	// of about 1.6% while keeping the serialized sketch reasonably small.
+	distinctPrecision uint8 = 12
+	distinctRegisters int   = 1 << distinctPrecision
+
+	distinctSparse byte = 's'
+	distinctDense  byte = 'd'
+)
+
+var errCorruptDistinct = errors.New("Unable to deserialize corrupt distinct count sketch")
+
+// Distinct is a mergeable HyperLogLog sketch for estimating the number of
+// distinct values of a stream of strings.
+type Distinct struct {
+	registers []uint8
+}
+
+// NewDistinct returns a new empty distinct count sketch.
+func NewDistinct() *Distinct {
+	return &Distinct{registers: make([]uint8, distinctRegisters)}
+}
+
+// String representation of the distinct count sketch.
+func (d *Distinct) String() string {
+	return fmt.Sprintf("Distinct(estimate:%v)", d.Value())
+}
+
+// Add a value to the sketch.
+func (d *Distinct) Add(value string) {
+	h := fnv.New64a()
+	h.Write([]byte(value))
+	hash := mix64(h.Sum64())
+
+	index := hash >> (64 - distinctPrecision)
+	rank := uint8(bits.LeadingZeros64(hash<<distinctPrecision|1<<(distinctPrecision-1))) + 1
+	if rank > d.registers[index] {
+		d.registers[index] = rank
+	}
+}
+
+// Merge another distinct count sketch into this one.
+func (d *Distinct) Merge(other *Distinct) {
+	if other == nil {
+		return
+	}
+	for i, rank := range other.registers {
+		if rank > d.registers[i] {
+			d.registers[i] = rank
+		}
+	}
+}
+
+// Value returns the estimated number of distinct values.
+func (d *Distinct) Value() float64 {
+	m := float64(distinctRegisters)
+	var sum float64
+	var zeros int
+
+	for _, rank := range d.registers {
+		sum += 1 / float64(uint64(1)<<rank)
+		if rank == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	// Use linear counting for small cardinalities.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return math.Round(estimate)
+}
+
+// Serialize the sketch, so it can be sent over the wire. The result
+// does not contain any of the DTail protocol delimiters. Sketches with
+// only a few distinct values are serialized sparsely.
+func (d *Distinct) Serialize() string {
+	var used int
+	for _, rank := range d.registers {
+		if rank > 0 {
+			used++
+		}
+	}
+
+	if used*3 >= distinctRegisters {
+		buf := make([]byte, 0, distinctRegisters+1)
+		buf = append(buf, distinctDense)
+		buf = append(buf, d.registers...)
+		return base64.RawStdEncoding.EncodeToString(buf)
+	}
+
+	buf := make([]byte, 0, used*3+1)
+	buf = append(buf, distinctSparse)
+	for i, rank := range d.registers {
+		if rank == 0 {
+			continue
+		}
+		buf = binary.AppendUvarint(buf, uint64(i))
+		buf = append(buf, rank)
+	}
+	return base64.RawStdEncoding.EncodeToString(buf)
+}
+
+// DeserializeDistinct creates a distinct count sketch from its serialized form.
+func DeserializeDistinct(serialized string) (*Distinct, error) {
+	buf, err := base64.RawStdEncoding.DecodeString(serialized)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) == 0 {
+		return nil, errCorruptDistinct
+	}
+
+	d := NewDistinct()
+	switch buf[0] {
+	case distinctDense:
+		if len(buf) != distinctRegisters+1 {
+			return nil, errCorruptDistinct
+		}
+		copy(d.registers, buf[1:])
+	case distinctSparse:
+		buf = buf[1:]
+		for len(buf) > 0 {
+			i, n := binary.Uvarint(buf)
+			if n <= 0 || len(buf) <= n || i >= uint64(distinctRegisters) {
+				return nil, errCorruptDistinct
+			}
+			d.registers[i] = buf[n]
+			buf = buf[n+1:]
+		}
+	default:
+		return nil, errCorruptDistinct
+	}
+	return d, nil
+}
+
+// The FNV hash does not spread similar inputs (e.g. "user1", "user2") well
+// enough over all bits, so finalize it (as done by MurmurHash3).
+func mix64(hash uint64) uint64 {
+	hash ^= hash >> 33
+	hash *= 0xff51afd7ed558ccd
+	hash ^= hash >> 33
+	hash *= 0xc4ceb9fe1a85ec53
+	hash ^= hash >> 33
+	return hash
+}
@@ -0,0 +1,239 @@
+package sketch
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// The relative accuracy of the quantile estimations, e.g. a p99 of 200ms
+// is reported as something between 198ms and 202ms.
+const quantileRelativeAccuracy float64 = 0.01
+
+var errCorruptQuantile = errors.New("Unable to deserialize corrupt quantile sketch")
+
+// Quantile is a mergeable sketch for estimating quantiles (e.g. p50, p95
+// and p99) of a stream of float values. Values are counted in logarithmic
+// buckets, so that merging two sketches (e.g. from two different servers)
+// is as accurate as sketching all the values in a single sketch.
+type Quantile struct {
+	gamma    float64
+	logGamma float64
+	// Buckets of the positive and of the negated negative values.
+	positive map[int]uint64
+	negative map[int]uint64
+	zeros    uint64
+	count    uint64
+	min      float64
+	max      float64
+}
+
+// NewQuantile returns a new empty quantile sketch.
+func NewQuantile() *Quantile {
+	gamma := (1 + quantileRelativeAccuracy) / (1 - quantileRelativeAccuracy)
+	return &Quantile{
+		gamma:    gamma,
+		logGamma: math.Log(gamma),
+		positive: make(map[int]uint64),
+		negative: make(map[int]uint64),
+		min:      math.Inf(1),
+		max:      math.Inf(-1),
+	}
+}
+
+// String representation of the quantile sketch.
+func (q *Quantile) String() string {
+	return fmt.Sprintf("Quantile(count:%d,min:%v,max:%v,buckets:%d)",
+		q.count, q.min, q.max, len(q.positive)+len(q.negative))
+}
+
+// Count returns the number of values added to the sketch.
+func (q *Quantile) Count() uint64 {
+	return q.count
+}
+
+// Add a value to the sketch.
+func (q *Quantile) Add(value float64) {
+	switch {
+	case math.IsNaN(value):
+		return
+	case value > 0:
+		q.positive[q.index(value)]++
+	case value < 0:
+		q.negative[q.index(-value)]++
+	default:
+		q.zeros++
+	}
+	q.count++
+	if value < q.min {
+		q.min = value
+	}
+	if value > q.max {
+		q.max = value
+	}
+}
+
+// Merge another quantile sketch into this one.
+func (q *Quantile) Merge(other *Quantile) {
+	if other == nil || other.count == 0 {
+		return
+	}
+	for i, c := range other.positive {
+		q.positive[i] += c
+	}
+	for i, c := range other.negative {
+		q.negative[i] += c
+	}
+	q.zeros += other.zeros
+	q.count += other.count
+	if other.min < q.min {
+		q.min = other.min
+	}
+	if other.max > q.max {
+		q.max = other.max
+	}
+}
+
+// Value returns the estimated value at quantile rank (between 0 and 1).
+func (q *Quantile) Value(rank float64) float64 {
+	if q.count == 0 {
+		return 0
+	}
+	if rank <= 0 {
+		return q.min
+	}
+	if rank >= 1 {
+		return q.max
+	}
+
+	target := uint64(rank * float64(q.count-1))
+	var seen uint64
+
+	// Negative values first, the largest magnitude is the smallest value.
+	for _, i := range sortedIndexes(q.negative, true) {
+		seen += q.negative[i]
+		if seen > target {
+			return q.clamp(-q.bucketValue(i))
+		}
+	}
+	seen += q.zeros
+	if seen > target {
+		return 0
+	}
+	for _, i := range sortedIndexes(q.positive, false) {
+		seen += q.positive[i]
+		if seen > target {
+			return q.clamp(q.bucketValue(i))
+		}
+	}
+	return q.max
+}
+
+// Serialize the sketch, so it can be sent over the wire. The result
+// does not contain any of the DTail protocol delimiters.
+func (q *Quantile) Serialize() string {
+	buf := make([]byte, 0, 32+(len(q.positive)+len(q.negative))*4)
+	buf = binary.AppendUvarint(buf, q.zeros)
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(q.min))
+	buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(q.max))
+	buf = appendBuckets(buf, q.positive)
+	buf = appendBuckets(buf, q.negative)
+	return base64.RawStdEncoding.EncodeToString(buf)
+}
+
+// DeserializeQuantile creates a quantile sketch from its serialized form.
+func DeserializeQuantile(serialized string) (*Quantile, error) {
+	buf, err := base64.RawStdEncoding.DecodeString(serialized)
+	if err != nil {
+		return nil, err
+	}
+
+	q := NewQuantile()
+	var n int
+	if q.zeros, n = binary.Uvarint(buf); n <= 0 {
+		return nil, errCorruptQuantile
+	}
+	buf = buf[n:]
+	if len(buf) < 16 {
+		return nil, errCorruptQuantile
+	}
+	q.min = math.Float64frombits(binary.LittleEndian.Uint64(buf))
+	q.max = math.Float64frombits(binary.LittleEndian.Uint64(buf[8:]))
+	buf = buf[16:]
+
+	if buf, err = readBuckets(buf, q.positive); err != nil {
+		return nil, err
+	}
+	if _, err = readBuckets(buf, q.negative); err != nil {
+		return nil, err
+	}
+
+	q.count = q.zeros
+	for _, c := range q.positive {
+		q.count += c
+	}
+	for _, c := range q.negative {
+		q.count += c
+	}
+	return q, nil
+}
+
+func (q *Quantile) index(value float64) int {
+	return int(math.Ceil(math.Log(value) / q.logGamma))
+}
+
+func (q *Quantile) bucketValue(index int) float64 {
+	return 2 * math.Pow(q.gamma, float64(index)) / (q.gamma + 1)
+}
+
+// The bucket value is an estimation, it must not be outside of the seen values.
+func (q *Quantile) clamp(value float64) float64 {
+	return math.Max(q.min, math.Min(q.max, value))
+}
+
+func sortedIndexes(buckets map[int]uint64, reverse bool) []int {
+	indexes := make([]int, 0, len(buckets))
+	for i := range buckets {
+		indexes = append(indexes, i)
+	}
+	if reverse {
+		sort.Sort(sort.Reverse(sort.IntSlice(indexes)))
+	} else {
+		sort.Ints(indexes)
+	}
+	return indexes
+}
+
+func appendBuckets(buf []byte, buckets map[int]uint64) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(buckets)))
+	for i, c := range buckets {
+		buf = binary.AppendVarint(buf, int64(i))
+		buf = binary.AppendUvarint(buf, c)
+	}
+	return buf
+}
+
+func readBuckets(buf []byte, buckets map[int]uint64) ([]byte, error) {
+	num, n := binary.Uvarint(buf)
+	if n <= 0 {
+		return nil, errCorruptQuantile
+	}
+	buf = buf[n:]
+	for j := uint64(0); j < num; j++ {
+		i, n := binary.Varint(buf)
+		if n <= 0 {
+			return nil, errCorruptQuantile
+		}
+		buf = buf[n:]
+		c, n := binary.Uvarint(buf)
+		if n <= 0 {
+			return nil, errCorruptQuantile
+		}
+		buf = buf[n:]
+		buckets[int(i)] += c
+	}
+	return buf, nil
+}
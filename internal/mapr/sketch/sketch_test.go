@@ -0,0 +1,96 @@
+package sketch
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestQuantile(t *testing.T) {
+	q := NewQuantile()
+	for i := 1; i <= 1000; i++ {
+		q.Add(float64(i))
+	}
+
+	expected := map[float64]float64{0.5: 500, 0.95: 950, 0.99: 990}
+	for rank, value := range expected {
+		if got := q.Value(rank); math.Abs(got-value) > value*quantileRelativeAccuracy {
+			t.Errorf("Expected quantile %v to be about %v but got %v", rank, value, got)
+		}
+	}
+	if got := q.Value(1); got != 1000 {
+		t.Errorf("Expected quantile 1 to be the max value 1000 but got %v", got)
+	}
+}
+
+func TestQuantileMerge(t *testing.T) {
+	// Simulate two servers, one sketch each, merged on the client.
+	a, b := NewQuantile(), NewQuantile()
+	for i := 1; i <= 1000; i++ {
+		if i%2 == 0 {
+			a.Add(float64(i))
+			continue
+		}
+		b.Add(-float64(i))
+	}
+
+	serialized := b.Serialize()
+	b2, err := DeserializeQuantile(serialized)
+	if err != nil {
+		t.Errorf("Unable to deserialize quantile sketch '%s': %v", serialized, err)
+	}
+	if b2.Count() != b.Count() {
+		t.Errorf("Expected %d values after deserialize(serialize(..)) but got %d",
+			b.Count(), b2.Count())
+	}
+
+	a.Merge(b2)
+	if a.Count() != 1000 {
+		t.Errorf("Expected 1000 values in merged sketch but got %d", a.Count())
+	}
+	if got := a.Value(0.5); math.Abs(got) > 2 {
+		t.Errorf("Expected merged median to be about 0 but got %v", got)
+	}
+	if got := a.Value(0); got != -999 {
+		t.Errorf("Expected merged minimum to be -999 but got %v", got)
+	}
+
+	if _, err := DeserializeQuantile("!corrupt!"); err == nil {
+		t.Errorf("Expected error deserializing corrupt quantile sketch")
+	}
+}
+
+func TestDistinct(t *testing.T) {
+	inputs := []int{0, 1, 10, 1000, 100000}
+
+	for _, num := range inputs {
+		// Simulate two servers seeing overlapping values.
+		a, b := NewDistinct(), NewDistinct()
+		for i := 0; i < num; i++ {
+			a.Add(fmt.Sprintf("user%d", i))
+			if i%3 == 0 {
+				b.Add(fmt.Sprintf("user%d", i))
+			}
+		}
+
+		serialized := b.Serialize()
+		b2, err := DeserializeDistinct(serialized)
+		if err != nil {
+			t.Errorf("Unable to deserialize distinct sketch '%s': %v", serialized, err)
+		}
+		if b2.Value() != b.Value() {
+			t.Errorf("Expected estimate %v after deserialize(serialize(..)) but got %v",
+				b.Value(), b2.Value())
+		}
+
+		a.Merge(b2)
+		got := a.Value()
+		if math.Abs(got-float64(num)) > float64(num)*0.05 {
+			t.Errorf("Expected distinct count to be about %d but got %v", num, got)
+		}
+	}
+
+	if _, err := DeserializeDistinct("AA"); err == nil {
+		t.Errorf("Expected error deserializing corrupt distinct sketch")
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"strings"
 )
 
-var keywords = [...]string{"select", "from", "where", "set", "group", "rorder",
+var keywords = [...]string{"select", "from", "where", "set", "group", "having", "rorder",
 	"order", "interval", "limit", "outfile", "logformat"}
 
 // Represents a parsed token, used to parse the mapr query.
@@ -26,33 +26,97 @@ func (t token) isKeyword() bool {
 	return false
 }
 
+func (t token) isArithmeticOperator() bool {
+	return t.isBareword && !t.quotesStripped && len(t.str) == 1 &&
+		strings.Contains(arithmeticOperators, t.str)
+}
+
 func (t token) String() string {
 	return t.str
 }
 
 func tokenize(queryStr string) []token {
 	var tokens []token
-	for i, part := range strings.Split(queryStr, "\"") {
-		// Even i, means that it is not a quoted string
-		if i%2 == 0 {
-			commasStripped := strings.Replace(part, ",", " ", -1)
-			for _, tokenStr := range strings.Fields(commasStripped) {
-				token := token{
-					str:        tokenStr,
-					isBareword: true,
-				}
-				tokens = append(tokens, token)
+	var sb strings.Builder
+
+	addBareword := func() {
+		if sb.Len() > 0 {
+			tokens = append(tokens, token{str: sb.String(), isBareword: true})
+			sb.Reset()
+		}
+	}
+
+	for i := 0; i < len(queryStr); i++ {
+		c := queryStr[i]
+		switch {
+		case c == '"':
+			// Add whole quoted string as a token
+			addBareword()
+			end := strings.IndexByte(queryStr[i+1:], '"')
+			if end == -1 {
+				end = len(queryStr) - i - 1
 			}
+			tokens = append(tokens, token{str: queryStr[i+1 : i+1+end], isBareword: false})
+			i += end + 1
+		case c == '(' && isFunctionName(sb.String()):
+			// Add whole function call, e.g. 'bucket($time, 5m)', as a single
+			// bareword token without any whitespaces (but keep quoted strings).
+			i = tokenizeFunctionCall(queryStr, i, &sb)
+		case c == ',' || c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			addBareword()
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	addBareword()
+
+	return tokens
+}
+
+// Determines whether a bareword followed by '(' is a function call (e.g. an
+// aggregation such as 'count(') and not just a logical operator followed by
+// a parenthesis, e.g. 'not('.
+func isFunctionName(name string) bool {
+	if name == "" || strings.HasSuffix(name, "(") {
+		return false
+	}
+	switch strings.ToLower(name) {
+	case "and", "or", "not":
+		return false
+	default:
+		return true
+	}
+}
+
+// Consumes a function call starting at the opening parenthesis at index i and
+// returns the index of the matching closing parenthesis.
+func tokenizeFunctionCall(queryStr string, i int, sb *strings.Builder) int {
+	var depth int
+	for ; i < len(queryStr); i++ {
+		c := queryStr[i]
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ' ', '\t', '\n', '\r':
+			continue
+		case '"':
+			end := strings.IndexByte(queryStr[i+1:], '"')
+			if end == -1 {
+				sb.WriteString(queryStr[i:])
+				return len(queryStr)
+			}
+			sb.WriteString(queryStr[i : i+2+end])
+			i += end + 1
 			continue
 		}
-		// Add whole quoted string as a token
-		token := token{
-			str:        part,
-			isBareword: false,
+		sb.WriteByte(c)
+		if depth == 0 {
+			return i
 		}
-		tokens = append(tokens, token)
 	}
-	return tokens
+	return i
 }
 
 func tokensConsume(tokens []token) ([]token, []token) {
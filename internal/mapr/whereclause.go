@@ -8,21 +8,21 @@ import (
 
 // WhereClause interprets the where clause of the mapreduce query.
 func (q *Query) WhereClause(fields map[string]string) bool {
-	for _, wc := range q.Where {
-		if wc.Operation > FloatOperation {
-			if !whereClauseFloatValues(fields, wc) {
-				return false
-			}
-			continue
-		}
-		if !whereClauseStringValues(fields, wc) {
-			return false
-		}
+	if q.Where == nil {
+		return true
 	}
-	return true
+	return q.Where.eval(fields)
+}
+
+// Evaluate a single where condition.
+func (wc *whereCondition) eval(fields map[string]string) bool {
+	if wc.Operation > FloatOperation {
+		return whereClauseFloatValues(fields, wc)
+	}
+	return whereClauseStringValues(fields, wc)
 }
 
-func whereClauseFloatValues(fields map[string]string, wc whereCondition) bool {
+func whereClauseFloatValues(fields map[string]string, wc *whereCondition) bool {
 	var lValue, rValue float64
 	var ok bool
 
@@ -61,7 +61,7 @@ func whereClauseFloatValue(fields map[string]string, str string, float float64,
 	}
 }
 
-func whereClauseStringValues(fields map[string]string, wc whereCondition) bool {
+func whereClauseStringValues(fields map[string]string, wc *whereCondition) bool {
 	var lValue, rValue string
 	var ok bool
 
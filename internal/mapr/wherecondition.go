@@ -3,6 +3,7 @@ package mapr
 import (
 	"errors"
 	"fmt"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -23,6 +24,8 @@ const (
 	StringNotHasPrefix  QueryOperation = iota
 	StringHasSuffix     QueryOperation = iota
 	StringNotHasSuffix  QueryOperation = iota
+	StringMatches       QueryOperation = iota
+	StringNotMatches    QueryOperation = iota
 	FloatOperation      QueryOperation = iota
 	FloatEq             QueryOperation = iota
 	FloatNe             QueryOperation = iota
@@ -43,6 +46,8 @@ type whereCondition struct {
 	rType   fieldType
 	rString string
 	rFloat  float64
+	// The compiled rValue of the (n)matches operations.
+	rRegex *regexp.Regexp
 }
 
 func (wc *whereCondition) String() string {
@@ -52,73 +57,61 @@ func (wc *whereCondition) String() string {
 		wc.rFloat, wc.rType.String())
 }
 
-func makeWhereConditions(tokens []token) (where []whereCondition, err error) {
-
-	// Helper to parse a where condition.
-	parse := func(tokens []token) (whereCondition, []token, error) {
-		var wc whereCondition
-		if len(tokens) < 3 {
-			return wc, nil, errors.New(invalidQuery + "Not enough arguments in 'where' clause")
-		}
-
-		whereOp := strings.ToLower(tokens[1].str)
-		switch whereOp {
-		case "==":
-			wc.Operation = FloatEq
-		case "!=":
-			wc.Operation = FloatNe
-		case "<":
-			wc.Operation = FloatLt
-		case "<=":
-			wc.Operation = FloatLe
-		case "=<":
-			wc.Operation = FloatLe
-		case ">":
-			wc.Operation = FloatGt
-		case ">=":
-			wc.Operation = FloatGe
-		case "=>":
-			wc.Operation = FloatGe
-		case "eq":
-			wc.Operation = StringEq
-		case "ne":
-			wc.Operation = StringNe
-		case "contains":
-			wc.Operation = StringContains
-		case "lacks":
-			fallthrough
-		case "ncontains":
-			wc.Operation = StringNotContains
-		case "hasprefix":
-			wc.Operation = StringHasPrefix
-		case "nhasprefix":
-			wc.Operation = StringNotHasPrefix
-		case "hassuffix":
-			wc.Operation = StringHasSuffix
-		case "nhassuffix":
-			wc.Operation = StringNotHasSuffix
-		default:
-			return wc, nil, errors.New(invalidQuery +
-				"Unknown operation in 'where' clause: " + whereOp)
-		}
-
-		var err error
-		tokens, err = wc.fill(tokens)
-		return wc, tokens, err
+// Parse a single where condition, e.g. "foo == 42", from the tokens.
+func makeWhereCondition(tokens []token) (whereCondition, []token, error) {
+	var wc whereCondition
+	if len(tokens) < 3 {
+		return wc, nil, errors.New(invalidQuery + "Not enough arguments in 'where' clause")
 	}
 
-	// Consume all where conditions.
-	for len(tokens) > 0 {
-		var wc whereCondition
-		var err error
-		wc, tokens, err = parse(tokens)
-		if err != nil {
-			return nil, err
-		}
-		where = append(where, wc)
-		tokens = tokensConsumeOptional(tokens, "and")
+	whereOp := strings.ToLower(tokens[1].str)
+	switch whereOp {
+	case "==":
+		wc.Operation = FloatEq
+	case "!=":
+		wc.Operation = FloatNe
+	case "<":
+		wc.Operation = FloatLt
+	case "<=":
+		wc.Operation = FloatLe
+	case "=<":
+		wc.Operation = FloatLe
+	case ">":
+		wc.Operation = FloatGt
+	case ">=":
+		wc.Operation = FloatGe
+	case "=>":
+		wc.Operation = FloatGe
+	case "eq":
+		wc.Operation = StringEq
+	case "ne":
+		wc.Operation = StringNe
+	case "contains":
+		wc.Operation = StringContains
+	case "lacks":
+		fallthrough
+	case "ncontains":
+		wc.Operation = StringNotContains
+	case "hasprefix":
+		wc.Operation = StringHasPrefix
+	case "nhasprefix":
+		wc.Operation = StringNotHasPrefix
+	case "hassuffix":
+		wc.Operation = StringHasSuffix
+	case "nhassuffix":
+		wc.Operation = StringNotHasSuffix
+	case "matches":
+		wc.Operation = StringMatches
+	case "nmatches":
+		wc.Operation = StringNotMatches
+	default:
+		return wc, nil, errors.New(invalidQuery +
+			"Unknown operation in 'where' clause: " + whereOp)
 	}
-	return
+
+	var err error
+	tokens, err = wc.fill(tokens)
+	return wc, tokens, err
 }
 
 // Fill a where condition.
@@ -164,6 +157,20 @@ func (wc *whereCondition) fill(tokens []token) ([]token, error) {
 		wc.rType = String
 	}
 
+	if wc.Operation == StringMatches || wc.Operation == StringNotMatches {
+		// Compile the regex only once at query parse time.
+		if wc.rType != String {
+			return nil, errors.New(invalidQuery +
+				"Expected quoted regex at 'where' clause's rValue: " + tokens[2].str)
+		}
+		re, err := regexp.Compile(wc.rString)
+		if err != nil {
+			return nil, errors.New(invalidQuery + "Unable to compile regex in 'where' " +
+				"clause: " + err.Error())
+		}
+		wc.rRegex = re
+	}
+
 	return tokens[3:], nil
 }
 
@@ -205,6 +212,10 @@ func (wc *whereCondition) stringClause(lValue string, rValue string) bool {
 		return strings.HasSuffix(lValue, rValue)
 	case StringNotHasSuffix:
 		return !strings.HasSuffix(lValue, rValue)
+	case StringMatches:
+		return wc.rRegex.MatchString(lValue)
+	case StringNotMatches:
+		return !wc.rRegex.MatchString(lValue)
 	default:
 		dlog.Common.Error("Unknown string operation", lValue, wc.Operation, rValue)
 	}
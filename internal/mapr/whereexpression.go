@@ -0,0 +1,236 @@
+package mapr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// LogicalOperation determines how where expressions are combined.
+type LogicalOperation int
+
+// The possible logical operations.
+const (
+	UndefLogicalOperation LogicalOperation = iota
+	LogicalCondition      LogicalOperation = iota
+	LogicalAnd            LogicalOperation = iota
+	LogicalOr             LogicalOperation = iota
+	LogicalNot            LogicalOperation = iota
+)
+
+func (o LogicalOperation) String() string {
+	switch o {
+	case LogicalCondition:
+		return "Condition"
+	case LogicalAnd:
+		return "And"
+	case LogicalOr:
+		return "Or"
+	case LogicalNot:
+		return "Not"
+	default:
+		return "UndefLogicalOperation"
+	}
+}
+
+// Represents a parsed "where" clause as an expression tree, used by mapr.Query.
+// The leaves of the tree are where conditions, all other nodes combine their
+// children with and, or or not.
+type whereExpression struct {
+	Operation LogicalOperation
+	condition *whereCondition
+	children  []*whereExpression
+}
+
+func (we *whereExpression) String() string {
+	if we.Operation == LogicalCondition {
+		return we.condition.String()
+	}
+	return fmt.Sprintf("whereExpression(Operation:%s,children:%v)", we.Operation, we.children)
+}
+
+// Evaluate the expression tree against the fields of a log line.
+func (we *whereExpression) eval(fields map[string]string) bool {
+	switch we.Operation {
+	case LogicalCondition:
+		return we.condition.eval(fields)
+	case LogicalAnd:
+		for _, child := range we.children {
+			if !child.eval(fields) {
+				return false
+			}
+		}
+		return true
+	case LogicalOr:
+		for _, child := range we.children {
+			if child.eval(fields) {
+				return true
+			}
+		}
+		return false
+	case LogicalNot:
+		return !we.children[0].eval(fields)
+	default:
+		return false
+	}
+}
+
+// Return all where conditions (leaves) of the expression tree in query order.
+func (we *whereExpression) conditions() []*whereCondition {
+	if we == nil {
+		return nil
+	}
+	if we.Operation == LogicalCondition {
+		return []*whereCondition{we.condition}
+	}
+	var conditions []*whereCondition
+	for _, child := range we.children {
+		conditions = append(conditions, child.conditions()...)
+	}
+	return conditions
+}
+
+// Helper to parse the tokens of a where clause into an expression tree.
+type whereParser struct {
+	tokens []token
+}
+
+func makeWhereExpression(tokens []token) (*whereExpression, error) {
+	p := whereParser{tokens: tokensSplitParentheses(tokens)}
+	if len(p.tokens) == 0 {
+		return nil, nil
+	}
+
+	we, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if len(p.tokens) > 0 {
+		return nil, errors.New(invalidQuery + "Unexpected token in 'where' clause: " +
+			p.tokens[0].str)
+	}
+	return we, nil
+}
+
+// Is the next token the given (unquoted) logical operator or parenthesis?
+func (p *whereParser) peek(what string) bool {
+	if len(p.tokens) == 0 || !p.tokens[0].isBareword || p.tokens[0].quotesStripped {
+		return false
+	}
+	return strings.EqualFold(p.tokens[0].str, what)
+}
+
+func (p *whereParser) parseOr() (*whereExpression, error) {
+	we, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	or := &whereExpression{Operation: LogicalOr, children: []*whereExpression{we}}
+
+	for p.peek("or") {
+		p.tokens = p.tokens[1:]
+		if we, err = p.parseAnd(); err != nil {
+			return nil, err
+		}
+		or.children = append(or.children, we)
+	}
+
+	if len(or.children) == 1 {
+		return or.children[0], nil
+	}
+	return or, nil
+}
+
+// Subsequent conditions without any logical operator in between are
+// implicitly combined with and.
+func (p *whereParser) parseAnd() (*whereExpression, error) {
+	we, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	and := &whereExpression{Operation: LogicalAnd, children: []*whereExpression{we}}
+
+	for len(p.tokens) > 0 && !p.peek("or") && !p.peek(")") {
+		if p.peek("and") {
+			p.tokens = p.tokens[1:]
+		}
+		if we, err = p.parseNot(); err != nil {
+			return nil, err
+		}
+		and.children = append(and.children, we)
+	}
+
+	if len(and.children) == 1 {
+		return and.children[0], nil
+	}
+	return and, nil
+}
+
+func (p *whereParser) parseNot() (*whereExpression, error) {
+	switch {
+	case p.peek("not"):
+		p.tokens = p.tokens[1:]
+		we, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &whereExpression{Operation: LogicalNot, children: []*whereExpression{we}}, nil
+
+	case p.peek("("):
+		p.tokens = p.tokens[1:]
+		we, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peek(")") {
+			return nil, errors.New(invalidQuery + "Missing ')' in 'where' clause")
+		}
+		p.tokens = p.tokens[1:]
+		return we, nil
+
+	case p.peek(")"):
+		return nil, errors.New(invalidQuery + "Unexpected ')' in 'where' clause")
+	}
+
+	wc, tokens, err := makeWhereCondition(p.tokens)
+	if err != nil {
+		return nil, err
+	}
+	p.tokens = tokens
+	return &whereExpression{Operation: LogicalCondition, condition: &wc}, nil
+}
+
+// The query tokenizer doesn't separate parentheses from the barewords, e.g.
+// "(foo" or "bar))". So split them into separate tokens here.
+func tokensSplitParentheses(tokens []token) []token {
+	var splitted []token
+	parenthesis := func(str string) token {
+		return token{str: str, isBareword: true}
+	}
+
+	for _, t := range tokens {
+		if !t.isBareword || t.quotesStripped {
+			splitted = append(splitted, t)
+			continue
+		}
+		str := t.str
+		for strings.HasPrefix(str, "(") {
+			splitted = append(splitted, parenthesis("("))
+			str = str[1:]
+		}
+		// Keep the closing parentheses of function calls, e.g. "count($line)".
+		var closing int
+		for strings.HasSuffix(str, ")") &&
+			strings.Count(str, ")") > strings.Count(str, "(") {
+			closing++
+			str = str[:len(str)-1]
+		}
+		if str != "" {
+			splitted = append(splitted, token{str: str, isBareword: true})
+		}
+		for ; closing > 0; closing-- {
+			splitted = append(splitted, parenthesis(")"))
+		}
+	}
+	return splitted
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+)
+
+// Label of a sample.
+type Label struct {
+	Name  string
+	Value string
+}
+
+// Sample is a single value of a metric.
+type Sample struct {
+	Labels []Label
+	Value  float64
+}
+
+// Family is a metric with all its samples.
+type Family struct {
+	Name    string
+	Help    string
+	Type    Type
+	Samples []Sample
+}
+
+// SortSamples sorts the samples by their label values.
+func SortSamples(samples []Sample) {
+	sort.SliceStable(samples, func(i, j int) bool {
+		a, b := samples[i].Labels, samples[j].Labels
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k].Value != b[k].Value {
+				return a[k].Value < b[k].Value
+			}
+		}
+		return len(a) < len(b)
+	})
+}
+
+// Families holds metrics which are replaced all at once, e.g. the metrics of
+// each interval result of a continuous mapr job.
+type Families struct {
+	mutex    sync.Mutex
+	families map[string][]Family
+}
+
+// NewFamilies returns a new empty set of metric families.
+func NewFamilies() *Families {
+	return &Families{families: make(map[string][]Family)}
+}
+
+// Set replaces all metric families of the given key.
+func (f *Families) Set(key string, families []Family) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.families[key] = families
+}
+
+// Delete removes all metric families of the given key.
+func (f *Families) Delete(key string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	delete(f.families, key)
+}
+
+// All returns the metric families of all keys sorted by key.
+func (f *Families) All() []Family {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	keys := make([]string, 0, len(f.families))
+	for key := range f.families {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var families []Family
+	for _, key := range keys {
+		families = append(families, f.families[key]...)
+	}
+	return families
+}
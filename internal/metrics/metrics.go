@@ -0,0 +1,131 @@
+// Package metrics keeps track of the DTail server metrics, so that they can be
+// exposed in the Prometheus text format (e.g. for alerting on the health of
+// the server without having to parse its logs).
+package metrics
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// The metrics updated by the various parts of the server.
+var (
+	// BytesRead is the number of bytes read from all log files.
+	BytesRead Counter
+	// LinesRead is the number of lines read from all log files.
+	LinesRead Counter
+	// LinesMatched is the number of lines matching the regex of a command.
+	LinesMatched Counter
+	// LinesNotMatched is the number of lines not matching the regex of a command.
+	LinesNotMatched Counter
+	// LinesDropped is the number of matching lines which weren't sent to the
+	// client as it was too slow to process all of them.
+	LinesDropped Counter
+	// ActiveCommands is the number of currently running commands per user.
+	ActiveCommands = NewVec("user")
+	// JobRunning is 1 while a scheduled or continuous mapr job runs, 0 otherwise.
+	JobRunning = NewVec("type", "job")
+	// JobRuns is the number of runs of a scheduled or continuous mapr job.
+	JobRuns = NewVec("type", "job")
+	// JobLastExitStatus is the exit status of the last run of a mapr job.
+	JobLastExitStatus = NewVec("type", "job")
+	// JobResults are the latest results of the continuous mapr jobs.
+	JobResults = NewFamilies()
+)
+
+// Counter is a monotonically increasing metric.
+type Counter struct {
+	value uint64
+}
+
+// Add adds delta to the counter.
+func (c *Counter) Add(delta uint64) {
+	atomic.AddUint64(&c.value, delta)
+}
+
+// Inc increments the counter by one.
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.value, 1)
+}
+
+// Value returns the current value of the counter.
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.value)
+}
+
+// Vec is a metric partitioned by label values, e.g. the active commands per user.
+type Vec struct {
+	mutex      sync.Mutex
+	labelNames []string
+	values     map[string]*vecValue
+}
+
+type vecValue struct {
+	labelValues []string
+	value       float64
+}
+
+// NewVec returns a new metric partitioned by the given label names.
+func NewVec(labelNames ...string) *Vec {
+	return &Vec{
+		labelNames: labelNames,
+		values:     make(map[string]*vecValue),
+	}
+}
+
+func (v *Vec) get(labelValues []string) *vecValue {
+	// The label values are joined by a byte which is invalid in UTF-8.
+	key := strings.Join(labelValues, "\xff")
+	value, ok := v.values[key]
+	if !ok {
+		value = &vecValue{labelValues: append([]string{}, labelValues...)}
+		v.values[key] = value
+	}
+	return value
+}
+
+// Add adds delta to the value of the given label values.
+func (v *Vec) Add(delta float64, labelValues ...string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.get(labelValues).value += delta
+}
+
+// Set sets the value of the given label values.
+func (v *Vec) Set(value float64, labelValues ...string) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	v.get(labelValues).value = value
+}
+
+// Value returns the value of the given label values.
+func (v *Vec) Value(labelValues ...string) float64 {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	return v.get(labelValues).value
+}
+
+// Returns all values as samples sorted by their label values.
+func (v *Vec) samples() []Sample {
+	v.mutex.Lock()
+	values := make([]vecValue, 0, len(v.values))
+	for _, value := range v.values {
+		values = append(values, *value)
+	}
+	v.mutex.Unlock()
+
+	samples := make([]Sample, len(values))
+	for i, value := range values {
+		samples[i].Value = value.value
+		for j, labelName := range v.labelNames {
+			var labelValue string
+			if j < len(value.labelValues) {
+				labelValue = value.labelValues[j]
+			}
+			samples[i].Labels = append(samples[i].Labels, Label{Name: labelName, Value: labelValue})
+		}
+	}
+	SortSamples(samples)
+	return samples
+}
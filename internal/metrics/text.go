@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Type is the Prometheus type of a metric.
+type Type string
+
+// The metric types used by DTail.
+const (
+	CounterType Type = "counter"
+	GaugeType   Type = "gauge"
+)
+
+// TextWriter writes metrics in the Prometheus text exposition format. The
+// first error is remembered and all following writes are skipped.
+type TextWriter struct {
+	writer io.Writer
+	err    error
+}
+
+// NewTextWriter returns a new Prometheus text format writer.
+func NewTextWriter(writer io.Writer) *TextWriter {
+	return &TextWriter{writer: writer}
+}
+
+// Err returns the first error occurred while writing.
+func (t *TextWriter) Err() error {
+	return t.err
+}
+
+// Write writes a metric without labels.
+func (t *TextWriter) Write(name, help string, metricType Type, value float64) {
+	t.header(name, help, metricType)
+	t.printf("%s %s\n", name, formatValue(value))
+}
+
+// WriteVec writes a metric partitioned by labels.
+func (t *TextWriter) WriteVec(name, help string, metricType Type, v *Vec) {
+	t.WriteFamily(Family{Name: name, Help: help, Type: metricType, Samples: v.samples()})
+}
+
+// WriteFamily writes a metric with all its samples.
+func (t *TextWriter) WriteFamily(f Family) {
+	t.header(f.Name, f.Help, f.Type)
+	for _, sample := range f.Samples {
+		if len(sample.Labels) == 0 {
+			t.printf("%s %s\n", f.Name, formatValue(sample.Value))
+			continue
+		}
+		var sb strings.Builder
+		for i, label := range sample.Labels {
+			if i > 0 {
+				sb.WriteString(",")
+			}
+			sb.WriteString(fmt.Sprintf(`%s="%s"`, label.Name, escapeLabelValue(label.Value)))
+		}
+		t.printf("%s{%s} %s\n", f.Name, sb.String(), formatValue(sample.Value))
+	}
+}
+
+func (t *TextWriter) header(name, help string, metricType Type) {
+	t.printf("# HELP %s %s\n", name, escapeHelp(help))
+	t.printf("# TYPE %s %s\n", name, metricType)
+}
+
+func (t *TextWriter) printf(format string, args ...interface{}) {
+	if t.err != nil {
+		return
+	}
+	_, t.err = fmt.Fprintf(t.writer, format, args...)
+}
+
+// Formats NaN and the infinities as "NaN", "+Inf" and "-Inf" as expected.
+func formatValue(value float64) string {
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escapeHelp(help string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(help)
+}
+
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(value)
+}
+
+// SanitizeName turns a string into a valid metric or label name, e.g.
+// "count($line)" into "count_line". Each run of invalid characters becomes a
+// single underscore.
+func SanitizeName(name string) string {
+	var sb strings.Builder
+	underscore := false
+	for _, r := range name {
+		valid := (r >= 'a' && r <= 'z') ||
+			(r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+		if !valid {
+			underscore = true
+			continue
+		}
+		if underscore && sb.Len() > 0 {
+			sb.WriteString("_")
+		}
+		underscore = false
+		sb.WriteRune(r)
+	}
+	sanitized := sb.String()
+	if sanitized == "" || (sanitized[0] >= '0' && sanitized[0] <= '9') {
+		return "_" + sanitized
+	}
+	return sanitized
+}
@@ -0,0 +1,63 @@
+package metrics
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestTextWriter(t *testing.T) {
+	v := NewVec("user", "job")
+	v.Add(2, "paul", "foo")
+	v.Add(-1, "paul", "foo")
+	v.Set(3, "anna", "say \"hello\"\nand\\bye")
+
+	var buf bytes.Buffer
+	writer := NewTextWriter(&buf)
+	writer.Write("dtail_lines_read_total", "Lines read\nfrom files", CounterType, 42)
+	writer.Write("dtail_regex_hit_ratio", "Hit ratio", GaugeType, math.NaN())
+	writer.WriteVec("dtail_jobs", "Jobs", GaugeType, v)
+	if err := writer.Err(); err != nil {
+		t.Errorf("Unable to write metrics: %v", err)
+		return
+	}
+
+	expected := `# HELP dtail_lines_read_total Lines read\nfrom files
+# TYPE dtail_lines_read_total counter
+dtail_lines_read_total 42
+# HELP dtail_regex_hit_ratio Hit ratio
+# TYPE dtail_regex_hit_ratio gauge
+dtail_regex_hit_ratio NaN
+# HELP dtail_jobs Jobs
+# TYPE dtail_jobs gauge
+dtail_jobs{user="anna",job="say \"hello\"\nand\\bye"} 3
+dtail_jobs{user="paul",job="foo"} 1
+`
+	if buf.String() != expected {
+		t.Errorf("Expected metrics\n%s\nbut got\n%s", expected, buf.String())
+	}
+}
+
+func TestCounter(t *testing.T) {
+	var c Counter
+	c.Inc()
+	c.Add(41)
+	if c.Value() != 42 {
+		t.Errorf("Expected 42 but got %d", c.Value())
+	}
+}
+
+func TestSanitizeName(t *testing.T) {
+	for name, expected := range map[string]string{
+		"count($line)":         "count_line",
+		"$hostname":            "hostname",
+		"avg(latency) / 1000":  "avg_latency_1000",
+		"percentile($time,.9)": "percentile_time_9",
+		"42":                   "_42",
+		"foo_bar":              "foo_bar",
+	} {
+		if sanitized := SanitizeName(name); sanitized != expected {
+			t.Errorf("Expected '%s' for '%s' but got '%s'", expected, name, sanitized)
+		}
+	}
+}
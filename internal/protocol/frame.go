@@ -0,0 +1,79 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+)
+
+// MessageType is the type of a message in the frame header.
+type MessageType byte
+
+// The message types are the first characters of the (tagged) message types
+// of the delimited protocol.
+const (
+	// RemoteMessage is a log line.
+	RemoteMessage MessageType = 'R'
+	// ServerMessage is a message of the server to be displayed.
+	ServerMessage MessageType = 'S'
+	// AggregateMessage is mapreduce-aggregated data.
+	AggregateMessage MessageType = 'A'
+	// HiddenMessage is a message not meant to be displayed.
+	HiddenMessage MessageType = '.'
+	// CompressedMessage is a chunk of the compressed stream of framed messages
+	// (if the client asked for compression).
+	CompressedMessage MessageType = 'Z'
+)
+
+// CompressionZstd is the only compression supported by the server so far.
+const CompressionZstd string = "zstd"
+
+const (
+	// FrameMagic starts every frame. It never starts a delimited message, so
+	// that a client can tell the protocol of the server from the first byte.
+	FrameMagic byte = 0x00
+	// FrameHeaderSize is the size of the frame header: FrameMagic, the message
+	// type and the length of the message (uint32, big endian).
+	FrameHeaderSize int = 6
+	// MaxFrameSize is the maximum length of a framed message.
+	MaxFrameSize int = 64 * 1024 * 1024
+)
+
+// WriteFrame writes the message with a frame header to the buffer.
+func WriteFrame(buf *bytes.Buffer, messageType MessageType, message []byte) {
+	var header [FrameHeaderSize]byte
+	header[0] = FrameMagic
+	header[1] = byte(messageType)
+	binary.BigEndian.PutUint32(header[2:], uint32(len(message)))
+	buf.Write(header[:])
+	buf.Write(message)
+}
+
+// FrameDecoder splits the received data into the framed messages.
+type FrameDecoder struct {
+	buf bytes.Buffer
+}
+
+// Decode the data received and call handle for every complete message. Data
+// of incomplete messages is kept until the rest is received.
+func (d *FrameDecoder) Decode(p []byte, handle func(MessageType, []byte)) error {
+	d.buf.Write(p)
+	for d.buf.Len() >= FrameHeaderSize {
+		header := d.buf.Bytes()[:FrameHeaderSize]
+		if header[0] != FrameMagic {
+			return fmt.Errorf("invalid frame header %v", header)
+		}
+		length := int(binary.BigEndian.Uint32(header[2:]))
+		if length > MaxFrameSize {
+			return fmt.Errorf("frame of %d bytes exceeds the maximum of %d bytes",
+				length, MaxFrameSize)
+		}
+		if d.buf.Len() < FrameHeaderSize+length {
+			return nil
+		}
+		messageType := MessageType(header[1])
+		d.buf.Next(FrameHeaderSize)
+		handle(messageType, d.buf.Next(length))
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+package protocol
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFrames(t *testing.T) {
+	type message struct {
+		messageType MessageType
+		text        string
+	}
+	messages := []message{
+		{RemoteMessage, "REMOTE|host|100|1|foo.log|Price: 5 €¬ (0xac)\n"},
+		{ServerMessage, "SERVER|host|Some message\n"},
+		{AggregateMessage, ""},
+		{HiddenMessage, ".syn close connection"},
+	}
+
+	var buf bytes.Buffer
+	for _, m := range messages {
+		WriteFrame(&buf, m.messageType, []byte(m.text))
+	}
+	data := buf.Bytes()
+	if data[0] != FrameMagic {
+		t.Errorf("Expected the frame magic as the first byte but got %v", data[0])
+	}
+
+	// Decode the data in small chunks, as messages may be split when received.
+	var decoded []message
+	var d FrameDecoder
+	for i := 0; i < len(data); i += 5 {
+		end := i + 5
+		if end > len(data) {
+			end = len(data)
+		}
+		err := d.Decode(data[i:end], func(messageType MessageType, text []byte) {
+			decoded = append(decoded, message{messageType, string(text)})
+		})
+		if err != nil {
+			t.Errorf("Unable to decode frames: %v", err)
+			return
+		}
+	}
+
+	if len(decoded) != len(messages) {
+		t.Errorf("Expected messages %q but got %q", messages, decoded)
+		return
+	}
+	for i := range messages {
+		if decoded[i] != messages[i] {
+			t.Errorf("Expected message %q but got %q", messages[i], decoded[i])
+		}
+	}
+
+	if err := d.Decode([]byte("REMOTE|host|..."), func(MessageType, []byte) {}); err == nil {
+		t.Errorf("Expected error decoding data without frame header")
+	}
+}
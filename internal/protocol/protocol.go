@@ -2,7 +2,11 @@ package protocol
 
 const (
 	// ProtocolCompat -ibility version
-	ProtocolCompat string = "4.1"
+	ProtocolCompat string = "5.0"
+	// ProtocolCompatDelimited is the previous protocol version, which delimits
+	// the messages with MessageDelimiter instead of framing them. It's still
+	// supported to talk to older servers and clients.
+	ProtocolCompatDelimited string = "4.1"
 	// MessageDelimiter delimits separate messages.
 	MessageDelimiter byte = '¬'
 	// FieldDelimiter delimits messagefields.
@@ -15,4 +19,7 @@ const (
 	AggregateDelimiter string = "∥"
 	// AggregateGroupKeyCombinator combines the group set keys.
 	AggregateGroupKeyCombinator string = ","
+	// CommandIDDelimiter delimits the message type and the ID of the command
+	// the message belongs to, e.g. REMOTE:ID|hostname|...
+	CommandIDDelimiter string = ":"
 )
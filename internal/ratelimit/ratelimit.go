@@ -0,0 +1,151 @@
+// Package ratelimit throttles the users reading log files on the server, so
+// that a single user can't saturate the disks, the network or the CPUs of a
+// production host.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/mimecast/dtail/internal/config"
+)
+
+var (
+	limiters      = make(map[string]*Limiter)
+	limitersMutex sync.Mutex
+)
+
+// Limiter limits the lines and bytes read per second and the time spent busy
+// reading them. All files read by a user share the same limiter.
+type Limiter struct {
+	limit config.RateLimit
+	// The clock, to be replaced in tests.
+	now   func() time.Time
+	mutex sync.Mutex
+	lines bucket
+	bytes bucket
+	// In seconds of busy (wall-clock) time.
+	busy bucket
+}
+
+// ForUser returns the limiter of the user, shared by all sessions of the user.
+// Returns nil if the user is unlimited.
+func ForUser(userName string, limit config.RateLimit) *Limiter {
+	if limit == (config.RateLimit{}) {
+		return nil
+	}
+
+	limitersMutex.Lock()
+	defer limitersMutex.Unlock()
+
+	l, ok := limiters[userName]
+	if !ok || l.limit != limit {
+		l = New(limit)
+		limiters[userName] = l
+	}
+	return l
+}
+
+// New returns a new limiter.
+func New(limit config.RateLimit) *Limiter {
+	return newLimiter(limit, time.Now)
+}
+
+func newLimiter(limit config.RateLimit, clock func() time.Time) *Limiter {
+	now := clock()
+	return &Limiter{
+		limit: limit,
+		now:   clock,
+		lines: newBucket(now, float64(limit.LinesPerSecond)),
+		bytes: newBucket(now, float64(limit.BytesPerSecond)),
+		busy:  newBucket(now, float64(limit.BusyPercent)/100),
+	}
+}
+
+// String representation of the limiter.
+func (l *Limiter) String() string {
+	return fmt.Sprintf("Limiter(linesPerSecond:%d,bytesPerSecond:%d,busyPercent:%d)",
+		l.limit.LinesPerSecond, l.limit.BytesPerSecond, l.limit.BusyPercent)
+}
+
+// Busy adds the time spent reading or filtering lines. It's wall-clock time,
+// as the CPU time of a goroutine can't be measured, so it includes waiting for
+// the disk. The time of all files read by the user adds up.
+func (l *Limiter) Busy(d time.Duration) {
+	if l == nil {
+		return
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.busy.take(l.now(), d.Seconds())
+}
+
+// Wait takes a line of size bytes read and blocks until the user is within its
+// limits again. Returns how long it waited.
+func (l *Limiter) Wait(ctx context.Context, size int) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+
+	l.mutex.Lock()
+	now := l.now()
+	wait := l.lines.take(now, 1)
+	if d := l.bytes.take(now, float64(size)); d > wait {
+		wait = d
+	}
+	if d := l.busy.take(now, 0); d > wait {
+		wait = d
+	}
+	l.mutex.Unlock()
+
+	if wait <= 0 {
+		return 0, nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return wait, nil
+	case <-ctx.Done():
+		return wait, ctx.Err()
+	}
+}
+
+// A token bucket, refilled with rate tokens per second up to the amount of one
+// second. The tokens may become negative, so that e.g. a line larger than the
+// bytes per second is delayed but not rejected.
+type bucket struct {
+	// Zero if unlimited.
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(now time.Time, rate float64) bucket {
+	return bucket{rate: rate, tokens: rate, last: now}
+}
+
+// Takes n tokens, returns how long to wait until the bucket isn't in debt.
+func (b *bucket) take(now time.Time, n float64) time.Duration {
+	if b.rate <= 0 {
+		return 0
+	}
+
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens += elapsed * b.rate
+		if b.tokens > b.rate {
+			b.tokens = b.rate
+		}
+		b.last = now
+	}
+	b.tokens -= n
+
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
@@ -0,0 +1,98 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/mimecast/dtail/internal/config"
+)
+
+func TestBucket(t *testing.T) {
+	now := time.Now()
+	b := newBucket(now, 10)
+
+	// The bucket starts full with the tokens of one second.
+	for i := 0; i < 10; i++ {
+		if wait := b.take(now, 1); wait != 0 {
+			t.Errorf("expected not to wait for token %d but got %v\n", i, wait)
+		}
+	}
+	if wait := b.take(now, 1); wait != 100*time.Millisecond {
+		t.Errorf("expected to wait 100ms for the 11th token but got %v\n", wait)
+	}
+
+	// Pays back the debt of one token, then refills one more.
+	now = now.Add(200 * time.Millisecond)
+	if wait := b.take(now, 1); wait != 0 {
+		t.Errorf("expected not to wait after refill but got %v\n", wait)
+	}
+	if wait := b.take(now, 1); wait != 100*time.Millisecond {
+		t.Errorf("expected to wait 100ms again but got %v\n", wait)
+	}
+
+	// Never refills more than one second of tokens.
+	now = now.Add(time.Hour)
+	if wait := b.take(now, 11); wait != 100*time.Millisecond {
+		t.Errorf("expected to wait 100ms for 11 tokens but got %v\n", wait)
+	}
+
+	unlimited := newBucket(now, 0)
+	if wait := unlimited.take(now, 1000); wait != 0 {
+		t.Errorf("expected not to wait without limit but got %v\n", wait)
+	}
+}
+
+func TestLimiter(t *testing.T) {
+	if l := ForUser("paul", config.RateLimit{}); l != nil {
+		t.Errorf("expected no limiter without rate limit but got %v\n", l)
+	}
+
+	limit := config.RateLimit{LinesPerSecond: 1000}
+	l := ForUser("paul", limit)
+	if l2 := ForUser("paul", limit); l != l2 {
+		t.Errorf("expected the same limiter for the same user\n")
+	}
+	if l2 := ForUser("james", limit); l == l2 {
+		t.Errorf("expected another limiter for another user\n")
+	}
+
+	// A fixed clock, so that the buckets don't refill while testing.
+	now := time.Now()
+	clock := func() time.Time { return now }
+
+	l = newLimiter(config.RateLimit{LinesPerSecond: 10, BytesPerSecond: 1000}, clock)
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		if wait, err := l.Wait(ctx, 10); wait != 0 || err != nil {
+			t.Errorf("expected not to wait for line %d but got %v %v\n", i, wait, err)
+		}
+	}
+
+	// Cancelling the context stops waiting.
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	if wait, err := l.Wait(ctx, 10); wait != 100*time.Millisecond || err == nil {
+		t.Errorf("expected to wait 100ms and to be cancelled but got %v %v\n", wait, err)
+	}
+
+	// Limited by the bytes per second (900 bytes in debt), once the lines are
+	// paid back.
+	now = now.Add(time.Second)
+	if wait, err := l.Wait(ctx, 1900); wait != 900*time.Millisecond || err == nil {
+		t.Errorf("expected to wait 900ms for the bytes but got %v %v\n", wait, err)
+	}
+
+	// The busy time is paid back by waiting.
+	l = newLimiter(config.RateLimit{BusyPercent: 50}, clock)
+	l.Busy(time.Second)
+	if wait, _ := l.Wait(ctx, 100); wait != time.Second {
+		t.Errorf("expected to wait a second after being busy but got %v\n", wait)
+	}
+
+	var nilLimiter *Limiter
+	nilLimiter.Busy(time.Second)
+	if wait, err := nilLimiter.Wait(ctx, 100); wait != 0 || err != nil {
+		t.Errorf("expected nil limiter not to wait but got %v %v\n", wait, err)
+	}
+}
@@ -57,3 +57,23 @@ func TestRegex(t *testing.T) {
 			"'%s' but expected '%s'.\n", r2.String(), r.String())
 	}
 }
+
+func TestUpdatable(t *testing.T) {
+	r, err := New("hello", Default)
+	if err != nil {
+		t.Errorf("unable to create regex: %v\n", err)
+	}
+	u := NewUpdatable(r)
+	if !u.Match([]byte("hello world")) || u.Match([]byte("bye world")) {
+		t.Errorf("expected updatable regex to match like '%v'\n", r)
+	}
+
+	r, err = New("hello", Invert)
+	if err != nil {
+		t.Errorf("unable to create regex: %v\n", err)
+	}
+	u.Store(r)
+	if u.Match([]byte("hello world")) || !u.Match([]byte("bye world")) {
+		t.Errorf("expected updated regex to match like '%v'\n", r)
+	}
+}
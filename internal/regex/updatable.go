@@ -0,0 +1,33 @@
+package regex
+
+import (
+	"sync/atomic"
+)
+
+// Updatable is a regex which can be replaced while it's in use, e.g. to change
+// the filter of a running tail without reconnecting.
+type Updatable struct {
+	value atomic.Value
+}
+
+// NewUpdatable returns a new updatable regex.
+func NewUpdatable(r Regex) *Updatable {
+	u := Updatable{}
+	u.value.Store(r)
+	return &u
+}
+
+// Load returns the current regex.
+func (u *Updatable) Load() Regex {
+	return u.value.Load().(Regex)
+}
+
+// Store replaces the current regex.
+func (u *Updatable) Store(r Regex) {
+	u.value.Store(r)
+}
+
+// Match a byte string with the current regex.
+func (u *Updatable) Match(bytes []byte) bool {
+	return u.Load().Match(bytes)
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/mimecast/dtail/internal/clients"
 	"github.com/mimecast/dtail/internal/config"
 	"github.com/mimecast/dtail/internal/io/dlog"
+	"github.com/mimecast/dtail/internal/metrics"
 	"github.com/mimecast/dtail/internal/omode"
 	gossh "golang.org/x/crypto/ssh"
 )
@@ -66,12 +67,27 @@ func (c *continuous) runJob(ctx context.Context, job config.Continuous) {
 	}
 
 	args.SSHAuthMethods = append(args.SSHAuthMethods, gossh.Password(job.Name))
-	args.QueryStr = fmt.Sprintf("%s outfile %s", job.Query, outfile)
+	args.QueryStr = job.Query
+	if outfile != "" || !job.Metrics {
+		args.QueryStr = fmt.Sprintf("%s outfile %s", job.Query, outfile)
+	}
 	client, err := clients.NewMaprClient(args, clients.NonCumulativeMode)
 	if err != nil {
 		dlog.Server.Error(fmt.Sprintf("Unable to create job %s", job.Name), err)
 		return
 	}
+	if job.Metrics {
+		if config.Server.MetricsBindAddress == "" {
+			dlog.Server.Warn(job.Name, "Publishing job results as metrics, "+
+				"but MetricsBindAddress isn't configured")
+		}
+		if err := client.PublishMetrics(job.Name); err != nil {
+			dlog.Server.Error(fmt.Sprintf("Unable to publish metrics of job %s", job.Name), err)
+			return
+		}
+		// Don't serve the results of a previous run of the job.
+		defer metrics.JobResults.Delete(job.Name)
+	}
 
 	jobCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
@@ -85,7 +101,11 @@ func (c *continuous) runJob(ctx context.Context, job config.Continuous) {
 	}
 
 	dlog.Server.Info(fmt.Sprintf("Starting job %s", job.Name))
+	metrics.JobRunning.Set(1, "continuous", job.Name)
+	metrics.JobRuns.Add(1, "continuous", job.Name)
 	status := client.Start(jobCtx, make(chan string))
+	metrics.JobRunning.Set(0, "continuous", job.Name)
+	metrics.JobLastExitStatus.Set(float64(status), "continuous", job.Name)
 	logMessage := fmt.Sprintf("Job exited with status %d", status)
 	if status != 0 {
 		dlog.Server.Warn(logMessage)
@@ -19,18 +19,35 @@ import (
 	"github.com/mimecast/dtail/internal/io/line"
 	"github.com/mimecast/dtail/internal/io/pool"
 	"github.com/mimecast/dtail/internal/lcontext"
-	"github.com/mimecast/dtail/internal/mapr/server"
 	"github.com/mimecast/dtail/internal/protocol"
 	user "github.com/mimecast/dtail/internal/user/server"
+
+	"github.com/DataDog/zstd"
 )
 
-type handleCommandCb func(context.Context, lcontext.LContext, int, []string, string)
+// The maximum amount of (uncompressed) bytes compressed into one frame.
+const maxCompressBatch int = 256 * 1024
+
+type handleCommandCb func(ctx context.Context, ltx lcontext.LContext, argc int,
+	args []string, commandName string, options commandOptions)
+
+// The options of a single command. The other options are set once for the
+// whole session.
+type commandOptions struct {
+	// The ID of the command (empty if none).
+	id string
+	// Only read the log lines of this time range (zero if unbounded).
+	since time.Time
+	until time.Time
+}
+
+// The options of the session, which can't be changed by later commands.
+var sessionOptions = [...]string{"quiet", "plain", "serverless", "compress"}
 
 type baseHandler struct {
 	done             *internal.Done
 	handleCommandCb  handleCommandCb
 	lines            chan *line.Line
-	aggregate        *server.Aggregate
 	maprMessages     chan string
 	serverMessages   chan string
 	hostname         string
@@ -39,6 +56,15 @@ type baseHandler struct {
 	activeCommands   int32
 	readBuf          bytes.Buffer
 	writeBuf         bytes.Buffer
+	messageBuf       bytes.Buffer
+	// Messages of commands with an ID, already tagged with it and encoded.
+	taggedMessages chan string
+	// Are the messages framed (or delimited)?
+	framed atomic.Bool
+	// Are the messages compressed? Only used by Read.
+	compress    atomic.Bool
+	compressor  *zstd.Writer
+	compressBuf bytes.Buffer
 
 	// Some global options + sync primitives required.
 	once       sync.Once
@@ -46,6 +72,8 @@ type baseHandler struct {
 	quiet      bool
 	plain      bool
 	serverless bool
+	// The session options of the first command with options.
+	sessionOptions string
 }
 
 // Shutdown the handler.
@@ -60,69 +88,172 @@ func (h *baseHandler) Done() <-chan struct{} {
 
 // Read is to send data to the dtail client via Reader interface.
 func (h *baseHandler) Read(p []byte) (n int, err error) {
-	defer h.readBuf.Reset()
+	// Send what didn't fit into p last time first.
+	if h.readBuf.Len() > 0 {
+		return h.readBuf.Read(p)
+	}
+
+	if !h.readMessage(&h.readBuf, time.After(time.Second)) {
+		select {
+		case <-h.done.Done():
+			if h.closeCompressor(); h.readBuf.Len() > 0 {
+				return h.readBuf.Read(p)
+			}
+			err = io.EOF
+			return
+		default:
+		}
+	}
+	if h.readBuf.Len() == 0 {
+		return
+	}
+
+	if h.compress.Load() {
+		if err = h.compressMessages(); err != nil {
+			return
+		}
+	}
+	return h.readBuf.Read(p)
+}
+
+// Encodes the next message to be sent to the client into the buffer. Returns
+// false if there was no message until timeout.
+func (h *baseHandler) readMessage(buf *bytes.Buffer, timeout <-chan time.Time) bool {
+	h.messageBuf.Reset()
 
 	select {
 	case message := <-h.serverMessages:
 		if len(message) > 0 && message[0] == '.' {
 			// Handle hidden message (don't display to the user)
-			h.readBuf.WriteString(message)
-			h.readBuf.WriteByte(protocol.MessageDelimiter)
-			n = copy(p, h.readBuf.Bytes())
-			return
+			h.encode(buf, protocol.HiddenMessage, []byte(message))
+			break
 		}
 
 		if h.serverless {
-			return
+			break
 		}
 
 		// Handle normal server message (display to the user)
-		h.readBuf.WriteString("SERVER")
-		h.readBuf.WriteString(protocol.FieldDelimiter)
-		h.readBuf.WriteString(h.hostname)
-		h.readBuf.WriteString(protocol.FieldDelimiter)
-		h.readBuf.WriteString(message)
-		h.readBuf.WriteByte(protocol.MessageDelimiter)
-		n = copy(p, h.readBuf.Bytes())
+		h.writeServerMessage(&h.messageBuf, "", message)
+		h.encode(buf, protocol.ServerMessage, h.messageBuf.Bytes())
 
 	case message := <-h.maprMessages:
 		// Send mapreduce-aggregated data as a message.
-		h.readBuf.WriteString("AGGREGATE")
-		h.readBuf.WriteString(protocol.FieldDelimiter)
-		h.readBuf.WriteString(h.hostname)
-		h.readBuf.WriteString(protocol.FieldDelimiter)
-		h.readBuf.WriteString(message)
-		h.readBuf.WriteByte(protocol.MessageDelimiter)
-		n = copy(p, h.readBuf.Bytes())
+		h.writeAggregateMessage(&h.messageBuf, "", message)
+		h.encode(buf, protocol.AggregateMessage, h.messageBuf.Bytes())
 
 	case line := <-h.lines:
-		if !h.plain {
-			h.readBuf.WriteString("REMOTE")
-			h.readBuf.WriteString(protocol.FieldDelimiter)
-			h.readBuf.WriteString(h.hostname)
-			h.readBuf.WriteString(protocol.FieldDelimiter)
-			h.readBuf.WriteString(fmt.Sprintf("%3d", line.TransmittedPerc))
-			h.readBuf.WriteString(protocol.FieldDelimiter)
-			h.readBuf.WriteString(fmt.Sprintf("%v", line.Count))
-			h.readBuf.WriteString(protocol.FieldDelimiter)
-			h.readBuf.WriteString(line.SourceID)
-			h.readBuf.WriteString(protocol.FieldDelimiter)
-		}
-		h.readBuf.WriteString(line.Content.String())
-		h.readBuf.WriteByte(protocol.MessageDelimiter)
-		n = copy(p, h.readBuf.Bytes())
-		pool.RecycleBytesBuffer(line.Content)
-		line.Recycle()
+		h.writeLine(&h.messageBuf, "", line)
+		h.encode(buf, protocol.RemoteMessage, h.messageBuf.Bytes())
 
-	case <-time.After(time.Second):
-		select {
-		case <-h.done.Done():
-			err = io.EOF
-			return
-		default:
-		}
+	case message := <-h.taggedMessages:
+		// Already tagged with the command ID and encoded.
+		buf.WriteString(message)
+
+	case <-timeout:
+		return false
 	}
-	return
+	return true
+}
+
+// Compresses the messages in the read buffer, together with all other messages
+// already waiting to be sent (up to maxCompressBatch bytes), into one frame.
+// The compressed stream spans the whole session, so that also short messages
+// compress well.
+func (h *baseHandler) compressMessages() error {
+	if h.compressor == nil {
+		h.compressor = zstd.NewWriter(&h.compressBuf)
+	}
+	for h.numUnsentMessages() > 0 && h.readBuf.Len() < maxCompressBatch {
+		// Doesn't block, as Read is the only receiver of the channels.
+		h.readMessage(&h.readBuf, nil)
+	}
+
+	h.compressBuf.Reset()
+	if _, err := h.compressor.Write(h.readBuf.Bytes()); err != nil {
+		return err
+	}
+	// The client must be able to decompress all messages sent so far.
+	if err := h.compressor.Flush(); err != nil {
+		return err
+	}
+	h.readBuf.Reset()
+	protocol.WriteFrame(&h.readBuf, protocol.CompressedMessage, h.compressBuf.Bytes())
+	return nil
+}
+
+// Ends the compressed stream. The end of the stream is encoded into the read
+// buffer as the last compressed frame, so that the client can verify that the
+// stream is complete.
+func (h *baseHandler) closeCompressor() {
+	if h.compressor == nil {
+		return
+	}
+	h.compressBuf.Reset()
+	if err := h.compressor.Close(); err != nil {
+		dlog.Server.Warn(h.user, "Unable to close compressor", err)
+	}
+	if h.compressBuf.Len() > 0 {
+		protocol.WriteFrame(&h.readBuf, protocol.CompressedMessage, h.compressBuf.Bytes())
+	}
+	h.compressor = nil
+}
+
+// Encodes the message for the client: Framed if the client negotiated the
+// current protocol version, and delimited otherwise.
+func (h *baseHandler) encode(buf *bytes.Buffer, messageType protocol.MessageType,
+	message []byte) {
+
+	if h.framed.Load() {
+		protocol.WriteFrame(buf, messageType, message)
+		return
+	}
+	buf.Write(message)
+	buf.WriteByte(protocol.MessageDelimiter)
+}
+
+// The message type, tagged with the ID of the command the message belongs to
+// (if any).
+func messageType(name, commandID string) string {
+	if commandID == "" {
+		return name
+	}
+	return name + protocol.CommandIDDelimiter + commandID
+}
+
+func (h *baseHandler) writeServerMessage(buf *bytes.Buffer, commandID, message string) {
+	buf.WriteString(messageType("SERVER", commandID))
+	buf.WriteString(protocol.FieldDelimiter)
+	buf.WriteString(h.hostname)
+	buf.WriteString(protocol.FieldDelimiter)
+	buf.WriteString(message)
+}
+
+func (h *baseHandler) writeAggregateMessage(buf *bytes.Buffer, commandID, message string) {
+	buf.WriteString(messageType("AGGREGATE", commandID))
+	buf.WriteString(protocol.FieldDelimiter)
+	buf.WriteString(h.hostname)
+	buf.WriteString(protocol.FieldDelimiter)
+	buf.WriteString(message)
+}
+
+// Writes the line (without the message delimiter) and recycles it.
+func (h *baseHandler) writeLine(buf *bytes.Buffer, commandID string, line *line.Line) {
+	if !h.plain {
+		buf.WriteString(messageType("REMOTE", commandID))
+		buf.WriteString(protocol.FieldDelimiter)
+		buf.WriteString(h.hostname)
+		buf.WriteString(protocol.FieldDelimiter)
+		buf.WriteString(fmt.Sprintf("%3d", line.TransmittedPerc))
+		buf.WriteString(protocol.FieldDelimiter)
+		buf.WriteString(fmt.Sprintf("%v", line.Count))
+		buf.WriteString(protocol.FieldDelimiter)
+		buf.WriteString(line.SourceID)
+		buf.WriteString(protocol.FieldDelimiter)
+	}
+	buf.WriteString(line.Content.String())
+	pool.RecycleBytesBuffer(line.Content)
+	line.Recycle()
 }
 
 // Write is to receive data from the dtail client via Writer interface.
@@ -164,7 +295,8 @@ func (h *baseHandler) handleCommand(commandStr string) {
 
 	// Either no options or empty options provided.
 	if len(parts) == 1 || len(parts[1]) == 0 {
-		h.handleCommandCb(ctx, lcontext.LContext{}, argc, args, commandName)
+		h.handleCommandCb(ctx, lcontext.LContext{}, argc, args, commandName,
+			commandOptions{})
 		return
 	}
 
@@ -173,8 +305,44 @@ func (h *baseHandler) handleCommand(commandStr string) {
 		h.sendln(h.serverMessages, dlog.Server.Error(h.user, err))
 		return
 	}
-	h.handleOptions(options)
-	h.handleCommandCb(ctx, ltx, argc, args, commandName)
+	commandOptions := makeCommandOptions(options)
+	if !validCommandID(commandOptions.id) {
+		h.sendln(h.serverMessages, dlog.Server.Error(h.user,
+			"Invalid command ID", commandOptions.id))
+		return
+	}
+	if err := h.handleOptions(options); err != nil {
+		h.sendln(h.serverMessages, dlog.Server.Error(h.user, err))
+		return
+	}
+	h.handleCommandCb(ctx, ltx, argc, args, commandName, commandOptions)
+}
+
+// Unlike the session options, these options are per command, e.g. so that the
+// commands of a multiplexed session can read different time ranges.
+func makeCommandOptions(options map[string]string) commandOptions {
+	o := commandOptions{id: options["id"]}
+	if since, err := strconv.ParseInt(options["since"], 10, 64); err == nil {
+		o.since = time.Unix(since, 0)
+	}
+	if until, err := strconv.ParseInt(options["until"], 10, 64); err == nil {
+		o.until = time.Unix(until, 0)
+	}
+	return o
+}
+
+// Command IDs are tagged to the message types, so they must not contain any
+// protocol delimiters.
+func validCommandID(commandID string) bool {
+	for _, r := range commandID {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9',
+			r == '-', r == '_', r == '.':
+		default:
+			return false
+		}
+	}
+	return true
 }
 
 func (h *baseHandler) handleProtocolVersion(args []string) ([]string, int, string, error) {
@@ -185,9 +353,16 @@ func (h *baseHandler) handleProtocolVersion(args []string) ([]string, int, strin
 		return args, argc, add, errors.New("unable to determine protocol version")
 	}
 
-	if args[1] != protocol.ProtocolCompat {
-		clientCompat, _ := strconv.Atoi(args[1])
-		serverCompat, _ := strconv.Atoi(protocol.ProtocolCompat)
+	switch args[1] {
+	case protocol.ProtocolCompat:
+		// Tell the client that the messages are framed from now on.
+		if !h.framed.Swap(true) {
+			h.send(h.serverMessages, ".protocol "+protocol.ProtocolCompat)
+		}
+	case protocol.ProtocolCompatDelimited:
+	default:
+		clientCompat, _ := strconv.ParseFloat(args[1], 64)
+		serverCompat, _ := strconv.ParseFloat(protocol.ProtocolCompat, 64)
 		if clientCompat <= 3 {
 			// Protocol version 3 or lower expect a newline as message separator
 			// One day (after 2 major versions) this exception may be removed!
@@ -245,13 +420,24 @@ func (h *baseHandler) handleAckCommand(argc int, args []string) {
 	}
 }
 
-func (h *baseHandler) handleOptions(options map[string]string) {
-	// We have to make sure that this block is executed only once.
+// Sets the session options of the first command. Later commands (e.g. of a
+// multiplexed session) must have the same session options.
+func (h *baseHandler) handleOptions(options map[string]string) error {
 	h.mutex.Lock()
 	defer h.mutex.Unlock()
-	// We can read the options only once, will cause a data race otherwise if
+
+	var sb strings.Builder
+	for _, name := range sessionOptions {
+		sb.WriteString(name + "=" + options[name] + ";")
+	}
+	serialized := sb.String()
+
+	// We can set the options only once, will cause a data race otherwise if
 	// changed multiple times for multiple incoming commands.
+	var set bool
 	h.once.Do(func() {
+		set = true
+		h.sessionOptions = serialized
 		if quiet := options["quiet"]; quiet == "true" {
 			dlog.Server.Debug(h.user, "Enabling quiet mode")
 			h.quiet = true
@@ -264,7 +450,18 @@ func (h *baseHandler) handleOptions(options map[string]string) {
 			dlog.Server.Debug(h.user, "Enabling serverless mode")
 			h.serverless = true
 		}
+		// Compression requires framed messages, and makes no sense serverless.
+		if options["compress"] == protocol.CompressionZstd && h.framed.Load() &&
+			!h.serverless {
+			dlog.Server.Debug(h.user, "Enabling compression", options["compress"])
+			h.compress.Store(true)
+		}
 	})
+	if !set && serialized != h.sessionOptions {
+		return fmt.Errorf("Session options can't be changed by later commands, "+
+			"got '%s' but the session has '%s'", serialized, h.sessionOptions)
+	}
+	return nil
 }
 
 func (h *baseHandler) send(ch chan<- string, message string) {
@@ -278,20 +475,22 @@ func (h *baseHandler) sendln(ch chan<- string, message string) {
 	h.send(ch, message+"\n")
 }
 
+func (h *baseHandler) numUnsentMessages() int {
+	return len(h.lines) + len(h.serverMessages) + len(h.maprMessages) +
+		len(h.taggedMessages)
+}
+
 func (h *baseHandler) flush() {
 	dlog.Server.Trace(h.user, "flush()")
-	numUnsentMessages := func() int {
-		return len(h.lines) + len(h.serverMessages) + len(h.maprMessages)
-	}
 	for i := 0; i < 10; i++ {
-		if numUnsentMessages() == 0 {
+		if h.numUnsentMessages() == 0 {
 			dlog.Server.Debug(h.user, "ALL lines sent", fmt.Sprintf("%p", h))
 			return
 		}
 		dlog.Server.Debug(h.user, "Still lines to be sent")
 		time.Sleep(time.Millisecond * 10)
 	}
-	dlog.Server.Warn(h.user, "Some lines remain unsent", numUnsentMessages())
+	dlog.Server.Warn(h.user, "Some lines remain unsent", h.numUnsentMessages())
 }
 
 func (h *baseHandler) shutdown() {
@@ -0,0 +1,127 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/mimecast/dtail/internal/io/line"
+	"github.com/mimecast/dtail/internal/protocol"
+
+	"github.com/DataDog/zstd"
+)
+
+func TestCompression(t *testing.T) {
+	h := newTestHandler(t)
+	p := make([]byte, 2*maxCompressBatch)
+	var received bytes.Buffer
+	read := func() {
+		t.Helper()
+		n, err := h.Read(p)
+		if err != nil {
+			t.Fatalf("Unable to read messages: %v", err)
+		}
+		received.Write(p[:n])
+	}
+
+	// Plain frames until the client asks for compression.
+	h.sendln(h.serverMessages, "Plain")
+	read()
+	h.handleOptions(map[string]string{"compress": protocol.CompressionZstd})
+
+	// All lines have the same size.
+	content := func(i int) string {
+		return fmt.Sprintf("%04d%s\n", i, strings.Repeat("x", 4091))
+	}
+	numLines := cap(h.lines)
+	for i := 0; i < numLines; i++ {
+		h.lines <- line.New(bytes.NewBufferString(content(i)), 1, 100, "a.log")
+	}
+
+	// The first frame compresses the lines up to maxCompressBatch bytes, the
+	// second one the remaining lines.
+	frameSize := len("REMOTE|host|100|1|a.log|") + len(content(0)) + 6
+	read()
+	if remaining := numLines - (maxCompressBatch+frameSize-1)/frameSize; len(h.lines) != remaining {
+		t.Errorf("Expected %d lines left after the first compressed frame but got %d",
+			remaining, len(h.lines))
+	}
+	read()
+	if len(h.lines) != 0 {
+		t.Errorf("Expected all lines to be compressed but got %d left", len(h.lines))
+	}
+
+	var plain, compressed []string
+	var zstream bytes.Buffer
+	var decoder protocol.FrameDecoder
+	err := decoder.Decode(received.Bytes(), func(messageType protocol.MessageType, message []byte) {
+		switch messageType {
+		case protocol.CompressedMessage:
+			zstream.Write(message)
+		default:
+			plain = append(plain, string(message))
+		}
+	})
+	if err != nil {
+		t.Fatalf("Unable to decode frames: %v", err)
+	}
+	if len(plain) != 1 || plain[0] != "SERVER|host|Plain\n" {
+		t.Errorf("Expected only the first message uncompressed but got %q", plain)
+	}
+
+	// The compressor is closed once the handler is done. The end of the
+	// stream is sent as the last compressed frame.
+	h.Shutdown()
+	n, err := h.Read(p)
+	if err != nil {
+		t.Fatalf("Expected the end of the compressed stream but got %v", err)
+	}
+	err = decoder.Decode(p[:n], func(messageType protocol.MessageType, message []byte) {
+		if messageType != protocol.CompressedMessage {
+			t.Errorf("Expected a compressed frame but got %q", message)
+		}
+		zstream.Write(message)
+	})
+	if err != nil {
+		t.Fatalf("Unable to decode frames: %v", err)
+	}
+	if _, err := h.Read(p); err != io.EOF {
+		t.Errorf("Expected EOF after shutdown but got %v", err)
+	}
+	if h.compressor != nil {
+		t.Errorf("Expected the compressor to be closed after shutdown")
+	}
+
+	// The compressed frames are chunks of one stream, which is flushed after
+	// every frame and ended with the last one.
+	zr := zstd.NewReader(&zstream)
+	defer zr.Close()
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := zr.Read(buf)
+		decodeErr := decoder.Decode(buf[:n], func(_ protocol.MessageType, message []byte) {
+			compressed = append(compressed, string(message))
+		})
+		if decodeErr != nil {
+			t.Fatalf("Unable to decode decompressed frames: %v", decodeErr)
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("Unable to decompress frames: %v", err)
+		}
+	}
+	if len(compressed) != numLines {
+		t.Fatalf("Expected %d compressed messages but got %d", numLines, len(compressed))
+	}
+	for i, message := range compressed {
+		expected := "REMOTE|host|100|1|a.log|" + content(i)
+		if message != expected {
+			t.Errorf("Expected compressed message %d %q but got %q", i, expected, message)
+			break
+		}
+	}
+}
@@ -42,7 +42,8 @@ func NewHealthHandler(user *user.User) *HealthHandler {
 }
 
 func (h *HealthHandler) handleHealthCommand(ctx context.Context,
-	ltx lcontext.LContext, argc int, args []string, commandName string) {
+	ltx lcontext.LContext, argc int, args []string, commandName string,
+	options commandOptions) {
 
 	dlog.Server.Debug(h.user, "Handling health command", argc, args)
 	switch commandName {
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+
+	"github.com/mimecast/dtail/internal/io/dlog"
+	"github.com/mimecast/dtail/internal/io/line"
+	"github.com/mimecast/dtail/internal/mapr/server"
+	"github.com/mimecast/dtail/internal/protocol"
+)
+
+// A job groups the commands a client sent with the same ID, e.g. a mapreduce
+// query and the commands reading its files. The messages of a job are tagged
+// with its ID, so that a client can run several jobs concurrently over one
+// session and cancel each of them individually. Commands without an ID belong
+// to the default job, which sends its messages untagged.
+type job struct {
+	id     string
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Amount of commands of the job still running.
+	activeCommands int
+	// The output of the commands of the job.
+	lines          chan *line.Line
+	serverMessages chan string
+	maprMessages   chan string
+	aggregate      *server.Aggregate
+	// Closed once all commands of the job finished.
+	finished chan struct{}
+}
+
+func newJob(ctx context.Context, id string) *job {
+	ctx, cancel := context.WithCancel(ctx)
+	return &job{
+		id:             id,
+		ctx:            ctx,
+		cancel:         cancel,
+		lines:          make(chan *line.Line, 100),
+		serverMessages: make(chan string, 10),
+		maprMessages:   make(chan string, 10),
+		finished:       make(chan struct{}),
+	}
+}
+
+// Returns the job of the command (and the context to run the command with),
+// the job is started if it's the first command with the ID.
+func (h *ServerHandler) startJobCommand(ctx context.Context,
+	commandID string) (context.Context, *job) {
+
+	if commandID == "" {
+		return ctx, h.defaultJob
+	}
+
+	h.jobsMutex.Lock()
+	defer h.jobsMutex.Unlock()
+	h.multiplexed = true
+
+	j, ok := h.jobs[commandID]
+	if !ok {
+		dlog.Server.Debug(h.user, "Starting job", commandID)
+		j = newJob(ctx, commandID)
+		h.jobs[commandID] = j
+		go h.forwardJob(j)
+	}
+	j.activeCommands++
+	return j.ctx, j
+}
+
+// The job finishes once all its commands finished.
+func (h *ServerHandler) finishJobCommand(j *job) {
+	if j.id == "" {
+		return
+	}
+
+	h.jobsMutex.Lock()
+	defer h.jobsMutex.Unlock()
+
+	j.activeCommands--
+	if j.activeCommands > 0 {
+		return
+	}
+	dlog.Server.Debug(h.user, "Job finished", j.id)
+	delete(h.jobs, j.id)
+	j.cancel()
+	close(j.finished)
+}
+
+// Cancels all commands of the job with the ID.
+func (h *ServerHandler) cancelJob(commandID string) bool {
+	h.jobsMutex.Lock()
+	defer h.jobsMutex.Unlock()
+
+	j, ok := h.jobs[commandID]
+	if ok {
+		j.cancel()
+	}
+	return ok
+}
+
+// Tags the output of the job with its ID and passes it on to the client. Once
+// the job finished, the client is told with a hidden ".done ID" message.
+func (h *ServerHandler) forwardJob(j *job) {
+	var buf, encoded bytes.Buffer
+	finished := j.finished
+
+	for {
+		if finished == nil && len(j.serverMessages)+len(j.maprMessages)+len(j.lines) == 0 {
+			// Sent the remaining output of the job.
+			h.encode(&encoded, protocol.HiddenMessage, []byte(".done "+j.id))
+			h.send(h.taggedMessages, encoded.String())
+			return
+		}
+		select {
+		case message := <-j.serverMessages:
+			switch {
+			case len(message) > 0 && message[0] == '.':
+				// Hidden messages aren't tagged.
+				h.encode(&encoded, protocol.HiddenMessage, []byte(message))
+			case h.serverless:
+				continue
+			default:
+				h.writeServerMessage(&buf, j.id, message)
+				h.encode(&encoded, protocol.ServerMessage, buf.Bytes())
+			}
+		case message := <-j.maprMessages:
+			h.writeAggregateMessage(&buf, j.id, message)
+			h.encode(&encoded, protocol.AggregateMessage, buf.Bytes())
+		case line := <-j.lines:
+			h.writeLine(&buf, j.id, line)
+			h.encode(&encoded, protocol.RemoteMessage, buf.Bytes())
+		case <-finished:
+			finished = nil
+			continue
+		case <-h.done.Done():
+			return
+		}
+		h.send(h.taggedMessages, encoded.String())
+		buf.Reset()
+		encoded.Reset()
+	}
+}
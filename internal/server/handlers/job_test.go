@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/mimecast/dtail/internal/io/line"
+	"github.com/mimecast/dtail/internal/lcontext"
+	"github.com/mimecast/dtail/internal/protocol"
+)
+
+// Reads the next n messages the handler sends to the client.
+func readMessages(t *testing.T, h *ServerHandler, n int) []string {
+	t.Helper()
+	var messages []string
+	var decoder protocol.FrameDecoder
+	p := make([]byte, 64*1024)
+
+	// Read times out after a second without messages.
+	for timeouts := 0; len(messages) < n; {
+		count, err := h.Read(p)
+		if err != nil {
+			t.Fatalf("Unable to read messages: %v", err)
+		}
+		if count == 0 {
+			if timeouts++; timeouts == 5 {
+				t.Fatalf("Expected %d messages but got %q", n, messages)
+			}
+			continue
+		}
+		err = decoder.Decode(p[:count], func(_ protocol.MessageType, message []byte) {
+			messages = append(messages, string(message))
+		})
+		if err != nil {
+			t.Fatalf("Unable to decode messages: %v", err)
+		}
+	}
+	return messages
+}
+
+func TestJobs(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.Background()
+
+	defaultCtx, defaultJob := h.startJobCommand(ctx, "")
+	if defaultCtx != ctx || defaultJob != h.defaultJob || h.isMultiplexed() {
+		t.Errorf("Expected commands without an ID to belong to the default job")
+	}
+
+	ctxA, a := h.startJobCommand(ctx, "a")
+	ctxB, b := h.startJobCommand(ctx, "b")
+	if _, a2 := h.startJobCommand(ctx, "a"); a2 != a {
+		t.Errorf("Expected commands with the same ID to belong to the same job")
+	}
+	if !h.isMultiplexed() {
+		t.Errorf("Expected the session to be multiplexed once a command has an ID")
+	}
+
+	// The output of concurrent jobs is tagged with their IDs.
+	h.sendln(a.serverMessages, "Hello a")
+	h.sendln(b.serverMessages, "Hello b")
+	h.send(b.maprMessages, "count≔1")
+	a.lines <- line.New(bytes.NewBufferString("Line a\n"), 1, 100, "a.log")
+
+	messages := readMessages(t, h, 4)
+	sort.Strings(messages)
+	expected := []string{
+		"AGGREGATE:b|host|count≔1",
+		"REMOTE:a|host|100|1|a.log|Line a\n",
+		"SERVER:a|host|Hello a\n",
+		"SERVER:b|host|Hello b\n",
+	}
+	for i := range expected {
+		if i >= len(messages) || messages[i] != expected[i] {
+			t.Errorf("Expected messages %q but got %q", expected, messages)
+			break
+		}
+	}
+
+	// Cancelling a job doesn't cancel the other jobs.
+	if !h.cancelJob("a") {
+		t.Errorf("Expected to cancel job a")
+	}
+	select {
+	case <-ctxA.Done():
+	default:
+		t.Errorf("Expected job a to be cancelled")
+	}
+	select {
+	case <-ctxB.Done():
+		t.Errorf("Expected job b to keep running")
+	default:
+	}
+	if h.cancelJob("c") {
+		t.Errorf("Expected not to cancel an unknown job")
+	}
+
+	// The job is done once all its commands finished.
+	h.finishJobCommand(a)
+	h.finishJobCommand(a)
+	h.finishJobCommand(b)
+	messages = readMessages(t, h, 2)
+	sort.Strings(messages)
+	if len(messages) != 2 || messages[0] != ".done a" || messages[1] != ".done b" {
+		t.Errorf("Expected .done messages of both jobs but got %q", messages)
+	}
+	if len(h.jobs) != 0 {
+		t.Errorf("Expected no jobs left but got %v", h.jobs)
+	}
+}
+
+func TestJobDone(t *testing.T) {
+	h := newTestHandler(t)
+	_, j := h.startJobCommand(context.Background(), "job-1")
+
+	// The job finishes with output not yet passed on to the client.
+	for i := 0; i < 5; i++ {
+		h.sendln(j.serverMessages, "Message")
+	}
+	h.send(j.maprMessages, "count≔5")
+	h.finishJobCommand(j)
+
+	messages := readMessages(t, h, 7)
+	for _, message := range messages[:6] {
+		if strings.HasPrefix(message, ".") {
+			t.Errorf("Expected .done after all output of the job but got %q", messages)
+		}
+	}
+	if messages[6] != ".done job-1" {
+		t.Errorf("Expected .done job-1 as last message but got %q", messages[6])
+	}
+}
+
+func TestCommandID(t *testing.T) {
+	for id, valid := range map[string]bool{
+		"":             true,
+		"job-1.a_B":    true,
+		"a|b":          false,
+		"a:b":          false,
+		"a¬b":          false,
+		"a\nb":         false,
+		"grüße":        false,
+		"foo,bar;baz ": false,
+	} {
+		if validCommandID(id) != valid {
+			t.Errorf("Expected valid %v for command ID %q", valid, id)
+		}
+	}
+
+	h := newTestHandler(t)
+	var commandIDs []string
+	h.handleCommandCb = func(ctx context.Context, ltx lcontext.LContext, argc int,
+		args []string, commandName string, options commandOptions) {
+		commandIDs = append(commandIDs, options.id)
+	}
+	handle := func(command string) {
+		encoded := base64.StdEncoding.EncodeToString([]byte(command))
+		h.handleCommand("protocol " + protocol.ProtocolCompat + " base64 " + encoded)
+	}
+
+	handle("cat:id=job-1 /var/log/foo.log")
+	handle("cat:id=a|b /var/log/foo.log")
+	if len(commandIDs) != 1 || commandIDs[0] != "job-1" {
+		t.Errorf("Expected only the command with ID job-1 to run but got %q", commandIDs)
+	}
+	messages := readMessages(t, h, 1)
+	if !strings.HasPrefix(messages[0], "SERVER|host|ERROR|") {
+		t.Errorf("Expected an error for the invalid command ID but got %q", messages)
+	}
+}
+
+func TestCommandOptions(t *testing.T) {
+	h := newTestHandler(t)
+	var options []commandOptions
+	h.handleCommandCb = func(ctx context.Context, ltx lcontext.LContext, argc int,
+		args []string, commandName string, o commandOptions) {
+		options = append(options, o)
+	}
+	handle := func(command string) {
+		encoded := base64.StdEncoding.EncodeToString([]byte(command))
+		h.handleCommand("protocol " + protocol.ProtocolCompat + " base64 " + encoded)
+	}
+
+	// The time range is per command.
+	handle("cat:quiet=true:id=a:since=100 /var/log/foo.log")
+	handle("cat:quiet=true:id=b:since=200:until=300 /var/log/foo.log")
+	if len(options) != 2 || options[0].since.Unix() != 100 || !options[0].until.IsZero() ||
+		options[1].since.Unix() != 200 || options[1].until.Unix() != 300 {
+		t.Errorf("Expected the time range of each command but got %v", options)
+	}
+	if !h.quiet {
+		t.Errorf("Expected quiet mode of the session")
+	}
+
+	// The session options can't be changed.
+	handle("cat:plain=true:id=c /var/log/foo.log")
+	if len(options) != 2 {
+		t.Errorf("Expected the command changing the session options not to run")
+	}
+	messages := readMessages(t, h, 1)
+	if !strings.HasPrefix(messages[0], "SERVER|host|ERROR|") ||
+		!strings.Contains(messages[0], "Session options can't be changed") {
+		t.Errorf("Expected an error changing the session options but got %q", messages)
+	}
+}
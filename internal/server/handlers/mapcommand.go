@@ -3,6 +3,7 @@ package handlers
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/mimecast/dtail/internal/mapr/server"
 )
@@ -27,6 +28,8 @@ func newMapCommand(serverHandler *ServerHandler, argc int,
 	return m, aggregate, nil
 }
 
-func (m mapCommand) Start(ctx context.Context, aggregatedMessages chan<- string) {
-	m.aggregate.Start(ctx, aggregatedMessages)
+func (m mapCommand) Start(ctx context.Context, timeout time.Duration,
+	aggregatedMessages chan<- string) (timedOut bool) {
+
+	return m.aggregate.Start(ctx, timeout, aggregatedMessages)
 }
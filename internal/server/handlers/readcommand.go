@@ -8,23 +8,32 @@ import (
 	"sync"
 	"time"
 
+	"github.com/mimecast/dtail/internal/config"
 	"github.com/mimecast/dtail/internal/io/dlog"
 	"github.com/mimecast/dtail/internal/io/fs"
 	"github.com/mimecast/dtail/internal/io/line"
 	"github.com/mimecast/dtail/internal/lcontext"
+	"github.com/mimecast/dtail/internal/mapr"
+	"github.com/mimecast/dtail/internal/mapr/logformat"
 	"github.com/mimecast/dtail/internal/omode"
 	"github.com/mimecast/dtail/internal/regex"
 )
 
 type readCommand struct {
-	server *ServerHandler
-	mode   omode.Mode
+	server  *ServerHandler
+	job     *job
+	mode    omode.Mode
+	options commandOptions
 }
 
-func newReadCommand(server *ServerHandler, mode omode.Mode) *readCommand {
+func newReadCommand(server *ServerHandler, job *job, mode omode.Mode,
+	options commandOptions) *readCommand {
+
 	return &readCommand{
-		server: server,
-		mode:   mode,
+		server:  server,
+		job:     job,
+		mode:    mode,
+		options: options,
 	}
 }
 
@@ -35,33 +44,38 @@ func (r *readCommand) Start(ctx context.Context, ltx lcontext.LContext,
 	if argc >= 4 {
 		deserializedRegex, err := regex.Deserialize(strings.Join(args[2:], " "))
 		if err != nil {
-			r.server.sendln(r.server.serverMessages, dlog.Server.Error(r.server.user,
+			r.server.sendln(r.job.serverMessages, dlog.Server.Error(r.server.user,
 				"Unable to parse command", err))
 			return
 		}
 		re = deserializedRegex
 	}
 	if argc < 3 {
-		r.server.sendln(r.server.serverMessages, dlog.Server.Warn(r.server.user,
+		r.server.sendln(r.job.serverMessages, dlog.Server.Warn(r.server.user,
 			"Unable to parse command", args, argc))
 		return
 	}
 
+	// The regex can be changed by the client while reading (filter command).
+	filter := regex.NewUpdatable(re)
+	r.server.addFilter(filter, r.job.id)
+	defer r.server.removeFilter(filter)
+
 	// In serverless mode, can also read data from pipe
 	// e.g.: grep foo bar.log | dmap 'from STATS select ...'
 	if r.isInputFromPipe() {
 		dlog.Server.Debug("Reading data from stdin pipe")
 		// Empty file path and globID "-" represents reading from the stdin pipe.
-		r.read(ctx, ltx, "", "-", re)
+		r.read(ctx, ltx, "", "-", filter)
 		return
 	}
 
 	dlog.Server.Debug("Reading data from file(s)")
-	r.readGlob(ctx, ltx, args[1], re, retries)
+	r.readGlob(ctx, ltx, args[1], filter, retries)
 }
 
 func (r *readCommand) readGlob(ctx context.Context, ltx lcontext.LContext,
-	glob string, re regex.Regex, retries int) {
+	glob string, re *regex.Updatable, retries int) {
 
 	retryInterval := time.Second * 5
 	glob = filepath.Clean(glob)
@@ -76,7 +90,7 @@ func (r *readCommand) readGlob(ctx context.Context, ltx lcontext.LContext,
 
 		if numPaths := len(paths); numPaths == 0 {
 			dlog.Server.Error(r.server.user, "No such file(s) to read", glob)
-			r.server.sendln(r.server.serverMessages, dlog.Server.Warn(r.server.user,
+			r.server.sendln(r.job.serverMessages, dlog.Server.Warn(r.server.user,
 				"Unable to read file(s), check server logs"))
 			select {
 			case <-ctx.Done():
@@ -91,13 +105,13 @@ func (r *readCommand) readGlob(ctx context.Context, ltx lcontext.LContext,
 		return
 	}
 
-	r.server.sendln(r.server.serverMessages, dlog.Server.Warn(r.server.user,
+	r.server.sendln(r.job.serverMessages, dlog.Server.Warn(r.server.user,
 		"Giving up to read file(s)"))
 	return
 }
 
 func (r *readCommand) readFiles(ctx context.Context, ltx lcontext.LContext,
-	paths []string, glob string, re regex.Regex, retryInterval time.Duration) {
+	paths []string, glob string, re *regex.Updatable, retryInterval time.Duration) {
 
 	var wg sync.WaitGroup
 	wg.Add(len(paths))
@@ -108,13 +122,13 @@ func (r *readCommand) readFiles(ctx context.Context, ltx lcontext.LContext,
 }
 
 func (r *readCommand) readFileIfPermissions(ctx context.Context, ltx lcontext.LContext,
-	wg *sync.WaitGroup, path, glob string, re regex.Regex) {
+	wg *sync.WaitGroup, path, glob string, re *regex.Updatable) {
 
 	defer wg.Done()
 	globID := r.makeGlobID(path, glob)
 	if !r.server.user.HasFilePermission(path, "readfiles") {
 		dlog.Server.Error(r.server.user, "No permission to read file", path, globID)
-		r.server.sendln(r.server.serverMessages, dlog.Server.Warn(r.server.user,
+		r.server.sendln(r.job.serverMessages, dlog.Server.Warn(r.server.user,
 			"Unable to read file(s), check server logs"))
 		return
 	}
@@ -122,20 +136,23 @@ func (r *readCommand) readFileIfPermissions(ctx context.Context, ltx lcontext.LC
 }
 
 func (r *readCommand) read(ctx context.Context, ltx lcontext.LContext,
-	path, globID string, re regex.Regex) {
+	path, globID string, re *regex.Updatable) {
 
 	dlog.Server.Info(r.server.user, "Start reading", path, globID)
 	var reader fs.FileReader
 	var limiter chan struct{}
+	timeRange := r.makeTimeRange()
 
 	switch r.mode {
 	case omode.GrepClient, omode.CatClient:
-		reader = fs.NewCatFile(path, globID, r.server.serverMessages)
+		reader = fs.NewCatFile(path, globID, r.job.serverMessages, timeRange,
+			r.server.user.RateLimiter())
 		limiter = r.server.catLimiter
 	case omode.TailClient:
 		fallthrough
 	default:
-		reader = fs.NewTailFile(path, globID, r.server.serverMessages)
+		reader = fs.NewTailFile(path, globID, r.job.serverMessages, timeRange,
+			r.server.user.RateLimiter())
 		limiter = r.server.tailLimiter
 	}
 
@@ -160,8 +177,8 @@ func (r *readCommand) read(ctx context.Context, ltx lcontext.LContext,
 		}
 	}
 
-	lines := r.server.lines
-	aggregate := r.server.aggregate
+	lines := r.job.lines
+	aggregate := r.job.aggregate
 
 	for {
 		if aggregate != nil {
@@ -189,6 +206,27 @@ func (r *readCommand) read(ctx context.Context, ltx lcontext.LContext,
 	}
 }
 
+// The timestamps of the log lines are parsed according to the mapr log format,
+// so that e.g. dmap queries on JSON logs use the JSON time fields.
+func (r *readCommand) makeTimeRange() fs.TimeRange {
+	timeRange := fs.TimeRange{Since: r.options.since, Until: r.options.until}
+	if timeRange.Since.IsZero() && timeRange.Until.IsZero() {
+		return timeRange
+	}
+
+	logFormatName := config.Server.MapreduceLogFormat
+	var query *mapr.Query
+	if r.job.aggregate != nil {
+		logFormatName, query = r.job.aggregate.LogFormat()
+	}
+	timestamper, err := logformat.NewTimestamper(logFormatName, query)
+	if err != nil {
+		dlog.Server.Warn(r.server.user, "Guessing log line timestamps", err)
+	}
+	timeRange.Timestamp = timestamper.Timestamp
+	return timeRange
+}
+
 func (r *readCommand) makeGlobID(path, glob string) string {
 	var idParts []string
 	pathParts := strings.Split(path, "/")
@@ -206,7 +244,7 @@ func (r *readCommand) makeGlobID(path, glob string) string {
 		return pathParts[len(pathParts)-1]
 	}
 
-	r.server.sendln(r.server.serverMessages,
+	r.server.sendln(r.job.serverMessages,
 		dlog.Server.Warn("Empty file path given?", path, glob))
 	return ""
 }
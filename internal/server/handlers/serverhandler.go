@@ -2,14 +2,21 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/mimecast/dtail/internal"
 	"github.com/mimecast/dtail/internal/config"
 	"github.com/mimecast/dtail/internal/io/dlog"
 	"github.com/mimecast/dtail/internal/io/line"
 	"github.com/mimecast/dtail/internal/lcontext"
+	"github.com/mimecast/dtail/internal/metrics"
 	"github.com/mimecast/dtail/internal/omode"
+	"github.com/mimecast/dtail/internal/regex"
 	user "github.com/mimecast/dtail/internal/user/server"
 )
 
@@ -20,7 +27,17 @@ type ServerHandler struct {
 	baseHandler
 	catLimiter  chan struct{}
 	tailLimiter chan struct{}
-	regex       string
+	// The regexes of all active read commands (and the IDs of their jobs),
+	// changed by the filter command.
+	filters      map[*regex.Updatable]string
+	filtersMutex sync.Mutex
+	// The jobs of the commands without an ID and with an ID.
+	defaultJob *job
+	jobs       map[string]*job
+	jobsMutex  sync.Mutex
+	// Once a command with an ID was received, the session is kept open after
+	// all commands finished (until closed by the client).
+	multiplexed bool
 }
 
 // NewServerHandler returns the server handler.
@@ -34,12 +51,19 @@ func NewServerHandler(user *user.User, catLimiter,
 			lines:            make(chan *line.Line, 100),
 			serverMessages:   make(chan string, 10),
 			maprMessages:     make(chan string, 10),
+			taggedMessages:   make(chan string, 10),
 			ackCloseReceived: make(chan struct{}),
 			user:             user,
 		},
 		catLimiter:  catLimiter,
 		tailLimiter: tailLimiter,
-		regex:       ".",
+		filters:     make(map[*regex.Updatable]string),
+		jobs:        make(map[string]*job),
+	}
+	h.defaultJob = &job{
+		lines:          h.lines,
+		serverMessages: h.serverMessages,
+		maprMessages:   h.maprMessages,
 	}
 	h.handleCommandCb = h.handleUserCommand
 
@@ -55,42 +79,83 @@ func NewServerHandler(user *user.User, catLimiter,
 }
 
 func (h *ServerHandler) handleUserCommand(ctx context.Context, ltx lcontext.LContext,
-	argc int, args []string, commandName string) {
+	argc int, args []string, commandName string, options commandOptions) {
 
-	dlog.Server.Debug(h.user, "Handling user command", argc, args)
+	commandID := options.id
+	dlog.Server.Debug(h.user, "Handling user command", argc, args, commandID)
 	h.incrementActiveCommands()
+	metrics.ActiveCommands.Add(1, h.user.Name)
 	commandFinished := func() {
-		if h.decrementActiveCommands() == 0 {
+		metrics.ActiveCommands.Add(-1, h.user.Name)
+		if h.decrementActiveCommands() == 0 && !h.isMultiplexed() {
 			h.shutdown()
 		}
 	}
 
+	// A command can have a time budget: timeout SECONDS COMMAND ARGS...
+	var timeout time.Duration
+	if commandName == "timeout" {
+		var err error
+		if timeout, err = parseTimeout(args); err != nil {
+			h.sendln(h.serverMessages, dlog.Server.Error(h.user,
+				"Unable to parse command", err))
+			commandFinished()
+			return
+		}
+		// Without "timeout" and the seconds.
+		args, argc = args[2:], argc-2
+		commandName = args[0]
+	}
+
 	switch commandName {
 	case "grep", "cat":
-		command := newReadCommand(h, omode.CatClient)
+		ctx, j := h.startJobCommand(ctx, commandID)
+		command := newReadCommand(h, j, omode.CatClient, options)
 		go func() {
-			command.Start(ctx, ltx, argc, args, 1)
+			h.withTimeout(ctx, j, timeout, commandName, func(ctx context.Context) bool {
+				command.Start(ctx, ltx, argc, args, 1)
+				return errors.Is(ctx.Err(), context.DeadlineExceeded)
+			})
+			h.finishJobCommand(j)
 			commandFinished()
 		}()
 	case "tail":
-		command := newReadCommand(h, omode.TailClient)
+		ctx, j := h.startJobCommand(ctx, commandID)
+		command := newReadCommand(h, j, omode.TailClient, options)
 		go func() {
-			command.Start(ctx, ltx, argc, args, 10)
+			h.withTimeout(ctx, j, timeout, commandName, func(ctx context.Context) bool {
+				command.Start(ctx, ltx, argc, args, 10)
+				return errors.Is(ctx.Err(), context.DeadlineExceeded)
+			})
+			h.finishJobCommand(j)
 			commandFinished()
 		}()
 	case "map":
+		ctx, j := h.startJobCommand(ctx, commandID)
 		command, aggregate, err := newMapCommand(h, argc, args)
 		if err != nil {
-			h.sendln(h.serverMessages, err.Error())
+			h.sendln(j.serverMessages, err.Error())
 			dlog.Server.Error(h.user, err)
+			h.finishJobCommand(j)
 			commandFinished()
 			return
 		}
-		h.aggregate = aggregate
+		j.aggregate = aggregate
 		go func() {
-			command.Start(ctx, h.maprMessages)
+			// The aggregate handles the timeout itself, as it has to serialize
+			// the final result once it's reached.
+			h.withTimeout(ctx, j, 0, commandName, func(ctx context.Context) bool {
+				return command.Start(ctx, timeout, j.maprMessages)
+			})
+			h.finishJobCommand(j)
 			commandFinished()
 		}()
+	case "filter":
+		h.handleFilterCommand(args, commandID)
+		commandFinished()
+	case "cancel":
+		h.handleCancelCommand(args)
+		commandFinished()
 	case ".ack":
 		h.handleAckCommand(argc, args)
 		commandFinished()
@@ -100,3 +165,109 @@ func (h *ServerHandler) handleUserCommand(ctx context.Context, ltx lcontext.LCon
 		commandFinished()
 	}
 }
+
+// Replaces the regex of all active read commands (or of the job with the ID),
+// e.g. to change what a running tail greps for without reconnecting.
+func (h *ServerHandler) handleFilterCommand(args []string, commandID string) {
+	if len(args) < 2 {
+		h.sendln(h.serverMessages, dlog.Server.Warn(h.user,
+			"Unable to parse command", args))
+		return
+	}
+	serialized := strings.Join(args[1:], " ")
+	re, err := regex.Deserialize(serialized)
+	if err != nil {
+		h.sendln(h.serverMessages, dlog.Server.Error(h.user,
+			"Unable to parse command", err))
+		return
+	}
+
+	var count int
+	h.filtersMutex.Lock()
+	for filter, jobID := range h.filters {
+		if commandID == "" || commandID == jobID {
+			filter.Store(re)
+			count++
+		}
+	}
+	h.filtersMutex.Unlock()
+
+	message := dlog.Server.Info(h.user, "Changed filter", serialized, count)
+	if h.quiet {
+		return
+	}
+	serverMessages := h.serverMessages
+	if commandID != "" {
+		// Tagged with the ID, unless the job isn't running (anymore).
+		h.jobsMutex.Lock()
+		if j, ok := h.jobs[commandID]; ok {
+			serverMessages = j.serverMessages
+		}
+		h.jobsMutex.Unlock()
+	}
+	h.sendln(serverMessages, message)
+}
+
+func (h *ServerHandler) addFilter(filter *regex.Updatable, jobID string) {
+	h.filtersMutex.Lock()
+	defer h.filtersMutex.Unlock()
+	h.filters[filter] = jobID
+}
+
+func (h *ServerHandler) removeFilter(filter *regex.Updatable) {
+	h.filtersMutex.Lock()
+	defer h.filtersMutex.Unlock()
+	delete(h.filters, filter)
+}
+
+// Cancels the job with the ID, the session stays open.
+func (h *ServerHandler) handleCancelCommand(args []string) {
+	if len(args) != 2 {
+		h.sendln(h.serverMessages, dlog.Server.Warn(h.user,
+			"Unable to parse command", args))
+		return
+	}
+	if !h.cancelJob(args[1]) {
+		h.sendln(h.serverMessages, dlog.Server.Warn(h.user,
+			"No such command to cancel", args[1]))
+		return
+	}
+	dlog.Server.Info(h.user, "Cancelled command", args[1])
+}
+
+func (h *ServerHandler) isMultiplexed() bool {
+	h.jobsMutex.Lock()
+	defer h.jobsMutex.Unlock()
+	return h.multiplexed
+}
+
+// Parses the seconds of the timeout command.
+func parseTimeout(args []string) (time.Duration, error) {
+	if len(args) < 3 {
+		return 0, fmt.Errorf("timeout command requires seconds and a command: %v", args)
+	}
+	seconds, err := strconv.Atoi(args[1])
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("invalid timeout seconds '%s'", args[1])
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// Runs the command with the time budget (if any), and tells the client if the
+// command stopped because the timeout was reached.
+func (h *ServerHandler) withTimeout(ctx context.Context, j *job, timeout time.Duration,
+	commandName string, run func(context.Context) (timedOut bool)) {
+
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	if !run(ctx) {
+		return
+	}
+	message := dlog.Server.Warn(h.user, "Timeout reached, stopped command", commandName)
+	if !h.quiet {
+		h.sendln(j.serverMessages, message)
+	}
+}
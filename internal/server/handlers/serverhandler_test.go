@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"context"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mimecast/dtail/internal/config"
+	"github.com/mimecast/dtail/internal/io/dlog"
+	"github.com/mimecast/dtail/internal/regex"
+	"github.com/mimecast/dtail/internal/source"
+	user "github.com/mimecast/dtail/internal/user/server"
+)
+
+func TestMain(m *testing.M) {
+	config.Setup(source.Server, &config.Args{ConfigFile: "none", Logger: "none",
+		What: "test"}, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	dlog.Start(ctx, &wg, source.Server)
+
+	code := m.Run()
+	cancel()
+	wg.Wait()
+	os.Exit(code)
+}
+
+// Returns a handler of a client talking the current (framed) protocol.
+func newTestHandler(t *testing.T) *ServerHandler {
+	h := NewServerHandler(&user.User{Name: "paul"}, make(chan struct{}, 1),
+		make(chan struct{}, 1))
+	h.hostname = "host"
+	h.framed.Store(true)
+	t.Cleanup(h.Shutdown)
+	return h
+}
+
+func TestParseTimeout(t *testing.T) {
+	for args, expected := range map[string]time.Duration{
+		"timeout 10 cat /var/log/foo.log":   10 * time.Second,
+		"timeout 1 map select count($line)": time.Second,
+		"timeout 0 cat /var/log/foo.log":    0,
+		"timeout -5 cat /var/log/foo.log":   0,
+		"timeout 1.5 cat /var/log/foo.log":  0,
+		"timeout foo cat /var/log/foo.log":  0,
+		"timeout 10":                        0,
+		"timeout":                           0,
+	} {
+		timeout, err := parseTimeout(strings.Split(args, " "))
+		if timeout != expected {
+			t.Errorf("Expected timeout %v for '%s' but got %v", expected, args, timeout)
+		}
+		if (err == nil) != (expected > 0) {
+			t.Errorf("Expected error %v for '%s' but got %v", expected == 0, args, err)
+		}
+	}
+}
+
+func TestWithTimeout(t *testing.T) {
+	h := newTestHandler(t)
+	j := h.defaultJob
+
+	var deadline time.Time
+	h.withTimeout(context.Background(), j, time.Minute, "cat", func(ctx context.Context) bool {
+		deadline, _ = ctx.Deadline()
+		return false
+	})
+	if remaining := time.Until(deadline); remaining <= 0 || remaining > time.Minute {
+		t.Errorf("Expected the command to run with a deadline in a minute but got %v", deadline)
+	}
+	if len(j.serverMessages) != 0 {
+		t.Errorf("Expected no message for a command finished in time")
+	}
+
+	h.withTimeout(context.Background(), j, 0, "cat", func(ctx context.Context) bool {
+		if _, ok := ctx.Deadline(); ok {
+			t.Errorf("Expected the command to run without a deadline")
+		}
+		return false
+	})
+
+	h.withTimeout(context.Background(), j, time.Millisecond, "map", func(ctx context.Context) bool {
+		<-ctx.Done()
+		return true
+	})
+	if len(j.serverMessages) != 1 {
+		t.Fatalf("Expected a message for the timed out command")
+	}
+	if message := <-j.serverMessages; !strings.Contains(message, "Timeout reached") {
+		t.Errorf("Expected a timeout message but got %q", message)
+	}
+}
+
+func TestFilterCommand(t *testing.T) {
+	h := newTestHandler(t)
+	_, a := h.startJobCommand(context.Background(), "a")
+	filterA := regex.NewUpdatable(regex.NewNoop())
+	filterB := regex.NewUpdatable(regex.NewNoop())
+	h.addFilter(filterA, "a")
+	h.addFilter(filterB, "b")
+
+	// The confirmation of a filter scoped to a job is tagged with its ID.
+	h.handleFilterCommand([]string{"filter", "regex:default", "FOO"}, "a")
+	if filterA.Load().String() == filterB.Load().String() {
+		t.Errorf("Expected only the filter of job a to change")
+	}
+	messages := readMessages(t, h, 1)
+	if !strings.HasPrefix(messages[0], "SERVER:a|host|INFO|") ||
+		!strings.Contains(messages[0], "|Changed filter|regex:default FOO|1") {
+		t.Errorf("Expected a tagged filter confirmation but got %q", messages)
+	}
+
+	h.handleFilterCommand([]string{"filter", "regex:default", "BAR"}, "")
+	messages = readMessages(t, h, 1)
+	if !strings.HasPrefix(messages[0], "SERVER|host|INFO|") ||
+		!strings.Contains(messages[0], "|Changed filter|regex:default BAR|2") {
+		t.Errorf("Expected an untagged filter confirmation but got %q", messages)
+	}
+	h.finishJobCommand(a)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/mimecast/dtail/internal/config"
+	"github.com/mimecast/dtail/internal/io/dlog"
+	"github.com/mimecast/dtail/internal/metrics"
+)
+
+// Serve the server metrics in the Prometheus text format via HTTP.
+func (s *Server) startMetrics(ctx context.Context) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := s.writeMetrics(w); err != nil {
+			dlog.Server.Debug("Unable to write metrics", err)
+		}
+	})
+
+	httpServer := http.Server{
+		Addr:              config.Server.MetricsBindAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: time.Second * 10,
+	}
+	go func() {
+		<-ctx.Done()
+		httpServer.Close()
+	}()
+
+	dlog.Server.Info("Serving metrics", config.Server.MetricsBindAddress)
+	if err := httpServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		dlog.Server.Error("Unable to serve metrics", err)
+	}
+}
+
+func (s *Server) writeMetrics(w io.Writer) error {
+	t := metrics.NewTextWriter(w)
+	currentConnections, lifetimeConnections := s.stats.connections()
+
+	t.Write("dtail_connections", "Currently open SSH connections.",
+		metrics.GaugeType, float64(currentConnections))
+	t.Write("dtail_connections_total", "SSH connections since the server started.",
+		metrics.CounterType, float64(lifetimeConnections))
+	t.WriteVec("dtail_active_commands", "Currently running commands per user.",
+		metrics.GaugeType, metrics.ActiveCommands)
+
+	t.Write("dtail_cat_limiter_used", "Files currently read by cat and grep commands.",
+		metrics.GaugeType, float64(len(s.catLimiter)))
+	t.Write("dtail_cat_limiter_capacity", "Max files concurrently read by cat and grep commands.",
+		metrics.GaugeType, float64(cap(s.catLimiter)))
+	t.Write("dtail_tail_limiter_used", "Files currently read by tail commands.",
+		metrics.GaugeType, float64(len(s.tailLimiter)))
+	t.Write("dtail_tail_limiter_capacity", "Max files concurrently read by tail commands.",
+		metrics.GaugeType, float64(cap(s.tailLimiter)))
+
+	t.Write("dtail_read_bytes_total", "Bytes read from log files.",
+		metrics.CounterType, float64(metrics.BytesRead.Value()))
+	t.Write("dtail_read_lines_total", "Lines read from log files.",
+		metrics.CounterType, float64(metrics.LinesRead.Value()))
+	matched := float64(metrics.LinesMatched.Value())
+	notMatched := float64(metrics.LinesNotMatched.Value())
+	t.Write("dtail_matched_lines_total", "Lines matching the regex of a command.",
+		metrics.CounterType, matched)
+	t.Write("dtail_not_matched_lines_total", "Lines not matching the regex of a command.",
+		metrics.CounterType, notMatched)
+	hitRatio := math.NaN()
+	if matched+notMatched > 0 {
+		hitRatio = matched / (matched + notMatched)
+	}
+	t.Write("dtail_regex_hit_ratio", "Ratio of lines matching the regex of a command.",
+		metrics.GaugeType, hitRatio)
+	t.Write("dtail_dropped_lines_total", "Matching lines not sent as the client was too slow.",
+		metrics.CounterType, float64(metrics.LinesDropped.Value()))
+
+	t.WriteVec("dtail_job_running", "Whether a scheduled or continuous mapr job is running.",
+		metrics.GaugeType, metrics.JobRunning)
+	t.WriteVec("dtail_job_runs_total", "Runs of a scheduled or continuous mapr job.",
+		metrics.CounterType, metrics.JobRuns)
+	t.WriteVec("dtail_job_last_exit_status", "Exit status of the last run of a mapr job.",
+		metrics.GaugeType, metrics.JobLastExitStatus)
+	for _, family := range metrics.JobResults.All() {
+		t.WriteFamily(family)
+	}
+
+	return t.Err()
+}
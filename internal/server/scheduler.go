@@ -11,6 +11,7 @@ import (
 	"github.com/mimecast/dtail/internal/clients"
 	"github.com/mimecast/dtail/internal/config"
 	"github.com/mimecast/dtail/internal/io/dlog"
+	"github.com/mimecast/dtail/internal/metrics"
 	"github.com/mimecast/dtail/internal/omode"
 
 	gossh "golang.org/x/crypto/ssh"
@@ -91,7 +92,11 @@ func (s *scheduler) runJob(ctx context.Context, job config.Scheduled) {
 	defer cancel()
 
 	dlog.Server.Info(fmt.Sprintf("Starting job %s", job.Name))
+	metrics.JobRunning.Set(1, "scheduled", job.Name)
+	metrics.JobRuns.Add(1, "scheduled", job.Name)
 	status := client.Start(jobCtx, make(chan string))
+	metrics.JobRunning.Set(0, "scheduled", job.Name)
+	metrics.JobLastExitStatus.Set(float64(status), "scheduled", job.Name)
 	logMessage := fmt.Sprintf("Job exited with status %d", status)
 
 	if status != 0 {
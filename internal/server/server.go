@@ -10,6 +10,7 @@ import (
 
 	"github.com/mimecast/dtail/internal/config"
 	"github.com/mimecast/dtail/internal/io/dlog"
+	"github.com/mimecast/dtail/internal/mapr/logformat"
 	"github.com/mimecast/dtail/internal/server/handlers"
 	"github.com/mimecast/dtail/internal/ssh/server"
 	user "github.com/mimecast/dtail/internal/user/server"
@@ -52,6 +53,10 @@ func New() *Server {
 		cont:        newContinuous(),
 	}
 
+	if err := logformat.ValidateConfigured(config.Server.LogFormats); err != nil {
+		dlog.Server.Error("Invalid log format configuration", err)
+	}
+
 	s.sshServerConfig.PasswordCallback = s.Callback
 	s.sshServerConfig.PublicKeyCallback = server.PublicKeyCallback
 
@@ -78,6 +83,9 @@ func (s *Server) Start(ctx context.Context) int {
 	go s.stats.start(ctx)
 	go s.sched.start(ctx)
 	go s.cont.start(ctx)
+	if config.Server.MetricsBindAddress != "" {
+		go s.startMetrics(ctx)
+	}
 	go s.listenerLoop(ctx, listener)
 
 	<-ctx.Done()
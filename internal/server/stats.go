@@ -32,6 +32,12 @@ func (s *stats) decrementConnections() {
 	s.mutex.Unlock()
 }
 
+func (s *stats) connections() (int, uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.currentConnections, s.lifetimeConnections
+}
+
 func (s *stats) hasConnections() bool {
 	s.mutex.Lock()
 	currentConnections := s.currentConnections
@@ -12,4 +12,5 @@ type HostKeyCallback interface {
 	Wrap() ssh.HostKeyCallback
 	Untrusted(server string) bool
 	PromptAddHosts(ctx context.Context)
+	RejectUnknownHosts(ctx context.Context)
 }
@@ -138,6 +138,27 @@ func (c KnownHostsCallback) PromptAddHosts(ctx context.Context) {
 	}
 }
 
+// RejectUnknownHosts rejects all unknown hosts without prompting the user,
+// e.g. as the terminal is used by the TUI. Unless all hosts are trusted anyway.
+func (c KnownHostsCallback) RejectUnknownHosts(ctx context.Context) {
+	for {
+		select {
+		case unknown := <-c.unknownCh:
+			select {
+			case <-c.trustAllHostsCh:
+				dlog.Client.Warn("Trusting host key of server", unknown.server)
+				c.trustHosts([]unknownHost{unknown})
+			default:
+				dlog.Client.Error("Rejecting unknown host, add it to the known hosts file "+
+					"first or trust all hosts", unknown.server)
+				c.dontTrustHosts([]unknownHost{unknown})
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
 func (c KnownHostsCallback) promptAddHosts(hosts []unknownHost) {
 	var servers []string
 	for _, host := range hosts {
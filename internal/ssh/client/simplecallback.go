@@ -34,3 +34,8 @@ func (SimpleCallback) Untrusted(server string) bool {
 func (SimpleCallback) PromptAddHosts(ctx context.Context) {
 	// Not used here.
 }
+
+// RejectUnknownHosts rejects all unknown hosts without prompting the user.
+func (SimpleCallback) RejectUnknownHosts(ctx context.Context) {
+	// Not used here.
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/mimecast/dtail/internal/config"
 	"github.com/mimecast/dtail/internal/io/dlog"
 	"github.com/mimecast/dtail/internal/io/fs/permissions"
+	"github.com/mimecast/dtail/internal/ratelimit"
 )
 
 const maxLinkDepth int = 100
@@ -22,6 +23,8 @@ type User struct {
 	remoteAddress string
 	// The permissions the user has.
 	permissions []string
+	// Throttles the user reading files, nil if unlimited.
+	limiter *ratelimit.Limiter
 }
 
 // New returns a new user.
@@ -30,11 +33,15 @@ func New(name, remoteAddress string) (*User, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &User{
+	u := User{
 		Name:          name,
 		remoteAddress: remoteAddress,
 		permissions:   permissions,
-	}, nil
+	}
+	if !u.background() {
+		u.limiter = ratelimit.ForUser(name, config.ServerUserRateLimit(name))
+	}
+	return &u, nil
 }
 
 // String representation of the user.
@@ -42,10 +49,21 @@ func (u *User) String() string {
 	return fmt.Sprintf("%s@%s", u.Name, u.remoteAddress)
 }
 
+// RateLimiter returns the limiter throttling the user reading files. It's nil
+// if the user is unlimited, e.g. the background user of the mapr jobs.
+func (u *User) RateLimiter() *ratelimit.Limiter {
+	return u.limiter
+}
+
+// Is it the user running the scheduled or continuous mapr jobs?
+func (u *User) background() bool {
+	return u.Name == config.ScheduleUser || u.Name == config.ContinuousUser
+}
+
 // HasFilePermission is used to determine whether user is allowed to read a file.
 func (u *User) HasFilePermission(filePath, permissionType string) (hasPermission bool) {
 	dlog.Server.Debug(u, filePath, permissionType, "Checking config permissions")
-	if u.Name == config.ScheduleUser || u.Name == config.ContinuousUser {
+	if u.background() {
 		// Background user has same permissions as dtail process itself.
 		return true
 	}